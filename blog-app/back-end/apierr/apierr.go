@@ -0,0 +1,135 @@
+// Package apierr writes the error envelope shared by every endpoint and
+// turns request validation failures into per-field messages.
+package apierr
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+// Error is the body of every error response
+//
+//	{"code": "validation_failed", "message": "...", "fields": {"title": "is required"}}
+type Error struct {
+	Code    string            `json:"code"`
+	Message string            `json:"message"`
+	Fields  map[string]string `json:"fields,omitempty"`
+}
+
+// codes of the statuses answered without a more specific one
+var statusCodes = map[int]string{
+	http.StatusBadRequest:            "bad_request",
+	http.StatusUnauthorized:          "unauthorized",
+	http.StatusForbidden:             "forbidden",
+	http.StatusNotFound:              "not_found",
+	http.StatusConflict:              "conflict",
+	http.StatusRequestEntityTooLarge: "payload_too_large",
+	http.StatusUnsupportedMediaType:  "unsupported_media_type",
+	http.StatusUnprocessableEntity:   "validation_failed",
+	http.StatusTooManyRequests:       "too_many_requests",
+	http.StatusInternalServerError:   "internal_error",
+}
+
+// Abort answers with the envelope, the code derived from the status
+func Abort(c *gin.Context, status int, message string) {
+	AbortCode(c, status, statusCode(status), message)
+}
+
+// AbortCode answers with the envelope and an explicit code
+func AbortCode(c *gin.Context, status int, code, message string) {
+	c.AbortWithStatusJSON(status, Error{Code: code, Message: message})
+}
+
+// AbortFields answers with per-field messages
+func AbortFields(c *gin.Context, status int, message string, fields map[string]string) {
+	c.AbortWithStatusJSON(status, Error{Code: statusCode(status), Message: message, Fields: fields})
+}
+
+// Invalid answers 422 with a message for one field
+func Invalid(c *gin.Context, field, message string) {
+	AbortFields(c, http.StatusUnprocessableEntity, "validation failed", map[string]string{field: message})
+}
+
+func statusCode(status int) string {
+	if code, ok := statusCodes[status]; ok {
+		return code
+	}
+	return strings.ReplaceAll(strings.ToLower(http.StatusText(status)), " ", "_")
+}
+
+// BindJSON decodes the request body into obj and runs its binding tags.
+// Keys obj has no field for are rejected, so a client can't set ids, owners
+// or timestamps by sending them along. A malformed body is answered with 400,
+// unknown keys and failed rules with 422 and a message per field. Returns
+// false when a response was written.
+func BindJSON(c *gin.Context, obj interface{}) bool {
+	err := decodeJSON(c.Request, obj)
+	if err == nil {
+		err = binding.Validator.ValidateStruct(obj)
+	}
+	if err == nil {
+		return true
+	}
+
+	if fields := validationFields(err); fields != nil {
+		AbortFields(c, http.StatusUnprocessableEntity, "validation failed", fields)
+		return false
+	}
+
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case strings.HasPrefix(err.Error(), unknownFieldPrefix):
+		field, _ := strconv.Unquote(strings.TrimPrefix(err.Error(), unknownFieldPrefix))
+		AbortFields(c, http.StatusUnprocessableEntity, "validation failed", map[string]string{
+			field: "is not allowed",
+		})
+	case errors.As(err, &typeErr) && typeErr.Field != "":
+		AbortFields(c, http.StatusUnprocessableEntity, "validation failed", map[string]string{
+			typeErr.Field: fmt.Sprintf("must be a %s", jsonType(typeErr.Type.Kind().String())),
+		})
+	case errors.As(err, &typeErr):
+		// raised inside a custom UnmarshalJSON (model.Patch), which loses the key
+		AbortCode(c, http.StatusBadRequest, "invalid_body",
+			fmt.Sprintf("request body has a %s where a %s is expected", typeErr.Value, jsonType(typeErr.Type.Kind().String())))
+	case errors.Is(err, io.EOF):
+		AbortCode(c, http.StatusBadRequest, "invalid_body", "request body is required")
+	default:
+		AbortCode(c, http.StatusBadRequest, "invalid_body", "request body is not valid JSON")
+	}
+	return false
+}
+
+// error text of DisallowUnknownFields, encoding/json has no type for it
+const unknownFieldPrefix = "json: unknown field "
+
+func decodeJSON(req *http.Request, obj interface{}) error {
+	if req.Body == nil {
+		return io.EOF
+	}
+	dec := json.NewDecoder(req.Body)
+	dec.DisallowUnknownFields()
+	return dec.Decode(obj)
+}
+
+// JSON type names for Go kinds in type errors
+func jsonType(kind string) string {
+	switch {
+	case strings.HasPrefix(kind, "int"), strings.HasPrefix(kind, "uint"), strings.HasPrefix(kind, "float"):
+		return "number"
+	case kind == "slice" || kind == "array":
+		return "list"
+	case kind == "struct" || kind == "map":
+		return "object"
+	case kind == "bool":
+		return "boolean"
+	}
+	return kind
+}
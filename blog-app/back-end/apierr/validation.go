@@ -0,0 +1,107 @@
+package apierr
+
+import (
+	"errors"
+	"fmt"
+	"gin-blog-app/model"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+var usernamePattern = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+// custom rules and json field names in validation errors
+func init() {
+	v, ok := binding.Validator.Engine().(*validator.Validate)
+	if !ok {
+		return
+	}
+
+	v.RegisterTagNameFunc(func(f reflect.StructField) string {
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			return ""
+		}
+		if name == "" {
+			return f.Name
+		}
+		return name
+	})
+
+	// merge-patch fields are checked by their new value, absent and null
+	// ones skip the rules
+	v.RegisterCustomTypeFunc(func(field reflect.Value) interface{} {
+		return field.Interface().(interface{ Present() interface{} }).Present()
+	}, model.Patch[string]{}, model.Patch[[]string]{}, model.Patch[[]uint]{}, model.Patch[time.Time]{})
+
+	// letters, digits, '.', '_' and '-'
+	_ = v.RegisterValidation("username", func(fl validator.FieldLevel) bool {
+		return usernamePattern.MatchString(fl.Field().String())
+	})
+	// not empty once surrounding whitespace is trimmed
+	_ = v.RegisterValidation("notblank", func(fl validator.FieldLevel) bool {
+		return strings.TrimSpace(fl.Field().String()) != ""
+	})
+	// UTF-8 length, max counts characters (bcrypt's limit is in bytes)
+	_ = v.RegisterValidation("maxbytes", func(fl validator.FieldLevel) bool {
+		limit, err := strconv.Atoi(fl.Param())
+		return err == nil && len(fl.Field().String()) <= limit
+	})
+}
+
+// field path -> message of validator errors, nil for other errors
+func validationFields(err error) map[string]string {
+	var errs validator.ValidationErrors
+	if !errors.As(err, &errs) {
+		return nil
+	}
+
+	fields := make(map[string]string, len(errs))
+	for _, fe := range errs {
+		// "PostInput.tags[0]" -> "tags[0]"
+		path := fe.Namespace()
+		if _, rest, ok := strings.Cut(path, "."); ok {
+			path = rest
+		}
+		if _, dup := fields[path]; !dup {
+			fields[path] = fieldMessage(fe)
+		}
+	}
+	return fields
+}
+
+func fieldMessage(fe validator.FieldError) string {
+	unit := "characters"
+	switch fe.Kind() {
+	case reflect.Slice, reflect.Array, reflect.Map:
+		unit = "items"
+	}
+
+	switch fe.Tag() {
+	case "required", "notblank":
+		return "is required"
+	case "min":
+		return fmt.Sprintf("must be at least %s %s", fe.Param(), unit)
+	case "max":
+		return fmt.Sprintf("must be at most %s %s", fe.Param(), unit)
+	case "maxbytes":
+		return fmt.Sprintf("must be at most %s bytes", fe.Param())
+	case "len":
+		return fmt.Sprintf("must be exactly %s %s", fe.Param(), unit)
+	case "email":
+		return "must be a valid email address"
+	case "oneof":
+		return "must be one of " + strings.Join(strings.Fields(fe.Param()), ", ")
+	case "username":
+		return "may only contain letters, digits, '.', '_' and '-'"
+	case "gt":
+		return "must be greater than " + fe.Param()
+	}
+	return "is invalid"
+}
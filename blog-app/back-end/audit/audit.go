@@ -0,0 +1,61 @@
+package audit
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// Event is one security relevant action
+type Event struct {
+	Time    time.Time              `json:"time"`
+	Type    string                 `json:"type"`
+	Subject string                 `json:"subject,omitempty"`
+	IP      string                 `json:"ip,omitempty"`
+	Details map[string]interface{} `json:"details,omitempty"`
+}
+
+// Logger records audit events
+type Logger interface {
+	Log(e Event)
+}
+
+// writes one JSON object per line
+type writerLogger struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func NewWriterLogger(w io.Writer) Logger {
+	return &writerLogger{w: w}
+}
+
+// NewFileLogger appends audit events to a file
+func NewFileLogger(path string) (Logger, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	return NewWriterLogger(f), nil
+}
+
+func (l *writerLogger) Log(e Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	line, err := json.Marshal(e)
+	if err != nil {
+		log.Printf("audit: %v", err)
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, err := l.w.Write(append(line, '\n')); err != nil {
+		log.Printf("audit: %v", err)
+	}
+}
@@ -0,0 +1,580 @@
+// Package config loads the server configuration. Every setting has a file
+// key, an environment variable and a flag; later sources win:
+//
+//	defaults < config file (YAML or TOML) < environment < flags
+//
+// The file is named by -config or CONFIG_FILE.
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"gin-blog-app/token"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+	"golang.org/x/crypto/bcrypt"
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the server configuration
+type Config struct {
+	Server   Server
+	Database Database
+	CORS     CORS
+	Cookie   Cookie
+	Session  Session
+	Security Security
+	Tokens   Tokens
+	Posts    Posts
+	Uploads  Uploads
+	Audit    Audit
+	Mail     Mail
+}
+
+type Server struct {
+	Addr string // listen address, ":8080"
+	// how long in-flight requests may run on after SIGTERM
+	ShutdownTimeout time.Duration
+	// proxies (IPs or CIDRs) whose X-Forwarded-For is believed, none by
+	// default: the client IP keys login throttling and the audit log
+	TrustedProxies []string
+}
+
+// Database is the postgres connection, DSN wins over the single fields
+type Database struct {
+	DSN      string
+	Host     string
+	Port     int
+	User     string
+	Password string
+	Name     string
+	SSLMode  string
+}
+
+type CORS struct {
+	AllowOrigins []string // the front-end origins
+}
+
+type Cookie struct {
+	Secure   bool
+	SameSite string // lax, strict or none
+	Domain   string // empty for a host-only cookie
+}
+
+type Session struct {
+	AbsoluteLifetime time.Duration
+	IdleTimeout      time.Duration
+	SweepInterval    time.Duration
+}
+
+type Security struct {
+	BcryptCost int
+	// promoted to admin at startup while there is no admin, startup fails
+	// when the account doesn't exist
+	BootstrapAdmin string
+}
+
+// Tokens is token auth for API clients, off without signing keys
+type Tokens struct {
+	SigningKeys string // "kid1:secret1,kid2:secret2"
+	ActiveKID   string // the last key when empty
+	AccessTTL   time.Duration
+	RefreshTTL  time.Duration
+}
+
+type Posts struct {
+	// how often scheduled posts are published
+	PublishInterval time.Duration
+	// how long trashed posts are kept, and how often they are purged
+	TrashRetention time.Duration
+	PurgeInterval  time.Duration
+}
+
+type Uploads struct {
+	Storage string // local or s3
+	Dir     string // local storage directory
+	S3      S3
+	MaxSize int64 // bytes
+	// unattached uploads older than OrphanTTL are removed every CleanupInterval
+	CleanupInterval time.Duration
+	OrphanTTL       time.Duration
+}
+
+// S3 is an S3-compatible bucket (AWS, MinIO, ...)
+type S3 struct {
+	Endpoint  string // host[:port], no scheme
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	Region    string
+	UseSSL    bool
+}
+
+type Audit struct {
+	LogFile string // stdout when empty
+}
+
+type Mail struct {
+	File string // mails are logged when empty
+	// front-end page of the reset link, the token is appended as ?token=
+	PasswordResetURL string
+}
+
+// Default is the configuration without any file, env or flags
+func Default() Config {
+	return Config{
+		Server: Server{Addr: ":8080", ShutdownTimeout: 15 * time.Second},
+		Database: Database{
+			Host:    "localhost",
+			Port:    5432,
+			User:    "postgres",
+			Name:    "blog",
+			SSLMode: "disable",
+		},
+		CORS:   CORS{AllowOrigins: []string{"http://localhost:5173"}},
+		Cookie: Cookie{SameSite: "lax"},
+		Session: Session{
+			AbsoluteLifetime: 7 * 24 * time.Hour,
+			IdleTimeout:      24 * time.Hour,
+			SweepInterval:    time.Hour,
+		},
+		Security: Security{BcryptCost: bcrypt.DefaultCost},
+		Tokens:   Tokens{AccessTTL: 15 * time.Minute, RefreshTTL: 30 * 24 * time.Hour},
+		Posts: Posts{
+			PublishInterval: time.Minute,
+			TrashRetention:  30 * 24 * time.Hour,
+			PurgeInterval:   time.Hour,
+		},
+		Uploads: Uploads{
+			Storage:         "local",
+			Dir:             "uploads",
+			S3:              S3{Region: "us-east-1", UseSSL: true},
+			MaxSize:         10 << 20,
+			CleanupInterval: time.Hour,
+			OrphanTTL:       24 * time.Hour,
+		},
+		Mail: Mail{PasswordResetURL: "http://localhost:5173/reset-password"},
+	}
+}
+
+// Load builds the configuration from args (without the program name), the
+// environment and the config file, and validates it. The arguments left
+// after the flags are returned too.
+func Load(args []string) (Config, []string, error) {
+	cfg := Default()
+	settings := cfg.settings()
+
+	// flags are collected first (-config names the file) and applied last
+	fs := flag.NewFlagSet("blog", flag.ContinueOnError)
+	configFile := fs.String("config", os.Getenv("CONFIG_FILE"), "YAML or TOML config file (env CONFIG_FILE)")
+	type flagValue struct {
+		s   setting
+		raw string
+	}
+	var flagged []flagValue
+	for _, s := range settings {
+		s := s
+		fs.Func(s.key, s.usage+" (env "+s.env+")", func(raw string) error {
+			flagged = append(flagged, flagValue{s, raw})
+			return nil
+		})
+	}
+	if err := fs.Parse(args); err != nil {
+		return cfg, nil, err
+	}
+
+	if *configFile != "" {
+		if err := loadFile(*configFile, settings); err != nil {
+			return cfg, nil, fmt.Errorf("config file %s: %w", *configFile, err)
+		}
+	}
+
+	for _, s := range settings {
+		if raw, ok := os.LookupEnv(s.env); ok && raw != "" {
+			if err := s.set(raw); err != nil {
+				return cfg, nil, fmt.Errorf("%s: %w", s.env, err)
+			}
+		}
+	}
+
+	for _, f := range flagged {
+		if err := f.s.set(f.raw); err != nil {
+			return cfg, nil, fmt.Errorf("-%s: %w", f.s.key, err)
+		}
+	}
+
+	return cfg, fs.Args(), cfg.Validate()
+}
+
+// Validate reports every invalid value at once
+func (c Config) Validate() error {
+	var errs []error
+	if c.Server.Addr == "" {
+		errs = append(errs, errors.New("server.addr is required"))
+	}
+	if c.Server.ShutdownTimeout <= 0 {
+		errs = append(errs, errors.New("server.shutdown_timeout must be positive"))
+	}
+	for _, proxy := range c.Server.TrustedProxies {
+		if _, _, err := net.ParseCIDR(proxy); err != nil && net.ParseIP(proxy) == nil {
+			errs = append(errs, fmt.Errorf("server.trusted_proxies: %q is not an IP or CIDR", proxy))
+		}
+	}
+
+	if c.Database.DSN == "" {
+		if c.Database.Host == "" || c.Database.Name == "" || c.Database.User == "" {
+			errs = append(errs, errors.New("database.host, database.name and database.user are required without database.dsn"))
+		}
+		if c.Database.Port < 1 || c.Database.Port > 65535 {
+			errs = append(errs, fmt.Errorf("database.port %d is out of range", c.Database.Port))
+		}
+		switch c.Database.SSLMode {
+		case "disable", "allow", "prefer", "require", "verify-ca", "verify-full":
+		default:
+			errs = append(errs, fmt.Errorf("database.sslmode %q is not a postgres sslmode", c.Database.SSLMode))
+		}
+	}
+
+	if len(c.CORS.AllowOrigins) == 0 {
+		errs = append(errs, errors.New("cors.allow_origins needs at least one origin"))
+	}
+	for _, origin := range c.CORS.AllowOrigins {
+		// cookies are sent cross-origin, a wildcard is not allowed with credentials
+		u, err := url.Parse(origin)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.Path != "" {
+			errs = append(errs, fmt.Errorf("cors.allow_origins: %q is not an origin like https://example.com", origin))
+		}
+	}
+
+	switch c.Cookie.SameSite {
+	case "lax", "strict":
+	case "none":
+		if !c.Cookie.Secure {
+			errs = append(errs, errors.New("cookie.same_site none requires cookie.secure"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("cookie.same_site %q must be one of lax, strict, none", c.Cookie.SameSite))
+	}
+
+	if c.Session.AbsoluteLifetime <= 0 || c.Session.IdleTimeout <= 0 || c.Session.SweepInterval <= 0 {
+		errs = append(errs, errors.New("session durations must be positive"))
+	}
+	if c.Session.IdleTimeout > c.Session.AbsoluteLifetime {
+		errs = append(errs, fmt.Errorf("session.idle_timeout (%s) exceeds session.absolute_lifetime (%s)",
+			c.Session.IdleTimeout, c.Session.AbsoluteLifetime))
+	}
+
+	if c.Security.BcryptCost < bcrypt.MinCost || c.Security.BcryptCost > bcrypt.MaxCost {
+		errs = append(errs, fmt.Errorf("security.bcrypt_cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost))
+	}
+
+	if c.Tokens.SigningKeys != "" {
+		if _, err := token.ParseKeyring(c.Tokens.SigningKeys, c.Tokens.ActiveKID); err != nil {
+			errs = append(errs, fmt.Errorf("tokens.signing_keys: %w", err))
+		}
+	} else if c.Tokens.ActiveKID != "" {
+		errs = append(errs, errors.New("tokens.active_kid needs tokens.signing_keys"))
+	}
+	if c.Tokens.AccessTTL <= 0 || c.Tokens.RefreshTTL <= 0 {
+		errs = append(errs, errors.New("tokens durations must be positive"))
+	}
+
+	if c.Posts.PublishInterval <= 0 || c.Posts.TrashRetention <= 0 || c.Posts.PurgeInterval <= 0 {
+		errs = append(errs, errors.New("posts durations must be positive"))
+	}
+
+	switch c.Uploads.Storage {
+	case "local":
+		if c.Uploads.Dir == "" {
+			errs = append(errs, errors.New("uploads.dir is required for local storage"))
+		}
+	case "s3":
+		if c.Uploads.S3.Endpoint == "" || c.Uploads.S3.Bucket == "" {
+			errs = append(errs, errors.New("uploads.s3.endpoint and uploads.s3.bucket are required for s3 storage"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("uploads.storage %q must be one of local, s3", c.Uploads.Storage))
+	}
+	if c.Uploads.MaxSize <= 0 {
+		errs = append(errs, errors.New("uploads.max_size must be positive"))
+	}
+	if c.Uploads.CleanupInterval <= 0 || c.Uploads.OrphanTTL <= 0 {
+		errs = append(errs, errors.New("uploads durations must be positive"))
+	}
+
+	if u, err := url.Parse(c.Mail.PasswordResetURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.RawQuery != "" {
+		errs = append(errs, fmt.Errorf("mail.password_reset_url: %q is not a URL like https://example.com/reset-password", c.Mail.PasswordResetURL))
+	}
+	return errors.Join(errs...)
+}
+
+// ConnString is the postgres connection string, DSN when set
+func (d Database) ConnString() string {
+	if d.DSN != "" {
+		return d.DSN
+	}
+	parts := []string{
+		"host=" + dsnValue(d.Host),
+		"port=" + strconv.Itoa(d.Port),
+		"user=" + dsnValue(d.User),
+		"dbname=" + dsnValue(d.Name),
+		"sslmode=" + dsnValue(d.SSLMode),
+	}
+	if d.Password != "" {
+		parts = append(parts, "password="+dsnValue(d.Password))
+	}
+	return strings.Join(parts, " ")
+}
+
+// quoted keyword/value, see libpq "Connection Strings"
+func dsnValue(v string) string {
+	if v != "" && !strings.ContainsAny(v, ` '\`) {
+		return v
+	}
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(v) + "'"
+}
+
+// String lists every setting, secrets redacted, for the startup log
+func (c Config) String() string {
+	settings := c.settings()
+	parts := make([]string, 0, len(settings))
+	for _, s := range settings {
+		value := s.get()
+		if s.secret && value != "" {
+			value = "[redacted]"
+		}
+		parts = append(parts, s.key+"="+value)
+	}
+	return strings.Join(parts, " ")
+}
+
+//----------------------------------SETTINGS------------------------------------------
+
+// setting is one configurable value
+type setting struct {
+	key    string // file key ("section.name") and flag name
+	env    string
+	usage  string
+	secret bool // redacted by String
+	set    func(raw string) error
+	get    func() string
+}
+
+func (c *Config) settings() []setting {
+	return []setting{
+		stringSetting("server.addr", "HTTP_ADDR", "listen address", &c.Server.Addr),
+		durationSetting("server.shutdown_timeout", "SHUTDOWN_TIMEOUT", "how long in-flight requests may finish after SIGTERM", &c.Server.ShutdownTimeout),
+		listSetting("server.trusted_proxies", "TRUSTED_PROXIES", "comma separated proxy IPs or CIDRs whose X-Forwarded-For is trusted", &c.Server.TrustedProxies),
+
+		secretSetting(stringSetting("database.dsn", "DATABASE_DSN", "postgres connection string, overrides the database.* fields", &c.Database.DSN)),
+		stringSetting("database.host", "DB_HOST", "postgres host", &c.Database.Host),
+		intSetting("database.port", "DB_PORT", "postgres port", &c.Database.Port),
+		stringSetting("database.user", "DB_USER", "postgres user", &c.Database.User),
+		secretSetting(stringSetting("database.password", "DB_PASSWORD", "postgres password", &c.Database.Password)),
+		stringSetting("database.name", "DB_NAME", "postgres database", &c.Database.Name),
+		stringSetting("database.sslmode", "DB_SSLMODE", "postgres sslmode", &c.Database.SSLMode),
+
+		listSetting("cors.allow_origins", "CORS_ALLOW_ORIGINS", "comma separated origins allowed to call the API", &c.CORS.AllowOrigins),
+
+		boolSetting("cookie.secure", "COOKIE_SECURE", "send cookies over HTTPS only", &c.Cookie.Secure),
+		stringSetting("cookie.same_site", "COOKIE_SAMESITE", "SameSite of the cookies: lax, strict or none", &c.Cookie.SameSite),
+		stringSetting("cookie.domain", "COOKIE_DOMAIN", "cookie domain, empty for the request host", &c.Cookie.Domain),
+
+		durationSetting("session.absolute_lifetime", "SESSION_ABSOLUTE_LIFETIME", "hard limit of a session from login", &c.Session.AbsoluteLifetime),
+		durationSetting("session.idle_timeout", "SESSION_IDLE_TIMEOUT", "session end after this long without requests", &c.Session.IdleTimeout),
+		durationSetting("session.sweep_interval", "SESSION_SWEEP_INTERVAL", "how often expired sessions are purged", &c.Session.SweepInterval),
+
+		intSetting("security.bcrypt_cost", "BCRYPT_COST", "bcrypt cost of password hashes", &c.Security.BcryptCost),
+		stringSetting("security.bootstrap_admin", "BOOTSTRAP_ADMIN", "existing username promoted to admin at startup while there is no admin", &c.Security.BootstrapAdmin),
+
+		secretSetting(stringSetting("tokens.signing_keys", "JWT_SIGNING_KEYS", "kid:secret pairs signing access tokens, token auth is off without them", &c.Tokens.SigningKeys)),
+		stringSetting("tokens.active_kid", "JWT_ACTIVE_KID", "kid of the key new tokens are signed with, the last one by default", &c.Tokens.ActiveKID),
+		durationSetting("tokens.access_ttl", "ACCESS_TOKEN_TTL", "lifetime of access tokens", &c.Tokens.AccessTTL),
+		durationSetting("tokens.refresh_ttl", "REFRESH_TOKEN_TTL", "lifetime of refresh tokens", &c.Tokens.RefreshTTL),
+
+		durationSetting("posts.publish_interval", "POST_PUBLISH_INTERVAL", "how often due scheduled posts are published", &c.Posts.PublishInterval),
+		durationSetting("posts.trash_retention", "POST_TRASH_RETENTION", "how long deleted posts stay in the trash", &c.Posts.TrashRetention),
+		durationSetting("posts.purge_interval", "POST_PURGE_INTERVAL", "how often expired trash is purged", &c.Posts.PurgeInterval),
+
+		stringSetting("uploads.storage", "UPLOAD_STORAGE", "where uploads are kept: local or s3", &c.Uploads.Storage),
+		stringSetting("uploads.dir", "UPLOAD_DIR", "directory of local upload storage", &c.Uploads.Dir),
+		stringSetting("uploads.s3.endpoint", "S3_ENDPOINT", "S3 host[:port]", &c.Uploads.S3.Endpoint),
+		stringSetting("uploads.s3.bucket", "S3_BUCKET", "S3 bucket", &c.Uploads.S3.Bucket),
+		secretSetting(stringSetting("uploads.s3.access_key", "S3_ACCESS_KEY", "S3 access key", &c.Uploads.S3.AccessKey)),
+		secretSetting(stringSetting("uploads.s3.secret_key", "S3_SECRET_KEY", "S3 secret key", &c.Uploads.S3.SecretKey)),
+		stringSetting("uploads.s3.region", "S3_REGION", "S3 region", &c.Uploads.S3.Region),
+		boolSetting("uploads.s3.use_ssl", "S3_USE_SSL", "reach S3 over HTTPS", &c.Uploads.S3.UseSSL),
+		int64Setting("uploads.max_size", "UPLOAD_MAX_SIZE", "largest accepted upload in bytes", &c.Uploads.MaxSize),
+		durationSetting("uploads.cleanup_interval", "UPLOAD_CLEANUP_INTERVAL", "how often unattached uploads are cleaned up", &c.Uploads.CleanupInterval),
+		durationSetting("uploads.orphan_ttl", "UPLOAD_ORPHAN_TTL", "age after which unattached uploads are removed", &c.Uploads.OrphanTTL),
+
+		stringSetting("audit.log_file", "AUDIT_LOG_FILE", "file the audit log is appended to, stdout when empty", &c.Audit.LogFile),
+
+		stringSetting("mail.file", "MAIL_FILE", "file mails are appended to, logged when empty", &c.Mail.File),
+		stringSetting("mail.password_reset_url", "PASSWORD_RESET_URL", "front-end page password reset links point at", &c.Mail.PasswordResetURL),
+	}
+}
+
+func stringSetting(key, env, usage string, dst *string) setting {
+	return setting{key: key, env: env, usage: usage,
+		set: func(raw string) error { *dst = raw; return nil },
+		get: func() string { return *dst },
+	}
+}
+
+func intSetting(key, env, usage string, dst *int) setting {
+	return setting{key: key, env: env, usage: usage,
+		set: func(raw string) error {
+			n, err := strconv.Atoi(raw)
+			if err != nil {
+				return fmt.Errorf("%q is not a number", raw)
+			}
+			*dst = n
+			return nil
+		},
+		get: func() string { return strconv.Itoa(*dst) },
+	}
+}
+
+func int64Setting(key, env, usage string, dst *int64) setting {
+	return setting{key: key, env: env, usage: usage,
+		set: func(raw string) error {
+			n, err := strconv.ParseInt(raw, 10, 64)
+			if err != nil {
+				return fmt.Errorf("%q is not a number", raw)
+			}
+			*dst = n
+			return nil
+		},
+		get: func() string { return strconv.FormatInt(*dst, 10) },
+	}
+}
+
+func boolSetting(key, env, usage string, dst *bool) setting {
+	return setting{key: key, env: env, usage: usage,
+		set: func(raw string) error {
+			b, err := strconv.ParseBool(raw)
+			if err != nil {
+				return fmt.Errorf("%q is not a boolean", raw)
+			}
+			*dst = b
+			return nil
+		},
+		get: func() string { return strconv.FormatBool(*dst) },
+	}
+}
+
+func durationSetting(key, env, usage string, dst *time.Duration) setting {
+	return setting{key: key, env: env, usage: usage,
+		set: func(raw string) error {
+			d, err := time.ParseDuration(raw)
+			if err != nil {
+				return fmt.Errorf("%q is not a duration like 12h or 30m", raw)
+			}
+			*dst = d
+			return nil
+		},
+		get: func() string { return dst.String() },
+	}
+}
+
+// comma separated in env and flags, a list or a string in the file
+func listSetting(key, env, usage string, dst *[]string) setting {
+	return setting{key: key, env: env, usage: usage,
+		set: func(raw string) error {
+			var list []string
+			for _, item := range strings.Split(raw, ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					list = append(list, item)
+				}
+			}
+			*dst = list
+			return nil
+		},
+		get: func() string { return strings.Join(*dst, ",") },
+	}
+}
+
+func secretSetting(s setting) setting {
+	s.secret = true
+	return s
+}
+
+//----------------------------------FILE------------------------------------------
+
+// loadFile applies a YAML (.yaml, .yml) or TOML (.toml) file, sections are
+// nested tables: database: {host: db.internal}
+func loadFile(path string, settings []setting) error {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	doc := map[string]interface{}{}
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(raw, &doc)
+	case ".toml":
+		err = toml.Unmarshal(raw, &doc)
+	default:
+		return fmt.Errorf("unknown format %q, use .yaml, .yml or .toml", ext)
+	}
+	if err != nil {
+		return err
+	}
+
+	values := map[string]string{}
+	if err := flatten("", doc, values); err != nil {
+		return err
+	}
+
+	byKey := make(map[string]setting, len(settings))
+	for _, s := range settings {
+		byKey[s.key] = s
+	}
+	for key, value := range values {
+		s, ok := byKey[key]
+		if !ok {
+			return fmt.Errorf("unknown setting %s", key)
+		}
+		if err := s.set(value); err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+// nested tables to "section.key" -> value as it would be written in env
+func flatten(prefix string, doc map[string]interface{}, out map[string]string) error {
+	for name, value := range doc {
+		key := name
+		if prefix != "" {
+			key = prefix + "." + name
+		}
+		switch v := value.(type) {
+		case map[string]interface{}:
+			if err := flatten(key, v, out); err != nil {
+				return err
+			}
+		case []interface{}:
+			items := make([]string, 0, len(v))
+			for _, item := range v {
+				items = append(items, fmt.Sprint(item))
+			}
+			out[key] = strings.Join(items, ",")
+		case nil:
+			return fmt.Errorf("%s has no value", key)
+		default:
+			out[key] = fmt.Sprint(v)
+		}
+	}
+	return nil
+}
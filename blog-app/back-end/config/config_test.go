@@ -0,0 +1,107 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testKeys = "old:0123456789abcdef0123456789abcdef,new:fedcba9876543210fedcba9876543210"
+
+func TestDefaultIsValid(t *testing.T) {
+	if err := Default().Validate(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// file < env < flags, nested sections in the file
+func TestLoadLayers(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	err := os.WriteFile(file, []byte(`
+uploads:
+  storage: s3
+  max_size: 1024
+  s3:
+    endpoint: minio:9000
+    bucket: blog
+    use_ssl: false
+posts:
+  trash_retention: 48h
+tokens:
+  signing_keys: "`+testKeys+`"
+`), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("UPLOAD_MAX_SIZE", "2048")
+	t.Setenv("JWT_ACTIVE_KID", "old")
+
+	cfg, _, err := Load([]string{"-config", file, "-posts.trash_retention=72h"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u := cfg.Uploads
+	if u.Storage != "s3" || u.S3.Endpoint != "minio:9000" || u.S3.Bucket != "blog" || u.S3.UseSSL || u.S3.Region != "us-east-1" {
+		t.Errorf("uploads %+v", u)
+	}
+	if u.MaxSize != 2048 {
+		t.Errorf("max size %d, want the env's 2048", u.MaxSize)
+	}
+	if cfg.Posts.TrashRetention != 72*time.Hour {
+		t.Errorf("trash retention %s, want the flag's 72h", cfg.Posts.TrashRetention)
+	}
+	if cfg.Tokens.SigningKeys != testKeys || cfg.Tokens.ActiveKID != "old" {
+		t.Errorf("tokens %+v", cfg.Tokens)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(c *Config)
+		want   string
+	}{
+		{"unknown storage", func(c *Config) { c.Uploads.Storage = "ftp" }, "uploads.storage"},
+		{"s3 without bucket", func(c *Config) { c.Uploads.Storage = "s3"; c.Uploads.S3.Endpoint = "minio:9000" }, "uploads.s3.bucket"},
+		{"no max size", func(c *Config) { c.Uploads.MaxSize = 0 }, "uploads.max_size"},
+		{"no orphan ttl", func(c *Config) { c.Uploads.OrphanTTL = -time.Hour }, "uploads durations"},
+		{"no publish interval", func(c *Config) { c.Posts.PublishInterval = 0 }, "posts durations"},
+		{"short signing key", func(c *Config) { c.Tokens.SigningKeys = "k:short" }, "tokens.signing_keys"},
+		{"unknown active kid", func(c *Config) { c.Tokens.SigningKeys = testKeys; c.Tokens.ActiveKID = "gone" }, "tokens.signing_keys"},
+		{"active kid without keys", func(c *Config) { c.Tokens.ActiveKID = "new" }, "tokens.active_kid"},
+		{"no refresh ttl", func(c *Config) { c.Tokens.RefreshTTL = 0 }, "tokens durations"},
+		{"relative reset url", func(c *Config) { c.Mail.PasswordResetURL = "/reset" }, "mail.password_reset_url"},
+		{"reset url with query", func(c *Config) { c.Mail.PasswordResetURL = "https://blog.example/reset?a=1" }, "mail.password_reset_url"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := Default()
+			tc.change(&cfg)
+			err := cfg.Validate()
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("got %v, want an error about %s", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestStringRedactsSecrets(t *testing.T) {
+	cfg := Default()
+	cfg.Database.Password = "db-secret"
+	cfg.Tokens.SigningKeys = testKeys
+	cfg.Uploads.S3.AccessKey = "s3-access"
+	cfg.Uploads.S3.SecretKey = "s3-secret"
+
+	out := cfg.String()
+	for _, secret := range []string{"db-secret", "0123456789abcdef", "s3-access", "s3-secret"} {
+		if strings.Contains(out, secret) {
+			t.Errorf("%q logged: %s", secret, out)
+		}
+	}
+	if !strings.Contains(out, "uploads.s3.secret_key=[redacted]") || !strings.Contains(out, "uploads.max_size=10485760") {
+		t.Errorf("settings missing: %s", out)
+	}
+}
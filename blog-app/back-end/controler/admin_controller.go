@@ -0,0 +1,77 @@
+package controler
+
+import (
+	"errors"
+	"gin-blog-app/apierr"
+	"gin-blog-app/audit"
+	"gin-blog-app/model"
+	"gin-blog-app/repository"
+	"gin-blog-app/service"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+//----------------------------------ADMIN------------------------------------------
+
+// list users with their roles
+func (h *Handler) ListUsersHandler(c *gin.Context) {
+	page, limit := pageParams(c, 50, 200)
+
+	users, total, err := h.Users.List(page, limit)
+	if err != nil {
+		apierr.Abort(c, http.StatusInternalServerError, "could not load users")
+		return
+	}
+
+	response := make([]gin.H, 0, len(users))
+	for _, u := range users {
+		response = append(response, gin.H{"id": u.ID, "username": u.Username, "role": u.Role})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"users": response, "page": page, "limit": limit, "total": total})
+
+}
+
+// assign a role to a user
+func (h *Handler) AssignRoleHandler(c *gin.Context) {
+	targetID, err := strconv.ParseUint(c.Param("userid"), 10, 64)
+	if err != nil {
+		apierr.Abort(c, http.StatusBadRequest, "invalid user ID")
+		return
+	}
+
+	var input model.RoleInput
+	if !apierr.BindJSON(c, &input) {
+		return
+	}
+
+	user, err := h.Users.AssignRole(uint(targetID), input.Role)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidRole):
+			apierr.Invalid(c, service.ErrInvalidRole.Field, service.ErrInvalidRole.Message)
+		case errors.Is(err, repository.ErrNotFound):
+			apierr.Abort(c, http.StatusNotFound, "user not found")
+		case errors.Is(err, service.ErrLastAdmin):
+			apierr.Abort(c, http.StatusConflict, err.Error())
+		default:
+			apierr.Abort(c, http.StatusInternalServerError, "could not update role")
+		}
+		return
+	}
+	h.Audit.Log(audit.Event{
+		Type:    "user.role_changed",
+		Subject: user.Username,
+		IP:      c.ClientIP(),
+		Details: map[string]interface{}{
+			"user_id": user.ID,
+			"role":    input.Role,
+			"by":      c.MustGet("userID").(uint),
+		},
+	})
+
+	c.JSON(http.StatusOK, gin.H{"id": user.ID, "username": user.Username, "role": input.Role})
+
+}
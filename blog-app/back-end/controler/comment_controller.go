@@ -0,0 +1,252 @@
+package controler
+
+import (
+	"errors"
+	"gin-blog-app/apierr"
+	"gin-blog-app/model"
+	"gin-blog-app/repository"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultCommentPageSize = 20
+	maxCommentPageSize     = 100
+	// replies listed with each thread, the rest are paged separately
+	repliesPerThread = 10
+)
+
+//----------------------------------COMMENT------------------------------------------
+
+// list comments of a post as nested threads
+// pagination applies to the top-level comments, each comes with the first
+// repliesPerThread replies of its thread and the thread's reply_count; the
+// rest are at /comment/:commentid/replies
+func (h *Handler) GetCommentsHandler(c *gin.Context) {
+	postID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		apierr.Abort(c, http.StatusBadRequest, "invalid post ID")
+		return
+	}
+
+	page, limit := pageParams(c, defaultCommentPageSize, maxCommentPageSize)
+
+	// comments are read on published posts only
+	if !h.publishedPost(c, uint(postID)) {
+		return
+	}
+
+	threads, err := h.Comments.Threads(uint(postID), (page-1)*limit, limit, repliesPerThread)
+	if err != nil {
+		apierr.Abort(c, http.StatusInternalServerError, "could not load comments")
+		return
+	}
+	total := threads.Total
+
+	c.JSON(http.StatusOK, gin.H{
+		"comments":    buildCommentTree(threads.Roots, threads.Replies, threads.Counts),
+		"page":        page,
+		"limit":       limit,
+		"total":       total,
+		"total_pages": (total + int64(limit) - 1) / int64(limit),
+	})
+
+}
+
+// replies of a thread, by the top-level comment, in creation order
+// the replies come flat with their parent_id, paginated like /comments
+func (h *Handler) GetRepliesHandler(c *gin.Context) {
+	commentID, err := strconv.ParseUint(c.Param("commentid"), 10, 64)
+	if err != nil {
+		apierr.Abort(c, http.StatusBadRequest, "invalid comment ID")
+		return
+	}
+
+	page, limit := pageParams(c, defaultCommentPageSize, maxCommentPageSize)
+
+	// a top-level comment on a post readers can see
+	root, err := h.Comments.FindByID(uint(commentID))
+	if err != nil || root.ParentID != nil {
+		apierr.Abort(c, http.StatusNotFound, "comment not found")
+		return
+	}
+	if _, err := h.Posts.Get(root.PostID, 0); err != nil {
+		apierr.Abort(c, http.StatusNotFound, "comment not found")
+		return
+	}
+
+	replies, total, err := h.Comments.Replies(root.ID, (page-1)*limit, limit)
+	if err != nil {
+		apierr.Abort(c, http.StatusInternalServerError, "could not load replies")
+		return
+	}
+
+	response := make([]*model.CommentResponse, 0, len(replies))
+	for _, r := range replies {
+		response = append(response, toCommentResponse(r))
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"replies":     response,
+		"page":        page,
+		"limit":       limit,
+		"total":       total,
+		"total_pages": (total + int64(limit) - 1) / int64(limit),
+	})
+
+}
+
+// create comment or reply
+func (h *Handler) CreateCommentHandler(c *gin.Context) {
+	postID, err := strconv.ParseUint(c.Param("postid"), 10, 64)
+	if err != nil {
+		apierr.Abort(c, http.StatusBadRequest, "invalid post ID")
+		return
+	}
+
+	var input model.CommentInput
+	if !apierr.BindJSON(c, &input) {
+		return
+	}
+
+	if !h.publishedPost(c, uint(postID)) {
+		return
+	}
+
+	comment := model.Comment{
+		Content:  strings.TrimSpace(input.Content),
+		PostID:   uint(postID),
+		AuthorID: c.MustGet("userID").(uint),
+	}
+
+	// reply: parent must live on the same post
+	if input.ParentID != nil {
+		parent, err := h.Comments.FindByID(*input.ParentID)
+		if err != nil || parent.PostID != comment.PostID {
+			apierr.Invalid(c, "parent_id", "is not a comment on this post")
+			return
+		}
+
+		rootID := parent.ID
+		if parent.RootID != nil {
+			rootID = *parent.RootID
+		}
+		comment.ParentID = &parent.ID
+		comment.RootID = &rootID
+	}
+
+	if err := h.Comments.Create(&comment); err != nil {
+		apierr.Abort(c, http.StatusInternalServerError, "could not save comment")
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"comment": toCommentResponse(comment)})
+
+}
+
+// edit comment (RequireCommentOwner puts the comment into context)
+func (h *Handler) UpdateCommentHandler(c *gin.Context) {
+	comment := c.MustGet("comment").(model.Comment)
+
+	var input struct {
+		Content string `json:"content" binding:"required,notblank,max=5000"`
+	}
+	if !apierr.BindJSON(c, &input) {
+		return
+	}
+
+	if err := h.Comments.UpdateContent(&comment, strings.TrimSpace(input.Content)); err != nil {
+		apierr.Abort(c, http.StatusInternalServerError, "could not update comment")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"updated": true, "comment": toCommentResponse(comment)})
+
+}
+
+// delete comment together with its replies
+func (h *Handler) DeleteCommentHandler(c *gin.Context) {
+	comment := c.MustGet("comment").(model.Comment)
+
+	if err := h.Comments.DeleteSubtree(comment); err != nil {
+		apierr.Abort(c, http.StatusInternalServerError, "could not delete comment")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "deleted successfully"})
+
+}
+
+//----------------------------------COMMENT---helpers------------------------------
+
+// page & limit query params with defaults and upper bound
+func pageParams(c *gin.Context, defaultLimit, maxLimit int) (int, int) {
+	page, err := strconv.Atoi(c.Query("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+
+	limit, err := strconv.Atoi(c.Query("limit"))
+	if err != nil || limit < 1 {
+		limit = defaultLimit
+	}
+	if limit > maxLimit {
+		limit = maxLimit
+	}
+
+	return page, limit
+}
+
+// whether a post is published, writes a 404 when it isn't
+func (h *Handler) publishedPost(c *gin.Context, postID uint) bool {
+	if _, err := h.Posts.Get(postID, 0); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			apierr.Abort(c, http.StatusNotFound, "post not found")
+			return false
+		}
+		apierr.Abort(c, http.StatusInternalServerError, "could not load post")
+		return false
+	}
+	return true
+}
+
+func toCommentResponse(comment model.Comment) *model.CommentResponse {
+	return &model.CommentResponse{
+		ID:        comment.ID,
+		Content:   comment.Content,
+		Author:    comment.Author.Username,
+		AuthorID:  comment.AuthorID,
+		ParentID:  comment.ParentID,
+		CreatedAt: comment.CreatedAt,
+		UpdatedAt: comment.UpdatedAt,
+		Replies:   []*model.CommentResponse{},
+	}
+}
+
+// nests replies under their parents, replies are expected in creation
+// order; counts are the replies per thread
+func buildCommentTree(roots, replies []model.Comment, counts map[uint]int64) []*model.CommentResponse {
+	byID := make(map[uint]*model.CommentResponse, len(roots)+len(replies))
+
+	tree := make([]*model.CommentResponse, 0, len(roots))
+	for _, r := range roots {
+		node := toCommentResponse(r)
+		count := counts[r.ID]
+		node.ReplyCount = &count
+		byID[r.ID] = node
+		tree = append(tree, node)
+	}
+
+	for _, r := range replies {
+		node := toCommentResponse(r)
+		byID[r.ID] = node
+		if parent, ok := byID[*r.ParentID]; ok {
+			parent.Replies = append(parent.Replies, node)
+		}
+	}
+
+	return tree
+}
@@ -1,18 +1,24 @@
 package controler
 
 import (
-	"gin-blog-app/database"
+	"errors"
+	"gin-blog-app/apierr"
 	"gin-blog-app/model"
+	"gin-blog-app/render"
+	"gin-blog-app/repository"
+	"gin-blog-app/service"
 	"gin-blog-app/utils"
 	"log"
+	"math"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
 // home page
-func HomeHandler(c *gin.Context) {
+func (h *Handler) HomeHandler(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "Home"})
 
 }
@@ -21,49 +27,23 @@ func HomeHandler(c *gin.Context) {
 
 // registration
 
-func RegistrationHandler(c *gin.Context) {
+func (h *Handler) RegistrationHandler(c *gin.Context) {
 
+	// length, charset & email format come from the binding tags
 	var newUser model.UserRegisterInput
-
-	if err := c.ShouldBindJSON(&newUser); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
-	}
-
-	// Validation
-	if len(newUser.Username) < 6 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Username must be at least 6 characters"})
+	if !apierr.BindJSON(c, &newUser) {
 		return
 	}
 
-	if len(newUser.Password) < 9 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Password must be at least 9 characters"})
-		return
-	}
-
-	// check the username already exist in DB
-	var existingUser model.User
-	if err := database.DB.Where("username = ?", newUser.Username).First(&existingUser).Error; err == nil {
-		c.JSON(http.StatusConflict, gin.H{"error": "Username alreay exists"})
-		return
-
-	}
-
-	//password hashing
-	hashedPassword, err := utils.GenerateHashedPassword(newUser.Password)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "password hashing failed"})
-		return
-	}
-
-	// add user into dp
-	user := model.User{
-		Username:       newUser.Username,
-		HashedPassword: hashedPassword,
-	}
-
-	if err := database.DB.Create(&user).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to register user"})
+	if _, err := h.Users.Register(newUser); err != nil {
+		switch {
+		case errors.Is(err, service.ErrEmailTaken):
+			apierr.AbortFields(c, http.StatusConflict, err.Error(), map[string]string{"email": "is already in use"})
+		case errors.Is(err, service.ErrUsernameTaken):
+			apierr.AbortFields(c, http.StatusConflict, err.Error(), map[string]string{"username": "is already taken"})
+		default:
+			apierr.Abort(c, http.StatusInternalServerError, "failed to register user")
+		}
 		return
 	}
 
@@ -72,24 +52,47 @@ func RegistrationHandler(c *gin.Context) {
 }
 
 // Login
-func LoginHandler(c *gin.Context) {
+func (h *Handler) LoginHandler(c *gin.Context) {
 
 	var loginUser model.UserLoginInput
-	if err := c.ShouldBindJSON(&loginUser); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !apierr.BindJSON(c, &loginUser) {
 		return
 	}
 
-	var user model.User
-	// find user by username
-	if err := database.DB.Where("username=?", loginUser.Username).First(&user).Error; err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid username"})
+	// brute-force protection, per account and per IP; the attempt is
+	// counted before the password is checked
+	attempt, wait := h.Limiter.Reserve(loginUser.Username, c.ClientIP())
+	if attempt == nil {
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		apierr.Abort(c, http.StatusTooManyRequests, "too many login attempts, try again later")
 		return
 	}
 
-	// Verify password
-	if !utils.CompareHashAndPassword(loginUser.Password, user.HashedPassword) {
-		c.JSON(http.StatusConflict, gin.H{"error": "Invalid password"})
+	user, err := h.Users.Authenticate(loginUser.Username, loginUser.Password)
+	if errors.Is(err, service.ErrInvalidCredentials) {
+		attempt.Failure()
+		apierr.Abort(c, http.StatusUnauthorized, err.Error())
+		return
+	}
+	if err != nil {
+		attempt.Release()
+		apierr.Abort(c, http.StatusInternalServerError, "could not log in")
+		return
+	}
+	attempt.Success()
+
+	// token clients get an access/refresh pair, no cookies
+	if loginUser.Mode == "token" {
+		if h.Tokens == nil {
+			apierr.Abort(c, http.StatusBadRequest, "token auth is not enabled")
+			return
+		}
+		pair, err := h.Tokens.Issue(user.ID)
+		if err != nil {
+			apierr.Abort(c, http.StatusInternalServerError, "Failed to issue tokens")
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"ID": user.ID, "username": user.Username, "tokens": pair})
 		return
 	}
 
@@ -97,43 +100,50 @@ func LoginHandler(c *gin.Context) {
 	sessionToken := utils.GenerateToken(32)
 	csrfToken := utils.GenerateToken(32)
 
-	// Update tokens on DB
-	if err := database.DB.Model(&user).Updates(map[string]interface{}{
-		"session_token": sessionToken,
-		"csrf_token":    csrfToken,
-	}).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update tokens"})
+	// new device session, other devices stay logged in
+	now := time.Now()
+	expiresAt := now.Add(h.Settings.Session.AbsoluteLifetime)
+	sess := model.Session{
+		UserID:        user.ID,
+		CSRFToken:     csrfToken,
+		UserAgent:     c.Request.UserAgent(),
+		IP:            c.ClientIP(),
+		LastSeenAt:    now,
+		ExpiresAt:     expiresAt,
+		IdleExpiresAt: h.Settings.Session.IdleDeadline(now, expiresAt),
+	}
+	if err := h.Sessions.Create(sessionToken, &sess); err != nil {
+		apierr.Abort(c, http.StatusInternalServerError, "Failed to create session")
 		return
 
 	}
 
 	//cookie
-	c.SetCookie("session_token", sessionToken, 3600*24, "/", "", false, true)
-	c.SetCookie("csrf_token", csrfToken, 3600*24, "/", "", false, false)
+	h.Settings.Session.SetCookies(c, sessionToken, csrfToken, sess.IdleExpiresAt)
 	c.JSON(http.StatusOK, gin.H{"ID": user.ID, "username": user.Username})
 
 }
 
-// Logout
-func LogoutHandler(c *gin.Context) {
+// Logout (current device only)
+func (h *Handler) LogoutHandler(c *gin.Context) {
 
 	sToken, err := c.Cookie("session_token")
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "no session found"})
+		apierr.Abort(c, http.StatusBadRequest, "no session found")
 		return
 	}
 
-	// update in db
-	if err := database.DB.Model(&model.User{}).Where("session_token = ?", sToken).Updates(map[string]interface{}{
-		"session_token": "",
-		"csrf_token":    "",
-	}).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to logout"})
+	// end this session
+	sess, err := h.Sessions.FindByToken(sToken)
+	if err == nil {
+		err = h.Sessions.Revoke(sess.UserID, sess.ID)
+	}
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		apierr.Abort(c, http.StatusInternalServerError, "failed to logout")
 		return
 	}
 
-	c.SetCookie("session_token", "", -1, "/", "", true, true)
-	c.SetCookie("csrf_token", "", -1, "/", "", true, true)
+	h.Settings.Session.ClearCookies(c)
 	c.JSON(http.StatusOK, gin.H{"message": "Logout successfull"})
 
 }
@@ -141,115 +151,249 @@ func LogoutHandler(c *gin.Context) {
 //----------------------------------POST------------------------------------------
 
 // creation
-func CreatePostHandler(c *gin.Context) {
-	var newPost model.Post
-	if err := c.ShouldBindJSON(&newPost); err != nil {
-		c.JSON(http.StatusConflict, gin.H{"error": "Invalid formate"})
+func (h *Handler) CreatePostHandler(c *gin.Context) {
+	var input model.PostInput
+	if !apierr.BindJSON(c, &input) {
 		return
 	}
 
-	autherID := c.MustGet("userID").(uint)
-
-	newPost.CreatedAt = time.Now()
-	newPost.AuthorID = autherID
-
-	if err := database.DB.Create(&newPost).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "cound upload right now"})
+	newPost, err := h.Posts.Create(c.MustGet("userID").(uint), input)
+	if err != nil {
+		postError(c, err, "cound upload right now")
 		return
 	}
 
+	c.Header("ETag", postETag(newPost, nil))
 	c.JSON(http.StatusOK, gin.H{"success": newPost})
 
 }
 
-// delete
-func DeletePostHandler(c *gin.Context) {
-	id := c.Param("postid")
+// delete, the post goes to its author's trash until purged
+func (h *Handler) DeletePostHandler(c *gin.Context) {
+	postID, ok := postIDParam(c, "postid")
+	if !ok {
+		return
+	}
 
-	//delete from db
-	if err := database.DB.Delete(&model.Post{}, id).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "could't delete from server"})
+	if err := h.Posts.Delete(actor(c), postID); err != nil {
+		postError(c, err, "could't delete from server")
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "deleted successfully"})
+	c.JSON(http.StatusOK, gin.H{"message": "moved to trash", "purge_at": time.Now().Add(h.Settings.TrashRetention)})
 
 }
 
 // update post
-func UpdatePostHandler(c *gin.Context) {
-	id := c.Param("postid")
-
-	// check the post in DB
-	var existingPost model.Post
-	if err := database.DB.First(&existingPost, id).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "post not found"})
+func (h *Handler) UpdatePostHandler(c *gin.Context) {
+	postID, ok := postIDParam(c, "postid")
+	if !ok {
 		return
+	}
 
+	// optimistic concurrency: the caller names the version it edited
+	ifMatch := c.GetHeader("If-Match")
+	if ifMatch == "" {
+		apierr.Abort(c, http.StatusPreconditionRequired, "If-Match with the post's ETag is required")
+		return
 	}
 
-	var updateData struct {
-		Title   string `json:"title"`
-		Content string `json:"content"`
+	var updateData model.UpdatePostInput
+	if !apierr.BindJSON(c, &updateData) {
+		return
 	}
 
-	if err := c.ShouldBindJSON(&updateData); err != nil {
-		c.JSON(http.StatusConflict, gin.H{"error": "Invalide request body"})
+	post, err := h.Posts.Update(actor(c), postID, updateData, ifMatchVersions(ifMatch))
+	if err != nil {
+		if errors.Is(err, repository.ErrVersionMismatch) {
+			c.Header("ETag", postETag(post, h.myReaction(c, postID)))
+			apierr.Abort(c, http.StatusPreconditionFailed, err.Error())
+			return
+		}
+		postError(c, err, "could not update post")
 		return
 	}
 
-	//update old post with new
-	if err := database.DB.Model(&existingPost).Updates(updateData).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"updated": false})
+	c.Header("ETag", postETag(post, h.myReaction(c, postID)))
+	c.JSON(http.StatusOK, gin.H{"updated": true, "post": post})
 
+}
+
+// post page handler
+// keyset pagination: ?limit=&cursor=, the response carries next_cursor
+// sorting: ?sort=newest|oldest|most_commented
+// filters: ?author=<username>&tag=<slug>&category=<slug>&from=&to= (RFC3339 or YYYY-MM-DD)
+func (h *Handler) PostPageHandler(c *gin.Context) {
+	params, err := parsePostListParams(c)
+	if err != nil {
+		apierr.Abort(c, http.StatusBadRequest, err.Error())
+		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"updated": true, "post": existingPost})
+	posts, nextCursor, err := h.listPosts(params)
+	if err != nil {
+		apierr.Abort(c, http.StatusInternalServerError, "could not load posts")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"posts": posts, "next_cursor": nextCursor})
 
 }
 
-// post page handler
-func PostPageHandler(c *gin.Context) {
-	var posts []model.Post
-	if err := database.DB.Find(&posts).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "not found anything"})
+// the logged-in user's own posts, drafts and scheduled ones included
+// same pagination & sorting as /posts, ?status= narrows the listing
+func (h *Handler) MyPostsHandler(c *gin.Context) {
+	params, err := parsePostListParams(c)
+	if err != nil {
+		apierr.Abort(c, http.StatusBadRequest, err.Error())
 		return
 	}
-	// var response
 
-	c.JSON(http.StatusOK, gin.H{"posts": posts})
+	params.OwnerID = c.MustGet("userID").(uint)
+	params.Status = c.Query("status")
+	switch params.Status {
+	case "", model.PostDraft, model.PostScheduled, model.PostPublished, model.PostArchived:
+	default:
+		apierr.Invalid(c, "status", service.ErrInvalidStatus.Message)
+		return
+	}
+
+	posts, nextCursor, err := h.listPosts(params)
+	if err != nil {
+		apierr.Abort(c, http.StatusInternalServerError, "could not load posts")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"posts": posts, "next_cursor": nextCursor})
 
 }
 
-func GetPostByID(c *gin.Context) {
+func (h *Handler) GetPostByID(c *gin.Context) {
 
-	id := c.Param("id")
+	postID, ok := postIDParam(c, "id")
+	if !ok {
+		return
+	}
 
-	var post model.Post
+	// content as markdown (source, default), sanitised html or plain text
+	format := c.DefaultQuery("format", "markdown")
+	if format != "markdown" && format != "html" && format != "text" {
+		apierr.Abort(c, http.StatusBadRequest, "format must be one of html, markdown, text")
+		return
+	}
+
+	// unpublished posts are only visible to their author
+	post, err := h.Posts.Get(postID, c.GetUint("userID"))
+	if err != nil {
+		postError(c, err, "could not load post")
+		return
+	}
 
-	if err := database.DB.First(&post, id).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "post not found"})
+	// caller's own reaction (OptionalAuth)
+	myReaction := h.myReaction(c, post.ID)
+
+	// the caller's copy is still current; the body depends on who asks, so
+	// shared caches must not serve it to someone else
+	etag := postETag(post, myReaction)
+	c.Header("ETag", etag)
+	c.Header("Cache-Control", "private")
+	c.Writer.Header().Add("Vary", "Cookie, Authorization")
+	if etagMatches(c.GetHeader("If-None-Match"), etag) {
+		c.Status(http.StatusNotModified)
 		return
 	}
 
 	//find the auther
-	var auther model.User
-	if err := database.DB.First(&auther, post.AuthorID).Error; err != nil {
+	auther, err := h.Users.Get(post.AuthorID)
+	if err != nil {
 		log.Println(post.AuthorID)
-		c.JSON(http.StatusNotFound, gin.H{"error": "post not found"})
+		apierr.Abort(c, http.StatusNotFound, "post not found")
 		return
 
 	}
 
 	//response
 	response := model.PostResponse{
-		ID:        post.ID,
-		Title:     post.Title,
-		Content:   post.Content,
-		Author:    auther.Username,
-		CreatedAt: post.CreatedAt,
-		UpdatedAt: post.UpdatedAt,
+		ID:           post.ID,
+		Title:        post.Title,
+		Content:      post.Content,
+		Excerpt:      post.Excerpt,
+		Format:       format,
+		Author:       auther.Username,
+		Tags:         tagSlugs(post.Tags),
+		Status:       post.Status,
+		PublishAt:    post.PublishAt,
+		LikeCount:    post.LikeCount,
+		DislikeCount: post.DislikeCount,
+		Version:      post.Version,
+		MyReaction:   myReaction,
+		CreatedAt:    post.CreatedAt,
+		UpdatedAt:    post.UpdatedAt,
+	}
+
+	if post.Category != nil {
+		response.Category = post.Category.Slug
+	}
+	uploads, err := h.postUploads(post.ID)
+	if err != nil {
+		apierr.Abort(c, http.StatusInternalServerError, "could not load attachments")
+		return
+	}
+	response.Uploads = uploads
+
+	switch format {
+	case "html":
+		response.Content = post.ContentHTML
+	case "text":
+		response.Content = render.Text(post.ContentHTML)
 	}
 	c.JSON(http.StatusOK, gin.H{"post": response})
 
 }
+
+//----------------------------------POST---helpers------------------------------
+
+// id from a post route param, writes a 400 when it isn't one
+func postIDParam(c *gin.Context, name string) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param(name), 10, 64)
+	if err != nil {
+		apierr.Abort(c, http.StatusBadRequest, "invalid post ID")
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// the logged-in caller, for service calls
+func actor(c *gin.Context) service.Actor {
+	return service.Actor{UserID: c.MustGet("userID").(uint), Role: c.GetString("userRole")}
+}
+
+// the caller's reaction to a post, nil for anonymous callers and when
+// there is none
+func (h *Handler) myReaction(c *gin.Context, postID uint) *string {
+	userID := c.GetUint("userID")
+	if userID == 0 {
+		return nil
+	}
+	reaction, err := h.Reactions.Find(userID, postID)
+	if err != nil {
+		return nil
+	}
+	return &reaction.Type
+}
+
+// answers a post service error: 422 on the field of rejected input, 404,
+// 403, or 500 with msg
+func postError(c *gin.Context, err error, msg string) {
+	var fieldErr *service.FieldError
+	switch {
+	case errors.As(err, &fieldErr):
+		apierr.Invalid(c, fieldErr.Field, fieldErr.Message)
+	case errors.Is(err, repository.ErrNotFound):
+		apierr.Abort(c, http.StatusNotFound, "post not found")
+	case errors.Is(err, service.ErrNotOwner):
+		apierr.Abort(c, http.StatusForbidden, err.Error())
+	default:
+		apierr.Abort(c, http.StatusInternalServerError, msg)
+	}
+}
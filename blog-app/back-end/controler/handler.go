@@ -0,0 +1,53 @@
+package controler
+
+import (
+	"gin-blog-app/audit"
+	"gin-blog-app/mailer"
+	"gin-blog-app/repository"
+	"gin-blog-app/service"
+	"gin-blog-app/session"
+	"gin-blog-app/storage"
+	"gin-blog-app/throttle"
+	"gin-blog-app/token"
+	"time"
+)
+
+// Settings are the handlers' share of the config
+type Settings struct {
+	Session session.Config
+	// how long a deleted post stays in the trash before the purge job
+	// removes it for good
+	TrashRetention time.Duration
+	// largest accepted file in bytes
+	MaxUploadSize int64
+	// front-end page of the reset link, the token is appended as ?token=
+	PasswordResetURL string
+}
+
+// Deps are what the handlers work with, wired up in main
+type Deps struct {
+	Users     *service.UserService
+	Posts     *service.PostService
+	Sessions  repository.SessionRepository
+	Comments  repository.CommentRepository
+	Reactions repository.ReactionRepository
+	Tags      repository.TagRepository
+	Uploads   repository.UploadRepository
+	Listings  repository.ListingRepository
+	Tokens    *token.Manager // nil when token auth is not enabled
+	Blobs     storage.BlobStore
+	Limiter   *throttle.LoginLimiter
+	Mailer    mailer.Mailer
+	Audit     audit.Logger
+
+	Settings Settings
+}
+
+// Handler serves the API, its methods are the gin handlers
+type Handler struct {
+	Deps
+}
+
+func New(deps Deps) *Handler {
+	return &Handler{Deps: deps}
+}
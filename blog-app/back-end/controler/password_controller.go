@@ -0,0 +1,138 @@
+package controler
+
+import (
+	"errors"
+	"gin-blog-app/apierr"
+	"gin-blog-app/mailer"
+	"gin-blog-app/model"
+	"gin-blog-app/repository"
+	"gin-blog-app/service"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+//----------------------------------PASSWORD------------------------------------------
+
+// change password of the logged-in user, every other session is ended
+func (h *Handler) ChangePasswordHandler(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+
+	var input model.ChangePasswordInput
+	if !apierr.BindJSON(c, &input) {
+		return
+	}
+
+	err := h.Users.ChangePassword(userID, input.OldPassword, input.NewPassword)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrWrongPassword):
+			apierr.AbortFields(c, http.StatusUnauthorized, err.Error(), map[string]string{"old_password": "is incorrect"})
+		case errors.Is(err, repository.ErrNotFound):
+			apierr.Abort(c, http.StatusNotFound, "user not found")
+		default:
+			apierr.Abort(c, http.StatusInternalServerError, "could not update password")
+		}
+		return
+	}
+
+	// keep this device logged in (session auth), end everything else
+	if sessionID := c.GetUint("sessionID"); sessionID != 0 {
+		err = h.Sessions.RevokeOthers(userID, sessionID)
+	} else {
+		err = h.Sessions.RevokeAll(userID)
+	}
+	if err == nil && h.Tokens != nil {
+		err = h.Tokens.RevokeAll(userID)
+	}
+	if err != nil {
+		log.Printf("password change: ending sessions of user %d failed: %v", userID, err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "password changed"})
+
+}
+
+// start password recovery, the answer never tells whether the email is known
+func (h *Handler) ForgotPasswordHandler(c *gin.Context) {
+	var input model.ForgotPasswordInput
+	if !apierr.BindJSON(c, &input) {
+		return
+	}
+
+	// every request counts, per email and per IP
+	attempt, wait := h.Limiter.ReserveReset(input.Email, c.ClientIP())
+	if attempt == nil {
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		apierr.Abort(c, http.StatusTooManyRequests, "too many password reset requests, try again later")
+		return
+	}
+	attempt.Failure()
+
+	// looked up, stored and mailed after answering, so a known email is
+	// answered as fast as an unknown one
+	go h.sendPasswordReset(input.Email)
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "if the account exists, a reset link has been sent"})
+
+}
+
+// set a new password with a reset token, ends every session of the user
+func (h *Handler) ResetPasswordHandler(c *gin.Context) {
+	var input model.ResetPasswordInput
+	if !apierr.BindJSON(c, &input) {
+		return
+	}
+
+	userID, err := h.Users.ResetPassword(input.Token, input.NewPassword)
+	if err != nil {
+		var fieldErr *service.FieldError
+		if errors.As(err, &fieldErr) {
+			apierr.Invalid(c, fieldErr.Field, fieldErr.Message)
+			return
+		}
+		apierr.Abort(c, http.StatusInternalServerError, "could not reset password")
+		return
+	}
+
+	err = h.Sessions.RevokeAll(userID)
+	if err == nil && h.Tokens != nil {
+		err = h.Tokens.RevokeAll(userID)
+	}
+	if err != nil {
+		log.Printf("password reset: ending sessions of user %d failed: %v", userID, err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "password has been reset"})
+
+}
+
+//----------------------------------PASSWORD---helpers------------------------------
+
+// issues a reset token for the account of an email, if there is one, and
+// mails the link; runs after the request has been answered
+func (h *Handler) sendPasswordReset(email string) {
+	user, resetToken, err := h.Users.StartPasswordReset(email)
+	if errors.Is(err, repository.ErrNotFound) {
+		return
+	}
+	if err != nil {
+		log.Printf("password reset: %v", err)
+		return
+	}
+
+	link := h.Settings.PasswordResetURL + "?token=" + url.QueryEscape(resetToken)
+	if err := h.Mailer.Send(mailer.Message{
+		To:      *user.Email,
+		Subject: "Reset your password",
+		Body: "Hi " + user.Username + ",\n\n" +
+			"use the link below to choose a new password, it expires in " + service.ResetTokenTTL.String() + ":\n\n" +
+			link + "\n\nIf you did not ask for this, ignore this email.",
+	}); err != nil {
+		log.Printf("password reset mail to user %d failed: %v", user.ID, err)
+	}
+}
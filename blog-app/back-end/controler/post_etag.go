@@ -0,0 +1,51 @@
+package controler
+
+import (
+	"gin-blog-app/model"
+	"strconv"
+	"strings"
+)
+
+// ETag of a post as served: "version.likes.dislikes", followed by
+// ".reaction" when the caller has reacted. Only the version counts for
+// If-Match, the rest keeps If-None-Match from answering 304 after a reaction.
+func postETag(post *model.Post, myReaction *string) string {
+	tag := strconv.FormatInt(post.Version, 10) + "." +
+		strconv.FormatInt(post.LikeCount, 10) + "." + strconv.FormatInt(post.DislikeCount, 10)
+	if myReaction != nil {
+		tag += "." + *myReaction
+	}
+	return `"` + tag + `"`
+}
+
+// If-None-Match against an ETag, weak comparison: W/ prefixes are ignored
+func etagMatches(header, etag string) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == "*" || tag == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// post versions an If-Match header accepts, nil for "*" (any version)
+// strong comparison: weak and malformed tags match no version
+func ifMatchVersions(header string) []int64 {
+	versions := []int64{}
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" {
+			return nil
+		}
+		raw, err := strconv.Unquote(tag)
+		if err != nil || !strings.HasPrefix(tag, `"`) {
+			continue
+		}
+		raw, _, _ = strings.Cut(raw, ".")
+		if v, err := strconv.ParseInt(raw, 10, 64); err == nil {
+			versions = append(versions, v)
+		}
+	}
+	return versions
+}
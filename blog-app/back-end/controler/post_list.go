@@ -0,0 +1,122 @@
+package controler
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"gin-blog-app/model"
+	"gin-blog-app/repository"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultPostPageSize = 20
+	maxPostPageSize     = 100
+)
+
+// postCursor is repository.ListCursor as sent to clients
+type postCursor struct {
+	Sort         string    `json:"s"`
+	SortAt       time.Time `json:"t"`
+	CommentCount int64     `json:"c,omitempty"`
+	ID           uint      `json:"id"`
+}
+
+func (pc postCursor) encode() string {
+	raw, _ := json.Marshal(pc)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func decodePostCursor(s string) (*repository.ListCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, errors.New("invalid cursor")
+	}
+	var pc postCursor
+	if err := json.Unmarshal(raw, &pc); err != nil || pc.ID == 0 {
+		return nil, errors.New("invalid cursor")
+	}
+	return (*repository.ListCursor)(&pc), nil
+}
+
+func parsePostListParams(c *gin.Context) (repository.ListParams, error) {
+	p := repository.ListParams{Limit: defaultPostPageSize, Sort: repository.SortNewest}
+
+	if raw := c.Query("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit < 1 {
+			return p, errors.New("limit must be a positive number")
+		}
+		if limit > maxPostPageSize {
+			limit = maxPostPageSize
+		}
+		p.Limit = limit
+	}
+
+	if raw := c.Query("sort"); raw != "" {
+		switch raw {
+		case repository.SortNewest, repository.SortOldest, repository.SortMostCommented:
+			p.Sort = raw
+		default:
+			return p, errors.New("sort must be one of newest, oldest, most_commented")
+		}
+	}
+
+	if raw := c.Query("cursor"); raw != "" {
+		cursor, err := decodePostCursor(raw)
+		if err != nil {
+			return p, err
+		}
+		if cursor.Sort != p.Sort {
+			return p, errors.New("cursor does not match the sort order")
+		}
+		p.After = cursor
+	}
+
+	p.ViewerID = c.GetUint("userID")
+	p.Author = strings.TrimSpace(c.Query("author"))
+	p.Tag = strings.TrimSpace(c.Query("tag"))
+	p.Category = strings.TrimSpace(c.Query("category"))
+
+	var err error
+	if p.From, err = parseDateParam(c.Query("from"), false); err != nil {
+		return p, errors.New("from must be RFC3339 or YYYY-MM-DD")
+	}
+	if p.To, err = parseDateParam(c.Query("to"), true); err != nil {
+		return p, errors.New("to must be RFC3339 or YYYY-MM-DD")
+	}
+
+	return p, nil
+}
+
+// RFC3339 timestamp or a plain date, a plain "to" date covers the whole day
+func parseDateParam(raw string, endOfDay bool) (*time.Time, error) {
+	if raw == "" {
+		return nil, nil
+	}
+	if t, err := time.Parse(time.RFC3339, raw); err == nil {
+		return &t, nil
+	}
+	t, err := time.Parse("2006-01-02", raw)
+	if err != nil {
+		return nil, err
+	}
+	if endOfDay {
+		t = t.AddDate(0, 0, 1).Add(-time.Nanosecond)
+	}
+	return &t, nil
+}
+
+// one page of a listing and the cursor of the next one, nil on the last
+func (h *Handler) listPosts(p repository.ListParams) ([]model.PostResponse, *string, error) {
+	posts, after, err := h.Listings.List(p)
+	if err != nil || after == nil {
+		return posts, nil, err
+	}
+	next := postCursor(*after).encode()
+	return posts, &next, nil
+}
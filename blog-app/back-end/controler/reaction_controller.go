@@ -0,0 +1,75 @@
+package controler
+
+import (
+	"errors"
+	"gin-blog-app/apierr"
+	"gin-blog-app/model"
+	"gin-blog-app/repository"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+//----------------------------------REACTIONS------------------------------------------
+
+// set (or switch) the caller's reaction on a post
+func (h *Handler) PutReactionHandler(c *gin.Context) {
+	postID, err := strconv.ParseUint(c.Param("postid"), 10, 64)
+	if err != nil {
+		apierr.Abort(c, http.StatusBadRequest, "invalid post ID")
+		return
+	}
+
+	// type is like or dislike, see the binding tag
+	var input model.ReactionInput
+	if !apierr.BindJSON(c, &input) {
+		return
+	}
+
+	counts, err := h.Reactions.Set(c.MustGet("userID").(uint), uint(postID), input.Type)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			apierr.Abort(c, http.StatusNotFound, "post not found")
+			return
+		}
+		apierr.Abort(c, http.StatusInternalServerError, "could not save reaction")
+		return
+	}
+
+	reactionResponse(c, uint(postID), &input.Type, counts)
+
+}
+
+// remove the caller's reaction from a post
+func (h *Handler) DeleteReactionHandler(c *gin.Context) {
+	postID, err := strconv.ParseUint(c.Param("postid"), 10, 64)
+	if err != nil {
+		apierr.Abort(c, http.StatusBadRequest, "invalid post ID")
+		return
+	}
+
+	counts, err := h.Reactions.Remove(c.MustGet("userID").(uint), uint(postID))
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			apierr.Abort(c, http.StatusNotFound, "post not found")
+			return
+		}
+		apierr.Abort(c, http.StatusInternalServerError, "could not remove reaction")
+		return
+	}
+
+	reactionResponse(c, uint(postID), nil, counts)
+
+}
+
+//----------------------------------REACTIONS---helpers------------------------------
+
+func reactionResponse(c *gin.Context, postID uint, reaction *string, counts repository.ReactionCounts) {
+	c.JSON(http.StatusOK, gin.H{
+		"post_id":       postID,
+		"my_reaction":   reaction,
+		"like_count":    counts.LikeCount,
+		"dislike_count": counts.DislikeCount,
+	})
+}
@@ -0,0 +1,199 @@
+package controler
+
+import (
+	"errors"
+	"fmt"
+	"gin-blog-app/apierr"
+	"gin-blog-app/model"
+	"gin-blog-app/repository"
+	"gin-blog-app/textdiff"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+//----------------------------------REVISIONS------------------------------------------
+
+// revision history of a post, newest first, without the content
+func (h *Handler) PostRevisionsHandler(c *gin.Context) {
+	post, ok := h.visiblePost(c)
+	if !ok {
+		return
+	}
+
+	list, err := h.Posts.Revisions(post.ID)
+	if err != nil {
+		apierr.Abort(c, http.StatusInternalServerError, "could not load revisions")
+		return
+	}
+	revisions := make([]model.PostRevisionResponse, 0, len(list))
+	for _, revision := range list {
+		revisions = append(revisions, toRevisionResponse(revision))
+	}
+
+	c.JSON(http.StatusOK, gin.H{"post_id": post.ID, "revisions": revisions})
+
+}
+
+// one revision with its content
+func (h *Handler) PostRevisionHandler(c *gin.Context) {
+	post, ok := h.visiblePost(c)
+	if !ok {
+		return
+	}
+
+	rev, err := strconv.Atoi(c.Param("rev"))
+	if err != nil || rev < 1 {
+		apierr.Abort(c, http.StatusBadRequest, "invalid revision")
+		return
+	}
+
+	revision, err := h.Posts.Revision(post.ID, rev)
+	if err != nil {
+		revisionError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"revision": toRevisionResponse(*revision)})
+
+}
+
+// unified diff between two revisions: ?from=&to=
+// to defaults to the latest revision, from to the one before to
+func (h *Handler) PostDiffHandler(c *gin.Context) {
+	post, ok := h.visiblePost(c)
+	if !ok {
+		return
+	}
+
+	to, err := revisionParam(c.Query("to"))
+	if err != nil {
+		apierr.Abort(c, http.StatusBadRequest, "to must be a revision number")
+		return
+	}
+	if to == 0 {
+		latest, err := h.Posts.LatestRevision(post.ID)
+		if err != nil {
+			revisionError(c, err)
+			return
+		}
+		to = latest.Rev
+	}
+
+	from, err := revisionParam(c.Query("from"))
+	if err != nil {
+		apierr.Abort(c, http.StatusBadRequest, "from must be a revision number")
+		return
+	}
+	if from == 0 {
+		from = max(to-1, 1)
+	}
+
+	older, err := h.Posts.Revision(post.ID, from)
+	if err != nil {
+		revisionError(c, err)
+		return
+	}
+	newer, err := h.Posts.Revision(post.ID, to)
+	if err != nil {
+		revisionError(c, err)
+		return
+	}
+
+	// title and content diffed like two files of a patch
+	diff := textdiff.Unified(
+		fmt.Sprintf("rev/%d/title", from), fmt.Sprintf("rev/%d/title", to), older.Title, newer.Title,
+	) + textdiff.Unified(
+		fmt.Sprintf("rev/%d/content", from), fmt.Sprintf("rev/%d/content", to), older.Content, newer.Content,
+	)
+
+	c.JSON(http.StatusOK, gin.H{"post_id": post.ID, "from": from, "to": to, "diff": diff})
+
+}
+
+// put an earlier revision back, recorded as a new revision (RequireOwner)
+// like an update it needs If-Match with the post's ETag
+func (h *Handler) RestoreRevisionHandler(c *gin.Context) {
+	postID, ok := postIDParam(c, "postid")
+	if !ok {
+		return
+	}
+	rev, err := strconv.Atoi(c.Param("rev"))
+	if err != nil || rev < 1 {
+		apierr.Abort(c, http.StatusBadRequest, "invalid revision")
+		return
+	}
+
+	ifMatch := c.GetHeader("If-Match")
+	if ifMatch == "" {
+		apierr.Abort(c, http.StatusPreconditionRequired, "If-Match with the post's ETag is required")
+		return
+	}
+
+	post, restored, err := h.Posts.RestoreRevision(actor(c), postID, rev, ifMatchVersions(ifMatch))
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrVersionMismatch):
+			c.Header("ETag", postETag(post, h.myReaction(c, postID)))
+			apierr.Abort(c, http.StatusPreconditionFailed, err.Error())
+		case errors.Is(err, repository.ErrNotFound):
+			revisionError(c, err)
+		default:
+			postError(c, err, "could not restore revision")
+		}
+		return
+	}
+
+	c.Header("ETag", postETag(post, h.myReaction(c, postID)))
+	c.JSON(http.StatusOK, gin.H{"restored": true, "post": post, "revision": toRevisionResponse(*restored)})
+
+}
+
+//----------------------------------REVISIONS---helpers------------------------------
+
+// post from the :id param if the caller may see it, writes a 400 or 404
+// otherwise (OptionalAuth)
+func (h *Handler) visiblePost(c *gin.Context) (model.Post, bool) {
+	postID, ok := postIDParam(c, "id")
+	if !ok {
+		return model.Post{}, false
+	}
+	post, err := h.Posts.Get(postID, c.GetUint("userID"))
+	if err != nil {
+		postError(c, err, "could not load post")
+		return model.Post{}, false
+	}
+	return *post, true
+}
+
+// optional revision number query param, 0 when missing
+func revisionParam(raw string) (int, error) {
+	if raw == "" {
+		return 0, nil
+	}
+	rev, err := strconv.Atoi(raw)
+	if err != nil || rev < 1 {
+		return 0, errors.New("invalid revision")
+	}
+	return rev, nil
+}
+
+func revisionError(c *gin.Context, err error) {
+	if errors.Is(err, repository.ErrNotFound) {
+		apierr.Abort(c, http.StatusNotFound, "revision not found")
+		return
+	}
+	apierr.Abort(c, http.StatusInternalServerError, "could not load revision")
+}
+
+func toRevisionResponse(revision model.PostRevision) model.PostRevisionResponse {
+	return model.PostRevisionResponse{
+		Rev:          revision.Rev,
+		Title:        revision.Title,
+		Content:      revision.Content,
+		Editor:       revision.Editor.Username,
+		RestoredFrom: revision.RestoredFrom,
+		CreatedAt:    revision.CreatedAt,
+	}
+}
@@ -0,0 +1,60 @@
+package controler
+
+import (
+	"gin-blog-app/apierr"
+	"gin-blog-app/repository"
+	"html"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const maxSearchQueryLength = 200
+
+//----------------------------------SEARCH------------------------------------------
+
+// full-text search over post titles and content
+// postgres uses the weighted tsvector index, other dialects fall back to a
+// case-insensitive LIKE (ILIKE) scan
+func (h *Handler) SearchPostsHandler(c *gin.Context) {
+	q := strings.TrimSpace(c.Query("q"))
+	if q == "" {
+		apierr.Abort(c, http.StatusBadRequest, "query parameter q is required")
+		return
+	}
+	if len(q) > maxSearchQueryLength {
+		apierr.Abort(c, http.StatusBadRequest, "search query is too long")
+		return
+	}
+
+	page, limit := pageParams(c, 20, 100)
+
+	results, total, err := h.Listings.Search(q, (page-1)*limit, limit)
+	if err != nil {
+		apierr.Abort(c, http.StatusInternalServerError, "search failed")
+		return
+	}
+
+	for i := range results {
+		results[i].TitleHighlight = markToHTML(results[i].TitleHighlight)
+		results[i].Snippet = markToHTML(results[i].Snippet)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"results": results,
+		"query":   q,
+		"page":    page,
+		"limit":   limit,
+		"total":   total,
+	})
+
+}
+
+//----------------------------------SEARCH---helpers------------------------------
+
+// HTML escapes text and turns the highlight markers into <mark> tags
+func markToHTML(s string) string {
+	s = html.EscapeString(s)
+	return strings.NewReplacer(repository.MarkStart, "<mark>", repository.MarkStop, "</mark>").Replace(s)
+}
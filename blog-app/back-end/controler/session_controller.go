@@ -0,0 +1,105 @@
+package controler
+
+import (
+	"errors"
+	"gin-blog-app/apierr"
+	"gin-blog-app/model"
+	"gin-blog-app/repository"
+	"gin-blog-app/utils"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+//----------------------------------SESSIONS------------------------------------------
+
+// list the active sessions (devices) of the logged-in user
+func (h *Handler) ListSessionsHandler(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+	currentID := c.GetUint("sessionID") // zero for token auth
+
+	sessions, err := h.Sessions.ListByUser(userID)
+	if err != nil {
+		apierr.Abort(c, http.StatusInternalServerError, "could not load sessions")
+		return
+	}
+
+	response := make([]gin.H, 0, len(sessions))
+	for _, s := range sessions {
+		response = append(response, gin.H{
+			"id":              s.ID,
+			"user_agent":      s.UserAgent,
+			"ip":              s.IP,
+			"created_at":      s.CreatedAt,
+			"last_seen_at":    s.LastSeenAt,
+			"expires_at":      s.ExpiresAt,
+			"idle_expires_at": s.IdleExpiresAt,
+			"current":         s.ID == currentID,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"sessions": response})
+
+}
+
+// revoke one session, revoking the current one logs this device out
+func (h *Handler) RevokeSessionHandler(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+
+	sessionID, err := strconv.ParseUint(c.Param("sessionid"), 10, 64)
+	if err != nil {
+		apierr.Abort(c, http.StatusBadRequest, "invalid session ID")
+		return
+	}
+
+	if err := h.Sessions.Revoke(userID, uint(sessionID)); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			apierr.Abort(c, http.StatusNotFound, "session not found")
+			return
+		}
+		apierr.Abort(c, http.StatusInternalServerError, "could not revoke session")
+		return
+	}
+
+	if uint(sessionID) == c.GetUint("sessionID") {
+		h.Settings.Session.ClearCookies(c)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "session revoked"})
+
+}
+
+// revoke every session of the user, this device included
+func (h *Handler) RevokeAllSessionsHandler(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+
+	if err := h.Sessions.RevokeAll(userID); err != nil {
+		apierr.Abort(c, http.StatusInternalServerError, "could not revoke sessions")
+		return
+	}
+
+	h.Settings.Session.ClearCookies(c)
+	c.JSON(http.StatusOK, gin.H{"message": "all sessions revoked"})
+
+}
+
+// issue a fresh csrf token for the current session
+func (h *Handler) RefreshCSRFHandler(c *gin.Context) {
+	value, _ := c.Get("session")
+	sess, ok := value.(*model.Session)
+	if !ok {
+		apierr.Abort(c, http.StatusBadRequest, "csrf tokens are only used with session cookies")
+		return
+	}
+
+	csrfToken := utils.GenerateToken(32)
+	if err := h.Sessions.RotateCSRF(sess.ID, csrfToken); err != nil {
+		apierr.Abort(c, http.StatusInternalServerError, "could not refresh csrf token")
+		return
+	}
+
+	h.Settings.Session.SetCSRFCookie(c, csrfToken, sess.IdleExpiresAt)
+	c.JSON(http.StatusOK, gin.H{"csrf_token": csrfToken})
+
+}
@@ -0,0 +1,110 @@
+package controler
+
+import (
+	"errors"
+	"gin-blog-app/apierr"
+	"gin-blog-app/model"
+	"gin-blog-app/repository"
+	"gin-blog-app/service"
+	"gin-blog-app/utils"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+//----------------------------------TAGS------------------------------------------
+
+// all tags with the number of published posts using them
+func (h *Handler) TagsHandler(c *gin.Context) {
+	tags, err := h.Tags.ListTags()
+	if err != nil {
+		apierr.Abort(c, http.StatusInternalServerError, "could not load tags")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"tags": tags})
+
+}
+
+// posts of one tag, same pagination & sorting as /posts
+func (h *Handler) TagPostsHandler(c *gin.Context) {
+	tag, err := h.Tags.FindTag(c.Param("slug"))
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			apierr.Abort(c, http.StatusNotFound, "tag not found")
+			return
+		}
+		apierr.Abort(c, http.StatusInternalServerError, "could not load tag")
+		return
+	}
+
+	params, err := parsePostListParams(c)
+	if err != nil {
+		apierr.Abort(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	params.Tag = tag.Slug
+
+	posts, nextCursor, err := h.listPosts(params)
+	if err != nil {
+		apierr.Abort(c, http.StatusInternalServerError, "could not load posts")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"tag": tag, "posts": posts, "next_cursor": nextCursor})
+
+}
+
+//----------------------------------CATEGORIES------------------------------------------
+
+// all categories with the number of published posts in them
+func (h *Handler) CategoriesHandler(c *gin.Context) {
+	categories, err := h.Tags.ListCategories()
+	if err != nil {
+		apierr.Abort(c, http.StatusInternalServerError, "could not load categories")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"categories": categories})
+
+}
+
+// create a category (admin)
+func (h *Handler) CreateCategoryHandler(c *gin.Context) {
+	var input model.CategoryInput
+	if !apierr.BindJSON(c, &input) {
+		return
+	}
+
+	name := strings.TrimSpace(input.Name)
+	slug := utils.Slugify(name)
+	if slug == "" || len(slug) > service.MaxSlugLength {
+		apierr.Invalid(c, "name", "needs letters or digits and at most 50 characters")
+		return
+	}
+
+	category := model.Category{Name: name, Slug: slug}
+	if err := h.Tags.CreateCategory(&category); err != nil {
+		if errors.Is(err, repository.ErrCategoryExists) {
+			apierr.AbortFields(c, http.StatusConflict, err.Error(), map[string]string{"name": "is already taken"})
+			return
+		}
+		apierr.Abort(c, http.StatusInternalServerError, "could not create category")
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"category": category})
+
+}
+
+//----------------------------------TAGS---helpers------------------------------
+
+// tag slugs of a loaded post
+func tagSlugs(tags []model.Tag) []string {
+	slugs := make([]string, 0, len(tags))
+	for _, t := range tags {
+		slugs = append(slugs, t.Slug)
+	}
+	return slugs
+}
@@ -0,0 +1,60 @@
+package controler
+
+import (
+	"errors"
+	"gin-blog-app/apierr"
+	"gin-blog-app/model"
+	"gin-blog-app/token"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+//----------------------------------TOKEN AUTH------------------------------------------
+
+// rotate a refresh token into a new access/refresh pair
+func (h *Handler) RefreshTokenHandler(c *gin.Context) {
+	if h.Tokens == nil {
+		apierr.Abort(c, http.StatusBadRequest, "token auth is not enabled")
+		return
+	}
+
+	var input model.RefreshTokenInput
+	if !apierr.BindJSON(c, &input) {
+		return
+	}
+
+	pair, err := h.Tokens.Refresh(input.RefreshToken)
+	if err != nil {
+		if errors.Is(err, token.ErrInvalid) || errors.Is(err, token.ErrReused) {
+			apierr.Abort(c, http.StatusUnauthorized, "invalid refresh token")
+			return
+		}
+		apierr.Abort(c, http.StatusInternalServerError, "could not refresh tokens")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"tokens": pair})
+
+}
+
+// revoke the token family of a refresh token (logout for token clients)
+func (h *Handler) RevokeTokenHandler(c *gin.Context) {
+	if h.Tokens == nil {
+		apierr.Abort(c, http.StatusBadRequest, "token auth is not enabled")
+		return
+	}
+
+	var input model.RefreshTokenInput
+	if !apierr.BindJSON(c, &input) {
+		return
+	}
+
+	if err := h.Tokens.Revoke(input.RefreshToken); err != nil {
+		apierr.Abort(c, http.StatusInternalServerError, "could not revoke token")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "token revoked"})
+
+}
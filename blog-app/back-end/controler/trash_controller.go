@@ -0,0 +1,61 @@
+package controler
+
+import (
+	"errors"
+	"gin-blog-app/apierr"
+	"gin-blog-app/repository"
+	"gin-blog-app/service"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+//----------------------------------TRASH------------------------------------------
+
+// the logged-in user's deleted posts, most recently deleted first
+func (h *Handler) TrashHandler(c *gin.Context) {
+	page, limit := pageParams(c, defaultPostPageSize, maxPostPageSize)
+
+	posts, total, err := h.Listings.Trash(c.MustGet("userID").(uint), (page-1)*limit, limit)
+	if err != nil {
+		apierr.Abort(c, http.StatusInternalServerError, "could not load trash")
+		return
+	}
+	for i := range posts {
+		posts[i].PurgeAt = posts[i].DeletedAt.Add(h.Settings.TrashRetention)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"posts":       posts,
+		"page":        page,
+		"limit":       limit,
+		"total":       total,
+		"total_pages": (total + int64(limit) - 1) / int64(limit),
+	})
+
+}
+
+// take a post out of the trash
+// its author and whoever may delete any post are allowed
+func (h *Handler) RestorePostHandler(c *gin.Context) {
+	postID, ok := postIDParam(c, "postid")
+	if !ok {
+		return
+	}
+
+	post, err := h.Posts.Restore(actor(c), postID)
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrNotFound):
+			apierr.Abort(c, http.StatusNotFound, "post not found in trash")
+		case errors.Is(err, service.ErrNotOwner):
+			apierr.Abort(c, http.StatusForbidden, "not allowed to restore this post")
+		default:
+			apierr.Abort(c, http.StatusInternalServerError, "could not restore post")
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"restored": true, "post": post})
+
+}
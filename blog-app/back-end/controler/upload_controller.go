@@ -0,0 +1,312 @@
+package controler
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"gin-blog-app/apierr"
+	"gin-blog-app/media"
+	"gin-blog-app/model"
+	"gin-blog-app/storage"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+)
+
+// accepted content types, sniffed from the file itself
+var uploadTypes = map[string]bool{
+	"image/jpeg":      true,
+	"image/png":       true,
+	"image/gif":       true,
+	"image/webp":      true,
+	"application/pdf": true,
+	"text/plain":      true,
+}
+
+const maxFilenameLength = 255
+
+//----------------------------------UPLOADS------------------------------------------
+
+// multipart upload of one file in the "file" field
+// the content is stored once per SHA256, images get a thumbnail
+func (h *Handler) UploadHandler(c *gin.Context) {
+	// multipart framing on top of the file
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, h.Settings.MaxUploadSize+1<<20)
+
+	header, err := c.FormFile("file")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			apierr.Abort(c, http.StatusRequestEntityTooLarge, "file is too large")
+			return
+		}
+		apierr.Abort(c, http.StatusBadRequest, "multipart field file is required")
+		return
+	}
+	if header.Size > h.Settings.MaxUploadSize {
+		apierr.Abort(c, http.StatusRequestEntityTooLarge, "file is too large")
+		return
+	}
+	if header.Size == 0 {
+		apierr.Abort(c, http.StatusBadRequest, "file is empty")
+		return
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		apierr.Abort(c, http.StatusBadRequest, "could not read file")
+		return
+	}
+	defer file.Close()
+
+	contentType, sum, err := inspectUpload(file)
+	if err != nil {
+		apierr.Abort(c, http.StatusBadRequest, "could not read file")
+		return
+	}
+	if !uploadTypes[contentType] {
+		apierr.Abort(c, http.StatusUnsupportedMediaType, "unsupported file type "+contentType)
+		return
+	}
+
+	upload := model.Upload{
+		OwnerID:     c.MustGet("userID").(uint),
+		Filename:    cleanFilename(header.Filename),
+		ContentType: contentType,
+		Size:        header.Size,
+		SHA256:      sum,
+		BlobKey:     "blobs/" + sum[:2] + "/" + sum,
+	}
+
+	// images must decode, their size goes with the upload
+	isImage := strings.HasPrefix(contentType, "image/")
+	if isImage {
+		if upload.Width, upload.Height, err = media.Dimensions(file); err != nil {
+			apierr.Abort(c, http.StatusBadRequest, "invalid image")
+			return
+		}
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			apierr.Abort(c, http.StatusBadRequest, "could not read file")
+			return
+		}
+	}
+
+	ctx := c.Request.Context()
+
+	// same content uploaded before: reuse the blob; the cleanup job deletes
+	// blobs under the same lock, so a reused blob can't go before the row
+	// referencing it is written
+	err = h.Uploads.Create(&upload, func() error {
+		exists, err := h.Blobs.Exists(ctx, upload.BlobKey)
+		if err == nil && !exists {
+			err = h.Blobs.Put(ctx, upload.BlobKey, file, header.Size, contentType)
+		}
+		if err != nil {
+			return err
+		}
+
+		if isImage {
+			h.storeThumbnail(c, file, &upload)
+		}
+		return nil
+	})
+	if err != nil {
+		log.Println("upload:", err)
+		apierr.Abort(c, http.StatusInternalServerError, "could not store file")
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"upload": toUploadResponse(upload)})
+
+}
+
+// file content of an upload
+func (h *Handler) GetUploadHandler(c *gin.Context) {
+	h.serveUpload(c, false)
+}
+
+// thumbnail of an image upload
+func (h *Handler) GetUploadThumbnailHandler(c *gin.Context) {
+	h.serveUpload(c, true)
+}
+
+//----------------------------------UPLOADS---helpers------------------------------
+
+// sniffed content type and hex SHA256 of a file, rewinds it afterwards
+func inspectUpload(file multipart.File) (string, string, error) {
+	head := make([]byte, 512)
+	n, err := io.ReadFull(file, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return "", "", err
+	}
+	contentType, _, _ := strings.Cut(http.DetectContentType(head[:n]), ";")
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return "", "", err
+	}
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", "", err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return "", "", err
+	}
+
+	return contentType, hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// stores the thumbnail of an image upload (once per content)
+// failures only cost the thumbnail, the upload itself is fine
+func (h *Handler) storeThumbnail(c *gin.Context, file multipart.File, upload *model.Upload) {
+	ctx := c.Request.Context()
+	key := "thumbs/" + upload.SHA256[:2] + "/" + upload.SHA256
+	if exists, err := h.Blobs.Exists(ctx, key); err == nil && exists {
+		upload.ThumbKey = &key
+		return
+	}
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		log.Println("upload thumbnail:", err)
+		return
+	}
+	thumb, err := media.Thumbnail(file, upload.ContentType)
+	if err != nil {
+		// too large to decode is expected, no thumbnail then
+		if !errors.Is(err, media.ErrTooLarge) {
+			log.Println("upload thumbnail:", err)
+		}
+		return
+	}
+
+	thumbType := media.ThumbnailType(upload.ContentType)
+	if err := h.Blobs.Put(ctx, key, bytes.NewReader(thumb), int64(len(thumb)), thumbType); err != nil {
+		log.Println("upload thumbnail:", err)
+		return
+	}
+	upload.ThumbKey = &key
+}
+
+// streams an upload (or its thumbnail) to the caller
+// uploads are visible to their owner and, once attached, to whoever can see
+// the post
+func (h *Handler) serveUpload(c *gin.Context, thumbnail bool) {
+	// parsed first, gorm runs a string primary key as raw SQL
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		apierr.Abort(c, http.StatusBadRequest, "invalid upload ID")
+		return
+	}
+
+	upload, err := h.Uploads.FindByID(uint(id))
+	if err != nil || !h.uploadVisible(c, *upload) {
+		apierr.Abort(c, http.StatusNotFound, "upload not found")
+		return
+	}
+
+	key, contentType, size := upload.BlobKey, upload.ContentType, upload.Size
+	if thumbnail {
+		if upload.ThumbKey == nil {
+			apierr.Abort(c, http.StatusNotFound, "upload has no thumbnail")
+			return
+		}
+		key, size = *upload.ThumbKey, -1
+		contentType = media.ThumbnailType(upload.ContentType)
+	}
+
+	blob, err := h.Blobs.Get(c.Request.Context(), key)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			apierr.Abort(c, http.StatusNotFound, "upload not found")
+			return
+		}
+		apierr.Abort(c, http.StatusInternalServerError, "could not load upload")
+		return
+	}
+	defer blob.Close()
+
+	// only images are shown inline, everything else is downloaded
+	disposition := "attachment"
+	if strings.HasPrefix(contentType, "image/") {
+		disposition = "inline"
+	}
+
+	c.DataFromReader(http.StatusOK, size, contentType, blob, map[string]string{
+		"Content-Disposition":    mime.FormatMediaType(disposition, map[string]string{"filename": upload.Filename}),
+		"X-Content-Type-Options": "nosniff",
+		"Cache-Control":          "private, max-age=86400",
+	})
+}
+
+func (h *Handler) uploadVisible(c *gin.Context, upload model.Upload) bool {
+	if upload.OwnerID == c.GetUint("userID") {
+		return true
+	}
+	if upload.PostID == nil {
+		return false
+	}
+	_, err := h.Posts.Get(*upload.PostID, c.GetUint("userID"))
+	return err == nil
+}
+
+// attachments of a post for its response
+func (h *Handler) postUploads(postID uint) ([]model.UploadResponse, error) {
+	uploads, err := h.Uploads.ListByPost(postID)
+	if err != nil {
+		return nil, err
+	}
+
+	responses := make([]model.UploadResponse, 0, len(uploads))
+	for _, u := range uploads {
+		responses = append(responses, toUploadResponse(u))
+	}
+	return responses, nil
+}
+
+func toUploadResponse(upload model.Upload) model.UploadResponse {
+	response := model.UploadResponse{
+		ID:          upload.ID,
+		Filename:    upload.Filename,
+		ContentType: upload.ContentType,
+		Size:        upload.Size,
+		SHA256:      upload.SHA256,
+		URL:         "/uploads/" + strconv.FormatUint(uint64(upload.ID), 10),
+		Width:       upload.Width,
+		Height:      upload.Height,
+		PostID:      upload.PostID,
+		CreatedAt:   upload.CreatedAt,
+	}
+	if upload.ThumbKey != nil {
+		response.ThumbnailURL = response.URL + "/thumbnail"
+	}
+	return response
+}
+
+// base name of a client supplied file name, without control characters
+func cleanFilename(name string) string {
+	name = filepath.Base(strings.ReplaceAll(name, `\`, "/"))
+	name = strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f {
+			return -1
+		}
+		return r
+	}, strings.ToValidUTF8(name, ""))
+
+	// cut on a rune boundary
+	for len(name) > maxFilenameLength {
+		_, size := utf8.DecodeLastRuneInString(name)
+		name = name[:len(name)-size]
+	}
+	if name == "" || name == "." || name == "/" {
+		name = "upload"
+	}
+	return name
+}
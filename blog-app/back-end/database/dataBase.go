@@ -1,31 +1,48 @@
 package database
 
 import (
-	"gin-blog-app/model"
+	"context"
+	"gin-blog-app/migrations"
 	"log"
 
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 )
 
-var DB *gorm.DB
+// PostSearchVector is the weighted tsvector of a post, title ranks above content.
+// Queries must use the same expression as the GIN index (migrations/postgres)
+// for the index to apply.
+const PostSearchVector = "setweight(to_tsvector('english', coalesce(title, '')), 'A') || " +
+	"setweight(to_tsvector('english', coalesce(content, '')), 'B')"
 
-func InitDB() {
+// InitDB connects to postgres (dsn from config.Database.ConnString) and
+// applies pending migrations
+func InitDB(dsn string) *gorm.DB {
 
-	var err error
-
-	cst := "user=ak dbname=blog password=4455@mint sslmode=disable"
-
-	DB, err = gorm.Open(postgres.Open(cst), &gorm.Config{})
+	db, err := Open(dsn)
 
 	if err != nil {
 		log.Fatal("Database connection failed: ", err)
 	}
 
-	if err := DB.AutoMigrate(&model.User{}, &model.Post{}); err != nil {
-		log.Fatal("Database migration are failed")
+	// pending schema migrations, see the migrations package
+	migrator, err := migrations.New(db)
+	if err != nil {
+		log.Fatal("Database migrations: ", err)
+	}
+	applied, err := migrator.Up(context.Background())
+	if err != nil {
+		log.Fatal("Database migration failed: ", err)
+	}
+	for _, m := range applied {
+		log.Printf("Applied migration %04d_%s", m.Version, m.Name)
 	}
 	log.Println("Connected into DB ")
+	return db
 
 }
 
+// Open connects to postgres without migrating (the migrate command)
+func Open(dsn string) (*gorm.DB, error) {
+	return gorm.Open(postgres.Open(dsn), &gorm.Config{})
+}
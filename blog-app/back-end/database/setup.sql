@@ -1,60 +0,0 @@
-
-
-
---create database 
-
--- CREATE DATABASE blog OWNER ak;
-
-
-
---user table
-CREATE TABLE users(
-    id SERIAL PRIMARY KEY,
-    username VARCHAR(100) UNIQUE NOT NULL,
-    hashed_password Text NOT NULL,
-    session_token TEXT,
-    csrf_token Text,
-    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-);
-
-
-
--- POST TABLE
-CREATE TABLE posts(
-    id SERIAL PRIMARY KEY,
-    title VARCHAR(255) NOT NULL,
-    content TEXT NOT NULL,
-    author_id  INT REFERENCES users(id) ON DELETE CASCADE,
-    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-);
-
-
-
--- COMMENTS TABLE
-
-CREATE TABLE comments(
-    id SERIAL PRIMARY KEY,
-    content TEXT NOT NULL,
-    author_id INT REFERENCES users(id) ON DELETE CASCADE,
-    post_id INT REFERENCES posts(id) ON DELETE CASCADE,
-    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-);
-
---migrated file lokks like this
-CREATE TABLE users (
-  id SERIAL PRIMARY KEY,
-  username TEXT UNIQUE,
-  hashed_password TEXT,
-  session_token TEXT UNIQUE,
-  csrf_token TEXT
-);
-
-CREATE TABLE posts (
-  id SERIAL PRIMARY KEY,
-  title TEXT,
-  content TEXT,
-  author_id INTEGER REFERENCES users(id) ON UPDATE CASCADE ON DELETE SET NULL,
-  created_at TIMESTAMP,
-  updated_at TIMESTAMP
-);
@@ -0,0 +1,443 @@
+package e2e
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// createPost publishes a post as c and returns its id
+func createPost(t *testing.T, c *client, title string) uint {
+	t.Helper()
+
+	res := c.mustDo(t, http.StatusOK, "POST", "/user/create", map[string]string{"title": title, "content": "# " + title})
+	var body struct {
+		Success struct {
+			ID uint `json:"id"`
+		} `json:"success"`
+	}
+	res.decode(t, &body)
+	return body.Success.ID
+}
+
+// postBody checks the fields of a GET /post/:id response
+func postBody(title string, version int64) func(t *testing.T, res *response) {
+	return func(t *testing.T, res *response) {
+		var body struct {
+			Post struct {
+				Title   string `json:"title"`
+				Author  string `json:"author"`
+				Version int64  `json:"version"`
+			} `json:"post"`
+		}
+		res.decode(t, &body)
+		if body.Post.Title != title || body.Post.Version != version {
+			t.Errorf("got title %q version %d, want %q version %d", body.Post.Title, body.Post.Version, title, version)
+		}
+	}
+}
+
+func etag(want string) func(t *testing.T, res *response) {
+	return func(t *testing.T, res *response) {
+		if got := res.Header.Get("ETag"); got != want {
+			t.Errorf("ETag %s, want %s", got, want)
+		}
+	}
+}
+
+func TestPostLifecycle(t *testing.T) {
+	srv := newServer(t)
+	alice := srv.client(t)
+
+	runCases(t, srv, []apiCase{
+		{name: "register", client: alice, method: "POST", path: "/register",
+			body: map[string]string{"username": "alice1", "password": testPassword}, status: http.StatusCreated},
+		{name: "login", client: alice, method: "POST", path: "/login",
+			body: map[string]string{"username": "alice1", "password": testPassword}, status: http.StatusOK},
+		{name: "create", client: alice, method: "POST", path: "/user/create",
+			body: map[string]string{"title": "First", "content": "hello"}, status: http.StatusOK, check: etag(`"1.0.0"`)},
+		{name: "read", method: "GET", path: "/post/1", status: http.StatusOK, check: postBody("First", 1)},
+		{name: "update", client: alice, method: "PATCH", path: "/user/update/1", header: []string{"If-Match", `"1"`},
+			body: map[string]string{"title": "Second"}, status: http.StatusOK, check: etag(`"2.0.0"`)},
+		{name: "read updated", method: "GET", path: "/post/1", status: http.StatusOK, check: postBody("Second", 2)},
+		{name: "stale update", client: alice, method: "PATCH", path: "/user/update/1", header: []string{"If-Match", `"1"`},
+			body: map[string]string{"title": "Third"}, status: http.StatusPreconditionFailed, check: etag(`"2.0.0"`)},
+		{name: "delete", client: alice, method: "DELETE", path: "/user/delete/1", status: http.StatusOK},
+		{name: "read deleted", method: "GET", path: "/post/1", status: http.StatusNotFound},
+		{name: "restore", client: alice, method: "POST", path: "/user/trash/1/restore", status: http.StatusOK},
+		{name: "read restored", method: "GET", path: "/post/1", status: http.StatusOK, check: postBody("Second", 2)},
+	})
+}
+
+func TestPostValidation(t *testing.T) {
+	srv := newServer(t)
+	alice := srv.user(t, "alice1")
+	id := createPost(t, alice, "First")
+	update := fmt.Sprintf("/user/update/%d", id)
+
+	runCases(t, srv, []apiCase{
+		{name: "missing title", client: alice, method: "POST", path: "/user/create",
+			body: map[string]string{"content": "hello"}, status: http.StatusUnprocessableEntity, fields: []string{"title"}},
+		{name: "unknown field", client: alice, method: "POST", path: "/user/create",
+			body: map[string]string{"title": "t", "colour": "red"}, status: http.StatusUnprocessableEntity, fields: []string{"colour"}},
+		{name: "unknown category", client: alice, method: "POST", path: "/user/create",
+			body: map[string]string{"title": "t", "content": "c", "category": "nope"}, status: http.StatusUnprocessableEntity, fields: []string{"category"}},
+		{name: "malformed json", client: alice, method: "POST", path: "/user/create",
+			body: `{"title":`, status: http.StatusBadRequest},
+		{name: "empty title", client: alice, method: "PATCH", path: update, header: []string{"If-Match", "*"},
+			body: map[string]string{"title": " "}, status: http.StatusUnprocessableEntity, fields: []string{"title"}},
+		{name: "no if-match", client: alice, method: "PATCH", path: update,
+			body: map[string]string{"title": "t"}, status: http.StatusPreconditionRequired},
+	})
+}
+
+func TestAccessErrors(t *testing.T) {
+	srv := newServer(t)
+	alice := srv.user(t, "alice1")
+	bob := srv.user(t, "bob123")
+	id := createPost(t, alice, "Alice's")
+	post := fmt.Sprintf("/post/%d", id)
+	update := fmt.Sprintf("/user/update/%d", id)
+	remove := fmt.Sprintf("/user/delete/%d", id)
+
+	runCases(t, srv, []apiCase{
+		// authentication
+		{name: "create without cookie", method: "POST", path: "/user/create",
+			body: map[string]string{"title": "t"}, status: http.StatusUnauthorized},
+		{name: "delete without cookie", method: "DELETE", path: remove, status: http.StatusUnauthorized},
+		{name: "wrong password", method: "POST", path: "/login",
+			body: map[string]string{"username": "alice1", "password": "not-the-password"}, status: http.StatusUnauthorized},
+		{name: "duplicate username", method: "POST", path: "/register",
+			body: map[string]string{"username": "alice1", "password": testPassword}, status: http.StatusConflict},
+
+		// ownership
+		{name: "non-owner edit", client: bob, method: "PATCH", path: update, header: []string{"If-Match", "*"},
+			body: map[string]string{"title": "mine now"}, status: http.StatusForbidden},
+		{name: "non-owner delete", client: bob, method: "DELETE", path: remove, status: http.StatusForbidden},
+		{name: "untouched", method: "GET", path: post, status: http.StatusOK, check: postBody("Alice's", 1)},
+
+		// post ids
+		{name: "read invalid id", method: "GET", path: "/post/abc", status: http.StatusBadRequest},
+		{name: "edit invalid id", client: alice, method: "PATCH", path: "/user/update/abc", header: []string{"If-Match", "*"},
+			body: map[string]string{"title": "t"}, status: http.StatusBadRequest},
+		{name: "delete invalid id", client: alice, method: "DELETE", path: "/user/delete/abc", status: http.StatusBadRequest},
+		{name: "read missing", method: "GET", path: "/post/999", status: http.StatusNotFound},
+		{name: "delete missing", client: alice, method: "DELETE", path: "/user/delete/999", status: http.StatusNotFound},
+	})
+}
+
+// a logged-in client still needs the csrf token on writes
+func TestCSRF(t *testing.T) {
+	srv := newServer(t)
+	alice := srv.user(t, "alice1")
+
+	runCases(t, srv, []apiCase{
+		{name: "wrong token", client: alice, method: "POST", path: "/user/create", header: []string{"X-CSRF-Token", "forged"},
+			body: map[string]string{"title": "t"}, status: http.StatusForbidden},
+		{name: "right token", client: alice, method: "POST", path: "/user/create",
+			body: map[string]string{"title": "t", "content": "c"}, status: http.StatusOK},
+	})
+}
+
+func TestProbes(t *testing.T) {
+	srv := newServer(t)
+
+	runCases(t, srv, []apiCase{
+		{name: "live", method: "GET", path: "/healthz", status: http.StatusOK},
+		{name: "ready", method: "GET", path: "/readyz", status: http.StatusOK},
+	})
+
+	// a migration of this binary that the database lacks
+	if err := srv.DB.Exec("DELETE FROM schema_migrations WHERE version = (SELECT MAX(version) FROM schema_migrations)").Error; err != nil {
+		t.Fatal(err)
+	}
+	runCases(t, srv, []apiCase{
+		{name: "pending migration", method: "GET", path: "/readyz", status: http.StatusServiceUnavailable,
+			check: func(t *testing.T, res *response) {
+				var body struct {
+					Migrations struct {
+						Pending []string `json:"pending"`
+					} `json:"migrations"`
+				}
+				res.decode(t, &body)
+				if len(body.Migrations.Pending) != 1 {
+					t.Errorf("pending %v, want one migration", body.Migrations.Pending)
+				}
+			}},
+		{name: "still live", method: "GET", path: "/healthz", status: http.StatusOK},
+	})
+}
+
+// upload ids are parsed before they reach a query
+func TestUploadIDs(t *testing.T) {
+	srv := newServer(t)
+	injection := "/uploads/1%20AND%20(SELECT%20substr(hashed_password,1,4)%20FROM%20users%20WHERE%20id=1)='$2a$'"
+	srv.user(t, "alice1")
+
+	runCases(t, srv, []apiCase{
+		{name: "not a number", method: "GET", path: "/uploads/abc", status: http.StatusBadRequest},
+		{name: "sql in the id", method: "GET", path: injection, status: http.StatusBadRequest},
+		{name: "sql in the thumbnail id", method: "GET", path: injection + "/thumbnail", status: http.StatusBadRequest},
+		{name: "missing", method: "GET", path: "/uploads/999", status: http.StatusNotFound},
+	})
+}
+
+// bcrypt takes at most 72 bytes, 40 "é" are 40 characters but 80 bytes
+func TestPasswordBytes(t *testing.T) {
+	srv := newServer(t)
+	alice := srv.user(t, "alice1")
+	long := strings.Repeat("é", 40)
+
+	runCases(t, srv, []apiCase{
+		{name: "register", method: "POST", path: "/register",
+			body: map[string]string{"username": "bob123", "password": long}, status: http.StatusUnprocessableEntity, fields: []string{"password"}},
+		{name: "change", client: alice, method: "POST", path: "/user/password",
+			body: map[string]string{"old_password": testPassword, "new_password": long}, status: http.StatusUnprocessableEntity, fields: []string{"new_password"}},
+		{name: "reset", method: "POST", path: "/password/reset",
+			body: map[string]string{"token": "x", "new_password": long}, status: http.StatusUnprocessableEntity, fields: []string{"new_password"}},
+		{name: "72 bytes", method: "POST", path: "/register",
+			body: map[string]string{"username": "bob123", "password": strings.Repeat("é", 36)}, status: http.StatusCreated},
+	})
+}
+
+// the ETag of a read covers the counters and the reader's own reaction
+func TestPostETag(t *testing.T) {
+	srv := newServer(t)
+	alice := srv.user(t, "alice1")
+	bob := srv.user(t, "bob123")
+	id := createPost(t, alice, "First")
+	post := fmt.Sprintf("/post/%d", id)
+	reaction := fmt.Sprintf("/user/post/%d/reaction", id)
+
+	runCases(t, srv, []apiCase{
+		{name: "read", client: bob, method: "GET", path: post, status: http.StatusOK, check: func(t *testing.T, res *response) {
+			etag(`"1.0.0"`)(t, res)
+			if cc := res.Header.Get("Cache-Control"); cc != "private" {
+				t.Errorf("Cache-Control %q, want private", cc)
+			}
+		}},
+		{name: "unchanged", client: bob, method: "GET", path: post, header: []string{"If-None-Match", `"1.0.0"`}, status: http.StatusNotModified},
+		{name: "react", client: bob, method: "PUT", path: reaction, body: map[string]string{"type": "like"}, status: http.StatusOK},
+		{name: "reacted", client: bob, method: "GET", path: post, header: []string{"If-None-Match", `"1.0.0"`}, status: http.StatusOK,
+			check: etag(`"1.1.0.like"`)},
+		{name: "others see the count", client: alice, method: "GET", path: post, header: []string{"If-None-Match", `"1.1.0.like"`}, status: http.StatusOK,
+			check: etag(`"1.1.0"`)},
+		{name: "if-match by version", client: alice, method: "PATCH", path: fmt.Sprintf("/user/update/%d", id),
+			header: []string{"If-Match", `"1.1.0"`}, body: map[string]string{"title": "Second"}, status: http.StatusOK},
+	})
+}
+
+// a patch only changes the fields it names, whatever version it was made on
+func TestPostMergePatch(t *testing.T) {
+	srv := newServer(t)
+	alice := srv.user(t, "alice1")
+	id := createPost(t, alice, "First")
+	post := fmt.Sprintf("/post/%d", id)
+	update := fmt.Sprintf("/user/update/%d", id)
+
+	runCases(t, srv, []apiCase{
+		{name: "title", client: alice, method: "PATCH", path: update, header: []string{"If-Match", "*"},
+			body: map[string]string{"title": "Second"}, status: http.StatusOK},
+		{name: "content", client: alice, method: "PATCH", path: update, header: []string{"If-Match", "*"},
+			body: map[string]string{"content": "new content"}, status: http.StatusOK},
+		{name: "draft", client: alice, method: "PATCH", path: update, header: []string{"If-Match", "*"},
+			body: map[string]string{"status": "draft"}, status: http.StatusOK},
+		{name: "all kept", client: alice, method: "GET", path: post, status: http.StatusOK, check: func(t *testing.T, res *response) {
+			var body struct {
+				Post struct {
+					Title   string `json:"title"`
+					Content string `json:"content"`
+					Status  string `json:"status"`
+					Version int64  `json:"version"`
+				} `json:"post"`
+			}
+			res.decode(t, &body)
+			if p := body.Post; p.Title != "Second" || p.Content != "new content" || p.Status != "draft" || p.Version != 4 {
+				t.Errorf("got %+v", p)
+			}
+		}},
+	})
+}
+
+// the forgot answer is the same for any email, the mailed token resets once
+// and the endpoint is throttled per email
+func TestPasswordReset(t *testing.T) {
+	srv := newServer(t)
+	srv.client(t).mustDo(t, http.StatusCreated, "POST", "/register",
+		map[string]string{"username": "alice1", "password": testPassword, "email": "alice@example.com"})
+
+	var resetToken string
+	runCases(t, srv, []apiCase{
+		{name: "unknown email", method: "POST", path: "/password/forgot", body: map[string]string{"email": "bob@example.com"}, status: http.StatusAccepted},
+		{name: "known email", method: "POST", path: "/password/forgot", body: map[string]string{"email": "alice@example.com"}, status: http.StatusAccepted,
+			check: func(t *testing.T, res *response) {
+				// the unknown email got none
+				msg := srv.Mails.wait(t, 1)
+				link, err := url.Parse(strings.Fields(msg.Body[strings.Index(msg.Body, "http"):])[0])
+				if err != nil || msg.To != "alice@example.com" {
+					t.Fatalf("mail %+v: %v", msg, err)
+				}
+				resetToken = link.Query().Get("token")
+			}},
+		{name: "bad token", method: "POST", path: "/password/reset", body: map[string]string{"token": "guess", "new_password": "new-password"},
+			status: http.StatusUnprocessableEntity, fields: []string{"token"}},
+	})
+	runCases(t, srv, []apiCase{
+		{name: "reset", method: "POST", path: "/password/reset", body: map[string]string{"token": resetToken, "new_password": "new-password"},
+			status: http.StatusOK},
+		{name: "spent token", method: "POST", path: "/password/reset", body: map[string]string{"token": resetToken, "new_password": "other-password"},
+			status: http.StatusUnprocessableEntity, fields: []string{"token"}},
+		{name: "new password", method: "POST", path: "/login", body: map[string]string{"username": "alice1", "password": "new-password"},
+			status: http.StatusOK},
+	})
+
+	// a few requests in a row, then the email has to wait
+	for i := 0; i < 3; i++ {
+		srv.client(t).mustDo(t, http.StatusAccepted, "POST", "/password/forgot", map[string]string{"email": "alice@example.com"})
+	}
+	res := srv.client(t).mustDo(t, http.StatusTooManyRequests, "POST", "/password/forgot", map[string]string{"email": "Alice@example.com"})
+	if res.Header.Get("Retry-After") == "" {
+		t.Error("no Retry-After")
+	}
+}
+
+// restoring a revision is an update: it needs a current If-Match and moves
+// updated_at
+func TestRestoreRevision(t *testing.T) {
+	srv := newServer(t)
+	alice := srv.user(t, "alice1")
+	bob := srv.user(t, "bob123")
+	id := createPost(t, alice, "First")
+	alice.mustDo(t, http.StatusOK, "PATCH", fmt.Sprintf("/user/update/%d", id), map[string]string{"title": "Second"}, "If-Match", "*")
+	bob.mustDo(t, http.StatusOK, "PUT", fmt.Sprintf("/user/post/%d/reaction", id), map[string]string{"type": "like"})
+	restore := fmt.Sprintf("/user/post/%d/revisions/1/restore", id)
+
+	// updated_at of the post as read
+	updatedAt := func(t *testing.T) string {
+		var body struct {
+			Post struct {
+				UpdatedAt string `json:"updated_at"`
+			} `json:"post"`
+		}
+		alice.mustDo(t, http.StatusOK, "GET", fmt.Sprintf("/post/%d", id), nil).decode(t, &body)
+		return body.Post.UpdatedAt
+	}
+	before := updatedAt(t)
+
+	runCases(t, srv, []apiCase{
+		{name: "no if-match", client: alice, method: "POST", path: restore, status: http.StatusPreconditionRequired},
+		{name: "stale", client: alice, method: "POST", path: restore, header: []string{"If-Match", `"1"`},
+			status: http.StatusPreconditionFailed, check: etag(`"2.1.0"`)},
+		{name: "unknown revision", client: alice, method: "POST", path: fmt.Sprintf("/user/post/%d/revisions/9/restore", id),
+			header: []string{"If-Match", "*"}, status: http.StatusNotFound},
+		{name: "not owner", client: bob, method: "POST", path: restore, header: []string{"If-Match", "*"}, status: http.StatusForbidden},
+		{name: "restore", client: alice, method: "POST", path: restore, header: []string{"If-Match", `"2.1.0"`},
+			status: http.StatusOK, check: func(t *testing.T, res *response) {
+				etag(`"3.1.0"`)(t, res)
+				var body struct {
+					Post struct {
+						Title string `json:"title"`
+					} `json:"post"`
+					Revision struct {
+						Rev          int  `json:"rev"`
+						RestoredFrom *int `json:"restored_from"`
+					} `json:"revision"`
+				}
+				res.decode(t, &body)
+				if body.Post.Title != "First" || body.Revision.Rev != 3 || body.Revision.RestoredFrom == nil || *body.Revision.RestoredFrom != 1 {
+					t.Errorf("got %+v", body)
+				}
+			}},
+		{name: "read", client: bob, method: "GET", path: fmt.Sprintf("/post/%d", id), status: http.StatusOK, check: etag(`"3.1.0.like"`)},
+	})
+
+	if after := updatedAt(t); after == before {
+		t.Errorf("updated_at not moved by the restore: %s", after)
+	}
+}
+
+// posts, and what hangs off them, go with their author
+func TestDeleteAuthor(t *testing.T) {
+	srv := newServer(t)
+	alice := srv.user(t, "alice1")
+	bob := srv.user(t, "bob123")
+	id := createPost(t, alice, "Alice's")
+	kept := createPost(t, bob, "Bob's")
+	bob.mustDo(t, http.StatusCreated, "POST", fmt.Sprintf("/user/post/%d/comments", id), map[string]string{"content": "hi"})
+
+	if err := srv.DB.Exec("DELETE FROM users WHERE username = ?", "alice1").Error; err != nil {
+		t.Fatal(err)
+	}
+
+	runCases(t, srv, []apiCase{
+		{name: "post gone", method: "GET", path: fmt.Sprintf("/post/%d", id), status: http.StatusNotFound},
+		{name: "others kept", method: "GET", path: fmt.Sprintf("/post/%d", kept), status: http.StatusOK},
+		{name: "listing loads", method: "GET", path: "/posts", status: http.StatusOK},
+	})
+
+	var comments int64
+	srv.DB.Table("comments").Where("post_id = ?", id).Count(&comments)
+	if comments != 0 {
+		t.Errorf("%d comments of the deleted post kept", comments)
+	}
+}
+
+// public listings go by publish time, a draft published last is the newest
+func TestListingPublishOrder(t *testing.T) {
+	srv := newServer(t)
+	alice := srv.user(t, "alice1")
+	alice.mustDo(t, http.StatusOK, "POST", "/user/create", map[string]string{"title": "Early", "content": "x", "status": "draft"})
+	createPost(t, alice, "Middle")
+	createPost(t, alice, "Late")
+	alice.mustDo(t, http.StatusOK, "PATCH", "/user/update/1", map[string]string{"status": "published"}, "If-Match", "*")
+
+	// titles of every page, following next_cursor
+	titles := func(query string) string {
+		var got []string
+		path := "/posts?limit=2&" + query
+		for {
+			var body struct {
+				Posts []struct {
+					Title string `json:"title"`
+				} `json:"posts"`
+				NextCursor *string `json:"next_cursor"`
+			}
+			srv.client(t).mustDo(t, http.StatusOK, "GET", path, nil).decode(t, &body)
+			for _, p := range body.Posts {
+				got = append(got, p.Title)
+			}
+			if body.NextCursor == nil {
+				return strings.Join(got, ",")
+			}
+			path = "/posts?limit=2&" + query + "&cursor=" + *body.NextCursor
+		}
+	}
+
+	if got := titles("sort=newest"); got != "Early,Late,Middle" {
+		t.Errorf("newest: %s", got)
+	}
+	if got := titles("sort=oldest"); got != "Middle,Late,Early" {
+		t.Errorf("oldest: %s", got)
+	}
+}
+
+// X-Forwarded-For is only believed from trusted proxies, none here
+func TestForwardedForIgnored(t *testing.T) {
+	srv := newServer(t)
+	alice := srv.client(t)
+	alice.mustDo(t, http.StatusCreated, "POST", "/register", map[string]string{"username": "alice1", "password": testPassword})
+	alice.mustDo(t, http.StatusOK, "POST", "/login", map[string]string{"username": "alice1", "password": testPassword},
+		"X-Forwarded-For", "203.0.113.9")
+
+	var body struct {
+		Sessions []struct {
+			IP string `json:"ip"`
+		} `json:"sessions"`
+	}
+	alice.mustDo(t, http.StatusOK, "GET", "/user/sessions", nil).decode(t, &body)
+	if len(body.Sessions) != 1 || body.Sessions[0].IP != "127.0.0.1" {
+		t.Errorf("sessions %+v, want the peer address", body.Sessions)
+	}
+}
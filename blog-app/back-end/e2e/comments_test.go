@@ -0,0 +1,179 @@
+package e2e
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// thread is a comment as listed, with its replies nested
+type thread struct {
+	ID         uint      `json:"id"`
+	Content    string    `json:"content"`
+	ParentID   *uint     `json:"parent_id"`
+	ReplyCount *int64    `json:"reply_count"`
+	Replies    []*thread `json:"replies"`
+}
+
+// comment posts content on a post as c, as a reply when parent is not zero,
+// and returns its id
+func comment(t *testing.T, c *client, postID, parent uint, content string) uint {
+	t.Helper()
+
+	body := map[string]interface{}{"content": content}
+	if parent != 0 {
+		body["parent_id"] = parent
+	}
+	var out struct {
+		Comment struct {
+			ID uint `json:"id"`
+		} `json:"comment"`
+	}
+	c.mustDo(t, http.StatusCreated, "POST", fmt.Sprintf("/user/post/%d/comments", postID), body).decode(t, &out)
+	return out.Comment.ID
+}
+
+// listed threads of a post
+func threads(t *testing.T, srv *testServer, postID uint) []*thread {
+	t.Helper()
+
+	var body struct {
+		Comments []*thread `json:"comments"`
+	}
+	srv.client(t).mustDo(t, http.StatusOK, "GET", fmt.Sprintf("/post/%d/comments", postID), nil).decode(t, &body)
+	return body.Comments
+}
+
+// contents of a thread depth first, replies in brackets
+func outline(nodes []*thread) string {
+	parts := make([]string, 0, len(nodes))
+	for _, n := range nodes {
+		part := n.Content
+		if len(n.Replies) > 0 {
+			part += "[" + outline(n.Replies) + "]"
+		}
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, ",")
+}
+
+// replies nest under their parent, whatever the depth
+func TestCommentThreads(t *testing.T) {
+	srv := newServer(t)
+	alice := srv.user(t, "alice1")
+	bob := srv.user(t, "bob123")
+	id := createPost(t, alice, "First")
+
+	first := comment(t, bob, id, 0, "a")
+	second := comment(t, alice, id, 0, "b")
+	reply := comment(t, alice, id, first, "a1")
+	comment(t, bob, id, reply, "a1x")
+	comment(t, bob, id, first, "a2")
+	comment(t, bob, id, second, "b1")
+
+	list := threads(t, srv, id)
+	if got := outline(list); got != "a[a1[a1x],a2],b[b1]" {
+		t.Errorf("threads %s", got)
+	}
+	if len(list) == 2 && (list[0].ReplyCount == nil || *list[0].ReplyCount != 3 || *list[1].ReplyCount != 1) {
+		t.Errorf("reply counts %v, %v", list[0].ReplyCount, list[1].ReplyCount)
+	}
+}
+
+// a reply names a comment on the same post
+func TestCommentParent(t *testing.T) {
+	srv := newServer(t)
+	alice := srv.user(t, "alice1")
+	id := createPost(t, alice, "First")
+	other := createPost(t, alice, "Second")
+	elsewhere := comment(t, alice, other, 0, "elsewhere")
+	path := fmt.Sprintf("/user/post/%d/comments", id)
+
+	runCases(t, srv, []apiCase{
+		{name: "other post", client: alice, method: "POST", path: path,
+			body: map[string]interface{}{"content": "x", "parent_id": elsewhere}, status: http.StatusUnprocessableEntity, fields: []string{"parent_id"}},
+		{name: "unknown", client: alice, method: "POST", path: path,
+			body: map[string]interface{}{"content": "x", "parent_id": 99}, status: http.StatusUnprocessableEntity, fields: []string{"parent_id"}},
+		{name: "top-level", client: alice, method: "POST", path: path,
+			body: map[string]interface{}{"content": "x"}, status: http.StatusCreated},
+	})
+}
+
+// a thread lists its first replies, the rest are paged by the replies endpoint
+func TestCommentReplies(t *testing.T) {
+	srv := newServer(t)
+	alice := srv.user(t, "alice1")
+	id := createPost(t, alice, "First")
+	root := comment(t, alice, id, 0, "root")
+	parent := root
+	for i := 1; i <= 12; i++ {
+		parent = comment(t, alice, id, parent, fmt.Sprintf("r%d", i))
+	}
+
+	list := threads(t, srv, id)
+	want := "root[r1[r2[r3[r4[r5[r6[r7[r8[r9[r10]]]]]]]]]]"
+	if got := outline(list); got != want || *list[0].ReplyCount != 12 {
+		t.Errorf("threads %s, reply count %d", got, *list[0].ReplyCount)
+	}
+
+	// contents of a page of replies
+	page := func(query string) string {
+		var body struct {
+			Replies []thread `json:"replies"`
+			Total   int64    `json:"total"`
+		}
+		srv.client(t).mustDo(t, http.StatusOK, "GET", fmt.Sprintf("/comment/%d/replies?%s", root, query), nil).decode(t, &body)
+		got := make([]string, 0, len(body.Replies))
+		for _, r := range body.Replies {
+			got = append(got, r.Content)
+		}
+		return fmt.Sprintf("%s/%d", strings.Join(got, ","), body.Total)
+	}
+	if got := page("limit=5&page=3"); got != "r11,r12/12" {
+		t.Errorf("last page %s", got)
+	}
+	if got := page("limit=2"); got != "r1,r2/12" {
+		t.Errorf("first page %s", got)
+	}
+
+	runCases(t, srv, []apiCase{
+		{name: "of a reply", method: "GET", path: fmt.Sprintf("/comment/%d/replies", parent), status: http.StatusNotFound},
+		{name: "unknown", method: "GET", path: "/comment/99/replies", status: http.StatusNotFound},
+		{name: "draft post", client: alice, method: "PATCH", path: fmt.Sprintf("/user/update/%d", id),
+			header: []string{"If-Match", "*"}, body: map[string]string{"status": "draft"}, status: http.StatusOK},
+		{name: "of a hidden post", method: "GET", path: fmt.Sprintf("/comment/%d/replies", root), status: http.StatusNotFound},
+	})
+}
+
+// deleting a comment takes the replies below it, not its siblings
+func TestDeleteCommentSubtree(t *testing.T) {
+	srv := newServer(t)
+	alice := srv.user(t, "alice1")
+	bob := srv.user(t, "bob123")
+	id := createPost(t, alice, "First")
+
+	root := comment(t, bob, id, 0, "a")
+	reply := comment(t, bob, id, root, "a1")
+	comment(t, bob, id, reply, "a1x")
+	comment(t, bob, id, root, "a2")
+	comment(t, bob, id, 0, "b")
+
+	runCases(t, srv, []apiCase{
+		{name: "stranger", client: srv.user(t, "carol1"), method: "DELETE", path: fmt.Sprintf("/user/comment/%d", reply), status: http.StatusForbidden},
+		{name: "post author", client: alice, method: "DELETE", path: fmt.Sprintf("/user/comment/%d", reply), status: http.StatusOK},
+	})
+	if got := outline(threads(t, srv, id)); got != "a[a2],b" {
+		t.Errorf("after deleting a reply: %s", got)
+	}
+
+	bob.mustDo(t, http.StatusOK, "DELETE", fmt.Sprintf("/user/comment/%d", root), nil)
+	if got := outline(threads(t, srv, id)); got != "b" {
+		t.Errorf("after deleting a thread: %s", got)
+	}
+	var left int64
+	srv.DB.Table("comments").Where("post_id = ?", id).Count(&left)
+	if left != 1 {
+		t.Errorf("%d comments left, want 1", left)
+	}
+}
@@ -0,0 +1,336 @@
+// Package e2e drives the HTTP API end to end: the real router, middleware,
+// handlers, services and repositories against an in-memory SQLite database
+// with the migrations applied.
+//
+// A new endpoint gets tests by listing cases, they run in order against one
+// server so earlier cases can set up state for later ones:
+//
+//	srv := newServer(t)
+//	alice := srv.user(t, "alice1")
+//	runCases(t, srv, []apiCase{
+//		{name: "create", client: alice, method: "POST", path: "/user/create",
+//			body: map[string]any{"title": "t", "content": "c"}, status: http.StatusOK},
+//		{name: "anonymous", method: "POST", path: "/user/create", status: http.StatusUnauthorized},
+//	})
+package e2e
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"gin-blog-app/audit"
+	"gin-blog-app/config"
+	"gin-blog-app/controler"
+	"gin-blog-app/mailer"
+	"gin-blog-app/middleware"
+	"gin-blog-app/migrations"
+	"gin-blog-app/repository"
+	"gin-blog-app/server"
+	"gin-blog-app/service"
+	"gin-blog-app/session"
+	"gin-blog-app/storage"
+	"gin-blog-app/throttle"
+	"io"
+	"log"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// password of every user made by testServer.user
+const testPassword = "password123"
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+//----------------------------------SERVER------------------------------------------
+
+// testServer is the API on a local port with its own database
+type testServer struct {
+	*httptest.Server
+	DB    *gorm.DB
+	Mails *mailbox
+}
+
+var databases atomic.Int64
+
+// newServer starts the API on a fresh database, both go away with the test
+func newServer(t *testing.T) *testServer {
+	t.Helper()
+
+	// one named in-memory database per server, shared by its connections
+	dsn := fmt.Sprintf("file:e2e%d?mode=memory&cache=shared&_pragma=foreign_keys(1)", databases.Add(1))
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	migrator, err := migrations.New(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := migrator.Up(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	blobs, err := storage.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// wired like main, without token auth
+	cfg := config.Default()
+	users := repository.NewGormUserRepository(db)
+	sessions := repository.NewGormSessionRepository(db)
+	comments := repository.NewGormCommentRepository(db)
+	posts := service.NewPostService(repository.NewGormPostRepository(db))
+	auditLog := audit.NewWriterLogger(io.Discard)
+	mails := &mailbox{}
+	h := controler.New(controler.Deps{
+		Users:     service.NewUserService(users, bcrypt.MinCost),
+		Posts:     posts,
+		Sessions:  sessions,
+		Comments:  comments,
+		Reactions: repository.NewGormReactionRepository(db),
+		Tags:      repository.NewGormTagRepository(db),
+		Uploads:   repository.NewGormUploadRepository(db),
+		Listings:  repository.NewGormListingRepository(db),
+		Blobs:     blobs,
+		Limiter:   throttle.NewLoginLimiter(throttle.NewMemoryStore(), auditLog),
+		Mailer:    mails,
+		Audit:     auditLog,
+		Settings: controler.Settings{
+			Session:          session.DefaultConfig(),
+			TrashRetention:   cfg.Posts.TrashRetention,
+			MaxUploadSize:    cfg.Uploads.MaxSize,
+			PasswordResetURL: cfg.Mail.PasswordResetURL,
+		},
+	})
+	auth := middleware.NewAuth(users, sessions, comments, nil, posts, session.DefaultConfig())
+	health, err := server.NewHealth(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	router, err := server.NewRouter(h, auth, health, cfg.CORS.AllowOrigins, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := &testServer{Server: httptest.NewServer(router), DB: db, Mails: mails}
+	t.Cleanup(func() {
+		srv.Close()
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return srv
+}
+
+// anonymous client, it keeps the cookies it is sent
+func (s *testServer) client(t *testing.T) *client {
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &client{srv: s, http: &http.Client{Jar: jar}}
+}
+
+// user registers username and returns a client logged in as it
+func (s *testServer) user(t *testing.T, username string) *client {
+	t.Helper()
+
+	c := s.client(t)
+	c.mustDo(t, http.StatusCreated, "POST", "/register", map[string]string{"username": username, "password": testPassword})
+	c.mustDo(t, http.StatusOK, "POST", "/login", map[string]string{"username": username, "password": testPassword})
+	return c
+}
+
+// mailbox keeps the mails the server sends
+type mailbox struct {
+	mu   sync.Mutex
+	sent []mailer.Message
+}
+
+func (m *mailbox) Send(msg mailer.Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+// wait returns the n-th mail sent (from 1), mails go out in the background
+func (m *mailbox) wait(t *testing.T, n int) mailer.Message {
+	t.Helper()
+
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+		m.mu.Lock()
+		if len(m.sent) >= n {
+			msg := m.sent[n-1]
+			m.mu.Unlock()
+			return msg
+		}
+		m.mu.Unlock()
+	}
+	t.Fatalf("mail %d not sent", n)
+	return mailer.Message{}
+}
+
+//----------------------------------CLIENT------------------------------------------
+
+// client is a browser: it keeps the session cookies and echoes the csrf
+// token on mutating requests
+type client struct {
+	srv  *testServer
+	http *http.Client
+}
+
+type response struct {
+	Status int
+	Header http.Header
+	Body   []byte
+}
+
+// do sends a request, body is sent as JSON unless it is a string; header
+// holds name, value pairs
+func (c *client) do(t *testing.T, method, path string, body interface{}, header ...string) *response {
+	t.Helper()
+
+	var reader io.Reader
+	switch b := body.(type) {
+	case nil:
+	case string:
+		reader = strings.NewReader(b)
+	default:
+		raw, err := json.Marshal(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader = bytes.NewReader(raw)
+	}
+
+	req, err := http.NewRequest(method, c.srv.URL+path, reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reader != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if csrf := c.cookie("csrf_token"); csrf != "" && method != http.MethodGet {
+		req.Header.Set("X-CSRF-Token", csrf)
+	}
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+
+	res, err := c.http.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	raw, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &response{Status: res.StatusCode, Header: res.Header, Body: raw}
+}
+
+// mustDo is do that fails the test on another status
+func (c *client) mustDo(t *testing.T, status int, method, path string, body interface{}, header ...string) *response {
+	t.Helper()
+
+	res := c.do(t, method, path, body, header...)
+	if res.Status != status {
+		t.Fatalf("%s %s: status %d, want %d: %s", method, path, res.Status, status, res.Body)
+	}
+	return res
+}
+
+// value of a cookie the server set, unescaped
+func (c *client) cookie(name string) string {
+	u, _ := url.Parse(c.srv.URL)
+	for _, ck := range c.http.Jar.Cookies(u) {
+		if ck.Name == name {
+			value, _ := url.QueryUnescape(ck.Value)
+			return value
+		}
+	}
+	return ""
+}
+
+// decode unmarshals the JSON body into v
+func (r *response) decode(t *testing.T, v interface{}) {
+	t.Helper()
+	if err := json.Unmarshal(r.Body, v); err != nil {
+		t.Fatalf("decoding %s: %v", r.Body, err)
+	}
+}
+
+//----------------------------------CASES------------------------------------------
+
+// apiCase is one request and what it must answer
+type apiCase struct {
+	name   string
+	client *client // nil sends the request without cookies
+	method string
+	path   string
+	body   interface{} // see client.do
+	header []string    // name, value pairs
+	status int
+	// fields the error envelope must name, in any order
+	fields []string
+	// further checks on the response
+	check func(t *testing.T, res *response)
+}
+
+// runCases runs the cases in order as subtests of t
+func runCases(t *testing.T, srv *testServer, cases []apiCase) {
+	t.Helper()
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := tc.client
+			if c == nil {
+				c = srv.client(t)
+			}
+
+			res := c.do(t, tc.method, tc.path, tc.body, tc.header...)
+			if res.Status != tc.status {
+				t.Fatalf("%s %s: status %d, want %d: %s", tc.method, tc.path, res.Status, tc.status, res.Body)
+			}
+
+			if len(tc.fields) > 0 {
+				var envelope struct {
+					Code   string            `json:"code"`
+					Fields map[string]string `json:"fields"`
+				}
+				res.decode(t, &envelope)
+				for _, field := range tc.fields {
+					if _, ok := envelope.Fields[field]; !ok {
+						t.Errorf("error envelope has no %q field: %s", field, res.Body)
+					}
+				}
+			}
+
+			if tc.check != nil {
+				tc.check(t, res)
+			}
+		})
+	}
+}
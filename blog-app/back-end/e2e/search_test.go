@@ -0,0 +1,101 @@
+package e2e
+
+import (
+	"net/http"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+// searchHit is a search result as listed
+type searchHit struct {
+	Title          string `json:"title"`
+	TitleHighlight string `json:"title_highlight"`
+	Snippet        string `json:"snippet"`
+}
+
+// search runs q and returns the hits in ranking order
+func search(t *testing.T, srv *testServer, q string) []searchHit {
+	t.Helper()
+
+	var body struct {
+		Results []searchHit `json:"results"`
+		Total   int64       `json:"total"`
+	}
+	srv.client(t).mustDo(t, http.StatusOK, "GET", "/posts/search?q="+url.QueryEscape(q), nil).decode(t, &body)
+	if body.Total != int64(len(body.Results)) {
+		t.Fatalf("total %d for %d results", body.Total, len(body.Results))
+	}
+	return body.Results
+}
+
+// titles and content are user input, highlighting must escape them before
+// it adds its own <mark> tags
+func TestSearchHighlightEscapes(t *testing.T) {
+	srv := newServer(t)
+	alice := srv.user(t, "alice1")
+	alice.mustDo(t, http.StatusOK, "POST", "/user/create", map[string]string{
+		"title":   `Golang <b>tips</b> & "tricks"`,
+		"content": `<img src=x onerror=alert(1)> golang`,
+	})
+
+	tests := []struct {
+		q       string
+		title   string
+		snippet string
+	}{
+		{"golang", `<mark>Golang</mark> &lt;b&gt;tips&lt;/b&gt; &amp; &#34;tricks&#34;`,
+			`&lt;img src=x onerror=alert(1)&gt; <mark>golang</mark>`},
+		// a term inside the markup is marked as text, never splits an entity
+		{"b", `Golang &lt;<mark>b</mark>&gt;tips&lt;/<mark>b</mark>&gt; &amp; &#34;tricks&#34;`,
+			`&lt;img src=x onerror=alert(1)&gt; golang`},
+		{"onerror", `Golang &lt;b&gt;tips&lt;/b&gt; &amp; &#34;tricks&#34;`,
+			`&lt;img src=x <mark>onerror</mark>=alert(1)&gt; golang`},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.q, func(t *testing.T) {
+			hits := search(t, srv, tc.q)
+			if len(hits) != 1 {
+				t.Fatalf("%d hits", len(hits))
+			}
+			if hits[0].TitleHighlight != tc.title {
+				t.Errorf("title_highlight %q, want %q", hits[0].TitleHighlight, tc.title)
+			}
+			if hits[0].Snippet != tc.snippet {
+				t.Errorf("snippet %q, want %q", hits[0].Snippet, tc.snippet)
+			}
+		})
+	}
+}
+
+// title hits rank above content hits, ties go to the newest post
+func TestSearchRanking(t *testing.T) {
+	srv := newServer(t)
+	alice := srv.user(t, "alice1")
+	for _, post := range []map[string]string{
+		{"title": "Content only", "content": "learning golang"},
+		{"title": "Golang in the title", "content": "nothing here"},
+		{"title": "Unrelated", "content": "rust"},
+		{"title": "Golang everywhere", "content": "golang again"},
+		{"title": "Content again", "content": "more golang"},
+	} {
+		alice.mustDo(t, http.StatusOK, "POST", "/user/create", post)
+	}
+	alice.mustDo(t, http.StatusOK, "POST", "/user/create",
+		map[string]string{"title": "Golang draft", "content": "golang", "status": "draft"})
+
+	var got []string
+	for _, hit := range search(t, srv, "GOLANG") {
+		got = append(got, hit.Title)
+	}
+	want := []string{"Golang everywhere", "Golang in the title", "Content again", "Content only"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ranked %q, want %q", got, want)
+	}
+
+	// every term must match
+	if hits := search(t, srv, "golang rust"); len(hits) != 0 {
+		t.Errorf("%d hits for terms no post has together", len(hits))
+	}
+}
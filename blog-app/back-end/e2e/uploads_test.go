@@ -0,0 +1,63 @@
+package e2e
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"testing"
+)
+
+// upload sends content as the multipart file field, it returns the upload
+func upload(t *testing.T, c *client, filename string, content []byte) (id uint, thumbnailURL string) {
+	t.Helper()
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("file", filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write(content)
+	form.Close()
+
+	res := c.mustDo(t, http.StatusCreated, "POST", "/user/uploads", body.String(), "Content-Type", form.FormDataContentType())
+	var out struct {
+		Upload struct {
+			ID           uint   `json:"id"`
+			ThumbnailURL string `json:"thumbnail_url"`
+		} `json:"upload"`
+	}
+	res.decode(t, &out)
+	return out.Upload.ID, out.Upload.ThumbnailURL
+}
+
+// the same content uploaded twice shares one blob, both uploads serve it
+func TestUploadDedup(t *testing.T) {
+	srv := newServer(t)
+	alice := srv.user(t, "alice1")
+
+	var img bytes.Buffer
+	if err := png.Encode(&img, image.NewGray(image.Rect(0, 0, 600, 300))); err != nil {
+		t.Fatal(err)
+	}
+
+	first, thumb := upload(t, alice, "a.png", img.Bytes())
+	second, _ := upload(t, alice, "b.png", img.Bytes())
+	if first == second || thumb == "" {
+		t.Fatalf("uploads %d and %d, thumbnail %q", first, second, thumb)
+	}
+
+	for _, id := range []uint{first, second} {
+		res := alice.mustDo(t, http.StatusOK, "GET", fmt.Sprintf("/uploads/%d", id), nil)
+		if !bytes.Equal(res.Body, img.Bytes()) {
+			t.Errorf("upload %d serves %d bytes, want the %d uploaded", id, len(res.Body), img.Len())
+		}
+		alice.mustDo(t, http.StatusOK, "GET", fmt.Sprintf("/uploads/%d/thumbnail", id), nil)
+	}
+
+	// not attached to a post, only the owner sees them
+	srv.client(t).mustDo(t, http.StatusNotFound, "GET", fmt.Sprintf("/uploads/%d", first), nil)
+}
@@ -0,0 +1,28 @@
+package jobs
+
+import (
+	"log"
+	"time"
+)
+
+// Every runs fn every interval in the background until stop is called
+func Every(name string, interval time.Duration, fn func(now time.Time) error) (stop func()) {
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case now := <-ticker.C:
+				if err := fn(now); err != nil {
+					log.Printf("%s: %v", name, err)
+				}
+			}
+		}
+	}()
+
+	return func() { close(done) }
+}
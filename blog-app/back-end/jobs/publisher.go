@@ -0,0 +1,28 @@
+package jobs
+
+import (
+	"gin-blog-app/model"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// PublishDuePosts publishes scheduled posts whose publish time has come
+func PublishDuePosts(db *gorm.DB) func(now time.Time) error {
+	return func(now time.Time) error {
+		res := db.Model(&model.Post{}).
+			Where("status = ? AND publish_at <= ?", model.PostScheduled, now).
+			Updates(map[string]interface{}{
+				"status":  model.PostPublished,
+				"version": gorm.Expr("version + 1"),
+			})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected > 0 {
+			log.Printf("post publisher: published %d posts", res.RowsAffected)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,66 @@
+package jobs
+
+import (
+	"gin-blog-app/model"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// posts removed per transaction, keeps locks short on a large backlog
+const purgeBatchSize = 100
+
+// PurgeTrashedPosts permanently deletes posts that have been in the trash for
+// longer than retention, together with their comments, reactions, revisions
+// and tag links. Their uploads are detached.
+func PurgeTrashedPosts(db *gorm.DB, retention time.Duration) func(now time.Time) error {
+	return func(now time.Time) error {
+		cutoff := now.Add(-retention)
+		purged := 0
+
+		for {
+			var ids []uint
+			err := db.Transaction(func(tx *gorm.DB) error {
+				if err := tx.Unscoped().Model(&model.Post{}).
+					Where("deleted_at IS NOT NULL AND deleted_at < ?", cutoff).
+					Limit(purgeBatchSize).
+					Pluck("id", &ids).Error; err != nil {
+					return err
+				}
+				if len(ids) == 0 {
+					return nil
+				}
+
+				// children first, the foreign keys cascade on postgres but
+				// sqlite does not enforce them by default
+				for _, child := range []interface{}{&model.Comment{}, &model.Reaction{}, &model.PostRevision{}} {
+					if err := tx.Where("post_id IN ?", ids).Delete(child).Error; err != nil {
+						return err
+					}
+				}
+				if err := tx.Table("post_tags").Where("post_id IN ?", ids).Delete(nil).Error; err != nil {
+					return err
+				}
+				// attachments become orphans, the upload cleanup removes them
+				if err := tx.Model(&model.Upload{}).Where("post_id IN ?", ids).Update("post_id", nil).Error; err != nil {
+					return err
+				}
+				return tx.Unscoped().Where("id IN ?", ids).Delete(&model.Post{}).Error
+			})
+			if err != nil {
+				return err
+			}
+
+			purged += len(ids)
+			if len(ids) < purgeBatchSize {
+				break
+			}
+		}
+
+		if purged > 0 {
+			log.Printf("trash purger: purged %d posts", purged)
+		}
+		return nil
+	}
+}
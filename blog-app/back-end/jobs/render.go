@@ -0,0 +1,36 @@
+package jobs
+
+import (
+	"gin-blog-app/model"
+	"gin-blog-app/render"
+	"log"
+
+	"gorm.io/gorm"
+)
+
+// RenderMissingContent fills the rendered html & excerpt of posts written
+// before content was rendered, meant to run once at startup
+func RenderMissingContent(db *gorm.DB) error {
+	var posts []model.Post
+	if err := db.Unscoped().Select("id", "content").
+		Where("content_html = '' OR content_html IS NULL").
+		Where("content <> ''").
+		Find(&posts).Error; err != nil {
+		return err
+	}
+
+	for _, post := range posts {
+		rendered := render.HTML(post.Content)
+		if err := db.Unscoped().Model(&model.Post{}).Where("id = ?", post.ID).UpdateColumns(map[string]interface{}{
+			"content_html": rendered,
+			"excerpt":      render.Excerpt(render.Text(rendered)),
+		}).Error; err != nil {
+			return err
+		}
+	}
+
+	if len(posts) > 0 {
+		log.Printf("rendered content of %d posts", len(posts))
+	}
+	return nil
+}
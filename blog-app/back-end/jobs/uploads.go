@@ -0,0 +1,75 @@
+package jobs
+
+import (
+	"context"
+	"gin-blog-app/model"
+	"gin-blog-app/repository"
+	"gin-blog-app/storage"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// CleanOrphanUploads deletes uploads that are attached to no post and older
+// than ttl. A blob (and its thumbnail) is deleted with the last upload
+// referencing it.
+func CleanOrphanUploads(db *gorm.DB, store storage.BlobStore, ttl time.Duration) func(now time.Time) error {
+	return func(now time.Time) error {
+		var orphans []model.Upload
+		if err := db.Where("post_id IS NULL AND created_at < ?", now.Add(-ttl)).
+			Limit(purgeBatchSize).
+			Find(&orphans).Error; err != nil {
+			return err
+		}
+		if len(orphans) == 0 {
+			return nil
+		}
+
+		ids := make([]uint, 0, len(orphans))
+		for _, u := range orphans {
+			ids = append(ids, u.ID)
+		}
+		if err := db.Where("id IN ?", ids).Delete(&model.Upload{}).Error; err != nil {
+			return err
+		}
+
+		ctx := context.Background()
+		seen := make(map[string]bool)
+		for _, u := range orphans {
+			if seen[u.BlobKey] {
+				continue
+			}
+			seen[u.BlobKey] = true
+
+			// under the lock of the upload handler, a new upload of the same
+			// content either is counted here or comes after the delete and
+			// stores the blob again
+			err := repository.WithBlobLock(db, u.SHA256, func(tx *gorm.DB) error {
+				var refs int64
+				if err := tx.Model(&model.Upload{}).Where("blob_key = ?", u.BlobKey).Count(&refs).Error; err != nil {
+					return err
+				}
+				if refs > 0 {
+					return nil
+				}
+
+				if err := store.Delete(ctx, u.BlobKey); err != nil {
+					log.Printf("upload cleanup: %s: %v", u.BlobKey, err)
+				}
+				if u.ThumbKey != nil {
+					if err := store.Delete(ctx, *u.ThumbKey); err != nil {
+						log.Printf("upload cleanup: %s: %v", *u.ThumbKey, err)
+					}
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		log.Printf("upload cleanup: removed %d orphan uploads", len(orphans))
+		return nil
+	}
+}
@@ -0,0 +1,132 @@
+package jobs
+
+import (
+	"context"
+	"gin-blog-app/migrations"
+	"gin-blog-app/model"
+	"gin-blog-app/storage"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestMain(m *testing.M) {
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// migrated in-memory database of one test
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory&cache=shared&_pragma=foreign_keys(1)"),
+		&gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	migrator, err := migrations.New(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := migrator.Up(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestCleanOrphanUploads(t *testing.T) {
+	db := newTestDB(t)
+	store, err := storage.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	owner := model.User{Username: "alice1", HashedPassword: "x"}
+	if err := db.Create(&owner).Error; err != nil {
+		t.Fatal(err)
+	}
+	post := model.Post{Title: "t", AuthorID: owner.ID, CreatedAt: time.Now(), Version: 1}
+	if err := db.Create(&post).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	old := now.Add(-48 * time.Hour)
+	thumb := "thumbs/aa/aa11"
+	upload := func(sha string, postID *uint, createdAt time.Time) model.Upload {
+		u := model.Upload{OwnerID: owner.ID, PostID: postID, Filename: "f", ContentType: "image/png", Size: 1,
+			SHA256: sha, BlobKey: "blobs/" + sha[:2] + "/" + sha, CreatedAt: createdAt}
+		if sha == "aa11" {
+			u.ThumbKey = &thumb
+		}
+		if err := db.Create(&u).Error; err != nil {
+			t.Fatal(err)
+		}
+		return u
+	}
+	for _, key := range []string{"blobs/aa/aa11", thumb, "blobs/bb/bb22", "blobs/cc/cc33"} {
+		if err := store.Put(ctx, key, strings.NewReader("x"), 1, "text/plain"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// aa11: an old orphan and an attached copy, bb22: a recent orphan,
+	// cc33: an old orphan only
+	orphanAA := upload("aa11", nil, old)
+	upload("aa11", &post.ID, old)
+	upload("bb22", nil, now)
+	orphanCC := upload("cc33", nil, old)
+
+	exists := func(key string) bool {
+		ok, err := store.Exists(ctx, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ok
+	}
+	rows := func(ids ...uint) int64 {
+		var n int64
+		db.Model(&model.Upload{}).Where("id IN ?", ids).Count(&n)
+		return n
+	}
+
+	clean := CleanOrphanUploads(db, store, 24*time.Hour)
+	if err := clean(now); err != nil {
+		t.Fatal(err)
+	}
+	if rows(orphanAA.ID, orphanCC.ID) != 0 {
+		t.Error("old orphan rows kept")
+	}
+	if !exists("blobs/aa/aa11") || !exists(thumb) {
+		t.Error("blob still referenced by a post was deleted")
+	}
+	if !exists("blobs/bb/bb22") {
+		t.Error("recent orphan was deleted")
+	}
+	if exists("blobs/cc/cc33") {
+		t.Error("unreferenced blob kept")
+	}
+
+	// once the post lets go of aa11 it goes, thumbnail included
+	if err := db.Model(&model.Upload{}).Where("sha256 = ?", "aa11").Update("post_id", nil).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := clean(now); err != nil {
+		t.Fatal(err)
+	}
+	if exists("blobs/aa/aa11") || exists(thumb) {
+		t.Error("blob of the last orphan kept")
+	}
+}
@@ -1,54 +1,190 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
+	"gin-blog-app/audit"
+	"gin-blog-app/config"
 	"gin-blog-app/controler"
 	"gin-blog-app/database"
+	"gin-blog-app/jobs"
+	"gin-blog-app/mailer"
 	"gin-blog-app/middleware"
-	"time"
-
-	"github.com/gin-contrib/cors"
-	"github.com/gin-gonic/gin"
+	"gin-blog-app/repository"
+	"gin-blog-app/server"
+	"gin-blog-app/service"
+	"gin-blog-app/session"
+	"gin-blog-app/storage"
+	"gin-blog-app/throttle"
+	"gin-blog-app/token"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
 )
 
 func main() {
 
+	// defaults < config file < env < flags
+	cfg, args, err := config.Load(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		log.Fatal("Invalid config: ", err)
+	}
+
+	// schema migrations by hand, the server applies pending ones at startup
+	if len(args) > 0 {
+		if args[0] != "migrate" {
+			log.Fatalf("Unknown command %q, the only command is migrate", args[0])
+		}
+		if err := runMigrate(cfg, args[1:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	log.Println("Config:", cfg)
+
 	//db init
-	database.InitDB()
+	db := database.InitDB(cfg.Database.ConnString())
+	// closed last, after the server has drained
+	if sqlDB, err := db.DB(); err == nil {
+		defer sqlDB.Close()
+	}
+	users := repository.NewGormUserRepository(db)
+	posts := repository.NewGormPostRepository(db)
+	sessions := repository.NewGormSessionRepository(db)
+	comments := repository.NewGormCommentRepository(db)
+
+	userService := service.NewUserService(users, cfg.Security.BcryptCost)
 
-	//multiplexer
-	router := gin.New()
+	// first admin, promoted at startup while there is none
+	if username := cfg.Security.BootstrapAdmin; username != "" {
+		if err := userService.BootstrapAdmin(username); err != nil {
+			log.Fatal("Bootstrap admin: ", err)
+		}
+	}
 
-	router.Use(cors.New(cors.Config{
-		AllowOrigins:     []string{"http://localhost:5173"}, // frontend URL
-		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Accept"},
-		ExposeHeaders:    []string{"Content-Length"},
-		AllowCredentials: true,
-		MaxAge:           12 * time.Hour,
-	}), gin.Recovery(), middleware.LoggerMiddleware())
+	// sessions
+	sessionConfig := session.Config{
+		AbsoluteLifetime: cfg.Session.AbsoluteLifetime,
+		IdleTimeout:      cfg.Session.IdleTimeout,
+		SweepInterval:    cfg.Session.SweepInterval,
+		CookieSecure:     cfg.Cookie.Secure,
+		CookieSameSite:   session.SameSite(cfg.Cookie.SameSite),
+		CookieDomain:     cfg.Cookie.Domain,
+	}
+	stopSweeper := session.StartSweeper(sessions, sessionConfig.SweepInterval)
+	defer stopSweeper()
 
-	//public routes
-	router.GET("/", controler.HomeHandler)
-	router.GET("/posts", controler.PostPageHandler)
-	router.GET("/post/:id", controler.GetPostByID)
-	router.POST("/register", controler.RegistrationHandler)
-	router.POST("/login", controler.LoginHandler)
-	router.POST("/logout", controler.LogoutHandler)
+	// token auth for API clients (enabled when signing keys are configured)
+	var tokens *token.Manager
+	if cfg.Tokens.SigningKeys != "" {
+		keys, err := token.ParseKeyring(cfg.Tokens.SigningKeys, cfg.Tokens.ActiveKID)
+		if err != nil {
+			log.Fatal("Invalid token config: ", err)
+		}
+		tokens = token.NewManager(db, keys, cfg.Tokens.AccessTTL, cfg.Tokens.RefreshTTL)
+	}
 
-	// private routes
+	// posts from before markdown rendering
+	if err := jobs.RenderMissingContent(db); err != nil {
+		log.Fatal("Rendering post content: ", err)
+	}
 
-	private := router.Group("/user")
-	private.Use(middleware.RequireAuth())
-	{
+	// scheduled posts
+	stopPublisher := jobs.Every("post publisher", cfg.Posts.PublishInterval, jobs.PublishDuePosts(db))
+	defer stopPublisher()
 
-		// post creation, updation, delete routes
-		private.POST("/create", controler.CreatePostHandler)
-		private.PATCH("/update/:postid", middleware.RequireOwner(), controler.UpdatePostHandler)
-		private.DELETE("/delete/:postid", middleware.RequireOwner(), controler.DeletePostHandler)
+	// trashed posts are purged for good after the retention period
+	stopPurger := jobs.Every("trash purger", cfg.Posts.PurgeInterval,
+		jobs.PurgeTrashedPosts(db, cfg.Posts.TrashRetention))
+	defer stopPurger()
 
+	// uploads, orphans are cleaned up once they are old enough that no
+	// post form is still about to attach them
+	blobs, err := openBlobStore(cfg.Uploads)
+	if err != nil {
+		log.Fatal("Upload storage: ", err)
 	}
+	stopUploadCleanup := jobs.Every("upload cleanup", cfg.Uploads.CleanupInterval,
+		jobs.CleanOrphanUploads(db, blobs, cfg.Uploads.OrphanTTL))
+	defer stopUploadCleanup()
 
-	//server
-	router.Run()
+	// audit log (stdout unless AUDIT_LOG_FILE is set) & login throttling
+	auditLog := audit.NewWriterLogger(os.Stdout)
+	if path := cfg.Audit.LogFile; path != "" {
+		if auditLog, err = audit.NewFileLogger(path); err != nil {
+			log.Fatal("Audit log: ", err)
+		}
+	}
+	limiter := throttle.NewLoginLimiter(throttle.NewMemoryStore(), auditLog)
+
+	// password reset mails go to a file when MAIL_FILE is set, the log otherwise
+	mail := mailer.NewLogMailer()
+	if path := cfg.Mail.File; path != "" {
+		mail = mailer.NewFileMailer(path)
+	}
+
+	// handlers & middleware get their dependencies here, nothing reads a
+	// global database handle
+	postService := service.NewPostService(posts)
+	h := controler.New(controler.Deps{
+		Users:     userService,
+		Posts:     postService,
+		Sessions:  sessions,
+		Comments:  comments,
+		Reactions: repository.NewGormReactionRepository(db),
+		Tags:      repository.NewGormTagRepository(db),
+		Uploads:   repository.NewGormUploadRepository(db),
+		Listings:  repository.NewGormListingRepository(db),
+		Tokens:    tokens,
+		Blobs:     blobs,
+		Limiter:   limiter,
+		Mailer:    mail,
+		Audit:     auditLog,
+		Settings: controler.Settings{
+			Session:          sessionConfig,
+			TrashRetention:   cfg.Posts.TrashRetention,
+			MaxUploadSize:    cfg.Uploads.MaxSize,
+			PasswordResetURL: cfg.Mail.PasswordResetURL,
+		},
+	})
+	auth := middleware.NewAuth(users, sessions, comments, tokens, postService, sessionConfig)
+
+	health, err := server.NewHealth(db)
+	if err != nil {
+		log.Fatal("Health checks: ", err)
+	}
+	router, err := server.NewRouter(h, auth, health, cfg.CORS.AllowOrigins, cfg.Server.TrustedProxies)
+	if err != nil {
+		log.Fatal("Router: ", err)
+	}
+
+	//server, until SIGTERM (or ctrl-c) after which requests drain
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+	// logged, not fatal: the deferred job stops and database close still run
+	if err := server.Serve(ctx, cfg.Server.Addr, router, cfg.Server.ShutdownTimeout); err != nil {
+		log.Println("Server:", err)
+	}
 
 }
+
+// the upload store the config selects
+func openBlobStore(cfg config.Uploads) (storage.BlobStore, error) {
+	if cfg.Storage == "s3" {
+		return storage.NewS3Store(context.Background(), storage.S3Config{
+			Endpoint:  cfg.S3.Endpoint,
+			Bucket:    cfg.S3.Bucket,
+			AccessKey: cfg.S3.AccessKey,
+			SecretKey: cfg.S3.SecretKey,
+			Region:    cfg.S3.Region,
+			UseSSL:    cfg.S3.UseSSL,
+		})
+	}
+	return storage.NewLocalStore(cfg.Dir)
+}
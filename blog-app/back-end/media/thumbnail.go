@@ -0,0 +1,86 @@
+// Package media inspects uploaded images and makes thumbnails of them.
+package media
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+
+	// decoders of the accepted upload types
+	_ "image/gif"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// ThumbnailSize is the bounding box of a thumbnail in pixels
+const ThumbnailSize = 320
+
+// images above this are not decoded, guards against decompression bombs
+const maxPixels = 40_000_000
+
+var ErrTooLarge = errors.New("image dimensions too large")
+
+// Dimensions reads the size of an image from its header
+func Dimensions(r io.Reader) (width, height int, err error) {
+	cfg, _, err := image.DecodeConfig(r)
+	if err != nil {
+		return 0, 0, err
+	}
+	return cfg.Width, cfg.Height, nil
+}
+
+// ThumbnailType is the content type of the thumbnail of an image type,
+// JPEG stays JPEG, everything else becomes PNG to keep transparency
+func ThumbnailType(contentType string) string {
+	if contentType == "image/jpeg" {
+		return "image/jpeg"
+	}
+	return "image/png"
+}
+
+// Thumbnail scales an image down to fit ThumbnailSize, smaller images keep
+// their size. It is encoded as ThumbnailType(contentType).
+func Thumbnail(r io.ReadSeeker, contentType string) ([]byte, error) {
+	width, height, err := Dimensions(r)
+	if err != nil {
+		return nil, err
+	}
+	if width*height > maxPixels {
+		return nil, ErrTooLarge
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	src, _, err := image.Decode(r)
+	if err != nil {
+		return nil, err
+	}
+
+	tw, th := fit(width, height, ThumbnailSize)
+	dst := image.NewRGBA(image.Rect(0, 0, tw, th))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, src.Bounds(), draw.Over, nil)
+
+	var buf bytes.Buffer
+	if ThumbnailType(contentType) == "image/jpeg" {
+		err = jpeg.Encode(&buf, dst, &jpeg.Options{Quality: 85})
+	} else {
+		err = png.Encode(&buf, dst)
+	}
+	return buf.Bytes(), err
+}
+
+// size fitting a box, keeping the aspect ratio
+func fit(width, height, box int) (int, int) {
+	if width <= box && height <= box {
+		return width, height
+	}
+	if width >= height {
+		return box, max(1, height*box/width)
+	}
+	return max(1, width*box/height), box
+}
@@ -0,0 +1,95 @@
+package media
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+// png of the given size
+func testPNG(t *testing.T, width, height int) []byte {
+	t.Helper()
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	img.Set(0, 0, color.NRGBA{R: 255, A: 255})
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestThumbnail(t *testing.T) {
+	tests := []struct {
+		name          string
+		width, height int
+		contentType   string
+		wantW, wantH  int
+		wantFormat    string
+	}{
+		{"landscape", 1000, 500, "image/png", ThumbnailSize, ThumbnailSize / 2, "png"},
+		{"portrait", 400, 800, "image/png", ThumbnailSize / 2, ThumbnailSize, "png"},
+		{"small keeps its size", 100, 50, "image/png", 100, 50, "png"},
+		{"thin keeps a pixel", 3200, 2, "image/png", ThumbnailSize, 1, "png"},
+		{"jpeg thumbnail", 640, 640, "image/jpeg", ThumbnailSize, ThumbnailSize, "jpeg"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			src := testPNG(t, tc.width, tc.height)
+			if w, h, err := Dimensions(bytes.NewReader(src)); err != nil || w != tc.width || h != tc.height {
+				t.Fatalf("Dimensions: %dx%d, %v", w, h, err)
+			}
+
+			thumb, err := Thumbnail(bytes.NewReader(src), tc.contentType)
+			if err != nil {
+				t.Fatal(err)
+			}
+			cfg, format, err := image.DecodeConfig(bytes.NewReader(thumb))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cfg.Width != tc.wantW || cfg.Height != tc.wantH || format != tc.wantFormat {
+				t.Errorf("thumbnail %dx%d %s, want %dx%d %s", cfg.Width, cfg.Height, format, tc.wantW, tc.wantH, tc.wantFormat)
+			}
+		})
+	}
+}
+
+func TestThumbnailRejects(t *testing.T) {
+	// only the header is read, the pixels of a bomb are never allocated
+	var bomb bytes.Buffer
+	if err := jpeg.Encode(&bomb, image.NewGray(image.Rect(0, 0, 8, 8)), nil); err != nil {
+		t.Fatal(err)
+	}
+	raw := bomb.Bytes()
+	// SOF0 frame header: height and width follow the marker, length and precision
+	sof := bytes.Index(raw, []byte{0xFF, 0xC0})
+	if sof < 0 {
+		t.Fatal("no SOF0 marker")
+	}
+	copy(raw[sof+5:], []byte{0xFF, 0xFF, 0xFF, 0xFF}) // 65535x65535
+	if _, err := Thumbnail(bytes.NewReader(raw), "image/jpeg"); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("65535x65535 jpeg: %v, want ErrTooLarge", err)
+	}
+
+	if _, err := Thumbnail(bytes.NewReader([]byte("not an image")), "image/png"); err == nil {
+		t.Error("garbage accepted")
+	}
+}
+
+func TestThumbnailType(t *testing.T) {
+	for contentType, want := range map[string]string{
+		"image/jpeg": "image/jpeg",
+		"image/png":  "image/png",
+		"image/gif":  "image/png",
+		"image/webp": "image/png",
+	} {
+		if got := ThumbnailType(contentType); got != want {
+			t.Errorf("ThumbnailType(%s) = %s, want %s", contentType, got, want)
+		}
+	}
+}
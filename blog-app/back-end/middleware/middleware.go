@@ -1,70 +1,234 @@
 package middleware
 
 import (
-	"gin-blog-app/database"
+	"crypto/subtle"
+	"errors"
+	"gin-blog-app/apierr"
 	"gin-blog-app/model"
+	"gin-blog-app/rbac"
+	"gin-blog-app/repository"
+	"gin-blog-app/service"
+	"gin-blog-app/session"
+	"gin-blog-app/token"
 	"log"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
+// Auth holds what the authentication & ownership middleware read
+type Auth struct {
+	users    repository.UserRepository
+	sessions repository.SessionRepository
+	comments repository.CommentRepository
+	tokens   *token.Manager // nil when token auth is not enabled
+	posts    *service.PostService
+	session  session.Config
+}
+
+func NewAuth(users repository.UserRepository, sessions repository.SessionRepository, comments repository.CommentRepository,
+	tokens *token.Manager, posts *service.PostService, sessionConfig session.Config) *Auth {
+	return &Auth{users: users, sessions: sessions, comments: comments, tokens: tokens, posts: posts, session: sessionConfig}
+}
+
 // Authentication middleware
-func RequireAuth() gin.HandlerFunc {
+// accepts a bearer access token (API clients) or the session cookie (browser)
+func (a *Auth) RequireAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if msg, ok := a.authenticate(c); !ok {
+			apierr.Abort(c, http.StatusUnauthorized, msg)
+			return
+		}
+		c.Next()
+	}
+}
+
+// Optional authentication for public routes
+// identifies the caller when valid credentials are sent, never rejects
+func (a *Auth) OptionalAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		a.authenticate(c)
+		c.Next()
+	}
+}
+
+// resolves the caller and stores userID, userRole & authMethod in context,
+// on failure it returns the reason
+func (a *Auth) authenticate(c *gin.Context) (string, bool) {
+	if bearer, ok := bearerToken(c); ok {
+		if a.tokens == nil {
+			return "token auth is not enabled", false
+		}
+
+		userID, err := a.tokens.ParseAccess(bearer)
+		if err != nil {
+			return "invalid or expired access token", false
+		}
+
+		// role is read fresh so role changes apply before the token expires
+		user, err := a.users.FindByID(userID)
+		if err != nil {
+			return "invalid or expired access token", false
+		}
+
+		c.Set("userID", userID)
+		c.Set("userRole", user.Role)
+		c.Set("authMethod", "token")
+		return "", true
+	}
+
+	sToken, err := c.Cookie("session_token")
+	if err != nil || sToken == "" {
+		return "please login first", false
+	}
+
+	// look up the device session
+	sess, err := a.sessions.FindByToken(sToken)
+	if err != nil {
+		return "invalid session", false
+	}
+
+	// sliding renewal: move the idle expiry and re-issue the cookies once
+	// half of the idle window is used, otherwise only record last-seen
+	// (at most once per interval)
+	now := time.Now()
+	renew := a.session.NeedsRenewal(now, sess.IdleExpiresAt)
+	if renew || now.Sub(sess.LastSeenAt) > session.TouchInterval {
+		idleExpiresAt := sess.IdleExpiresAt
+		if renew {
+			idleExpiresAt = a.session.IdleDeadline(now, sess.ExpiresAt)
+		}
+
+		if err := a.sessions.Touch(sess.ID, now, idleExpiresAt); err != nil {
+			log.Printf("session touch failed: %v", err)
+		} else if renew {
+			sess.IdleExpiresAt = idleExpiresAt
+			a.session.SetCookies(c, sToken, sess.CSRFToken, idleExpiresAt)
+		}
+	}
+
+	// store userID & session in context
+	c.Set("userID", sess.UserID)
+	c.Set("userRole", sess.User.Role)
+	c.Set("sessionID", sess.ID)
+	c.Set("session", sess)
+	c.Set("authMethod", "session")
+	return "", true
+}
+
+// token from "Authorization: Bearer <token>"
+func bearerToken(c *gin.Context) (string, bool) {
+	scheme, tok, ok := strings.Cut(c.GetHeader("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || strings.TrimSpace(tok) == "" {
+		return "", false
+	}
+	return strings.TrimSpace(tok), true
+}
+
+// CSRF middleware (double submit), runs after RequireAuth
+// mutating requests must echo the csrf_token cookie in the X-CSRF-Token header,
+// the header is compared with the token stored on the session
+func RequireCSRF() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		sToken, err := c.Cookie("session_token")
-		if err != nil || sToken == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "please login first"})
-			c.Abort()
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			c.Next()
 			return
 		}
 
-		// check if user exists with this session
-		var currentUser model.User
-		if err := database.DB.Where("session_token = ?", sToken).First(&currentUser).Error; err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid session"})
-			c.Abort()
+		// bearer tokens are never sent by the browser on its own
+		if c.GetString("authMethod") == "token" {
+			c.Next()
+			return
+		}
+
+		sess := c.MustGet("session").(*model.Session)
+		header := c.GetHeader("X-CSRF-Token")
+
+		if header == "" || sess.CSRFToken == "" ||
+			subtle.ConstantTimeCompare([]byte(header), []byte(sess.CSRFToken)) != 1 {
+			apierr.AbortCode(c, http.StatusForbidden, "csrf_token_invalid", "missing or invalid CSRF token")
 			return
 		}
 
-		// store userID in context
-		c.Set("userID", currentUser.ID)
+		c.Next()
+	}
+}
+
+// Permission middleware, runs after RequireAuth
+func RequirePermission(perm rbac.Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !rbac.Can(c.GetString("userRole"), perm) {
+			apierr.Abort(c, http.StatusForbidden, "missing permission "+string(perm))
+			return
+		}
 		c.Next()
 	}
 }
 
 // Authorization middleware (for delete/update posts)
-func RequireOwner() gin.HandlerFunc {
+// the owner passes, so does anyone holding the override permission
+func (a *Auth) RequireOwner(override rbac.Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// get postID from URL and convert to uint
+		postID, err := strconv.ParseUint(c.Param("postid"), 10, 64)
+		if err != nil {
+			apierr.Abort(c, http.StatusBadRequest, "invalid post ID")
+			return
+		}
+
+		// the logged-in user owns the post or holds the override permission
+		actor := service.Actor{UserID: c.MustGet("userID").(uint), Role: c.GetString("userRole")}
+		if _, err := a.posts.Authorize(actor, uint(postID), override); err != nil {
+			switch {
+			case errors.Is(err, repository.ErrNotFound):
+				apierr.Abort(c, http.StatusNotFound, "post not found")
+			case errors.Is(err, service.ErrNotOwner):
+				apierr.Abort(c, http.StatusForbidden, err.Error())
+			default:
+				apierr.Abort(c, http.StatusInternalServerError, "could not load post")
+			}
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// Authorization middleware (for edit/delete comments)
+// the comment author, the owner of the post it belongs to and anyone
+// holding the override permission are allowed
+func (a *Auth) RequireCommentOwner(override rbac.Permission) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// get logged-in user ID from context
 		userID := c.MustGet("userID").(uint)
 
-		// get postID from URL and convert to uint
-		postIDParam := c.Param("postid")
-		postID, err := strconv.ParseUint(postIDParam, 10, 64)
+		commentID, err := strconv.ParseUint(c.Param("commentid"), 10, 64)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid post ID"})
-			c.Abort()
+			apierr.Abort(c, http.StatusBadRequest, "invalid comment ID")
 			return
 		}
 
-		// fetch post
-		var post model.Post
-		if err := database.DB.First(&post, postID).Error; err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "post not found"})
-			c.Abort()
+		comment, err := a.comments.FindByID(uint(commentID))
+		if err != nil {
+			if errors.Is(err, repository.ErrNotFound) {
+				apierr.Abort(c, http.StatusNotFound, "comment not found")
+				return
+			}
+			apierr.Abort(c, http.StatusInternalServerError, "could not load comment")
 			return
 		}
 
-		// check ownership
-		if post.AuthorID != userID {
-			c.JSON(http.StatusForbidden, gin.H{"error": "not allowed to modify this post"})
-			c.Abort()
+		if comment.AuthorID != userID && comment.Post.AuthorID != userID &&
+			!rbac.Can(c.GetString("userRole"), override) {
+			apierr.Abort(c, http.StatusForbidden, "not allowed to modify this comment")
 			return
 		}
 
+		// handlers pick the loaded comment up from context
+		c.Set("comment", *comment)
 		c.Next()
 	}
 }
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"gin-blog-app/config"
+	"gin-blog-app/database"
+	"gin-blog-app/migrations"
+	"strconv"
+)
+
+const migrateUsage = `usage: migrate up | down [n] | status | create <name>
+  up             apply every pending migration
+  down [n]       roll back the last n migrations (default 1)
+  status         list migrations and when they were applied
+  create <name>  add empty up/down files of the next version under migrations/`
+
+// migrate subcommand: blog [flags] migrate up|down|status|create
+func runMigrate(cfg config.Config, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("%s", migrateUsage)
+	}
+
+	// create only writes files, no database needed
+	if args[0] == "create" {
+		if len(args) != 2 {
+			return fmt.Errorf("%s", migrateUsage)
+		}
+		paths, err := migrations.Create("migrations", args[1])
+		for _, p := range paths {
+			fmt.Println("created", p)
+		}
+		return err
+	}
+
+	db, err := database.Open(cfg.Database.ConnString())
+	if err != nil {
+		return err
+	}
+	migrator, err := migrations.New(db)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+
+	switch args[0] {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		for _, m := range applied {
+			fmt.Printf("applied  %04d_%s\n", m.Version, m.Name)
+		}
+		if err == nil && len(applied) == 0 {
+			fmt.Println("nothing to apply")
+		}
+		return err
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			if steps, err = strconv.Atoi(args[1]); err != nil || steps < 1 {
+				return fmt.Errorf("down: %q is not a positive number", args[1])
+			}
+		}
+		reverted, err := migrator.Down(ctx, steps)
+		for _, m := range reverted {
+			fmt.Printf("reverted %04d_%s\n", m.Version, m.Name)
+		}
+		return err
+	case "status":
+		list, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		for _, st := range list {
+			applied := "pending"
+			if st.AppliedAt != nil {
+				applied = "applied " + st.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d_%-40s %s\n", st.Version, st.Name, applied)
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown migrate command %q\n%s", args[0], migrateUsage)
+}
@@ -0,0 +1,343 @@
+// Package migrations applies the numbered SQL migrations embedded from
+// postgres/ and sqlite/. Files are named NNNN_name.up.sql and
+// NNNN_name.down.sql; every applied version is recorded in schema_migrations.
+//
+// Each migration runs in its own transaction together with its
+// schema_migrations row, so a failed migration leaves nothing behind. On
+// postgres an advisory lock keeps two instances from migrating at once.
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+//go:embed postgres/*.sql sqlite/*.sql
+var files embed.FS
+
+// Dialects with a migration directory
+var Dialects = []string{"postgres", "sqlite"}
+
+// advisory lock key of the migrator, any constant shared by all instances
+const lockKey = 4_107_202_211
+
+var (
+	fileName      = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+	migrationName = regexp.MustCompile(`^[a-z0-9_]+$`)
+)
+
+// bookkeeping table, created before the first migration runs
+var schemaTable = map[string]string{
+	"postgres": `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version bigint PRIMARY KEY, name text NOT NULL, applied_at timestamptz NOT NULL)`,
+	"sqlite": `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version integer PRIMARY KEY, name text NOT NULL, applied_at datetime NOT NULL)`,
+}
+
+// Migration is one numbered schema change
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string // empty when the migration can't be rolled back
+}
+
+// Status of a migration, AppliedAt is nil while pending
+type Status struct {
+	Version   int64
+	Name      string
+	AppliedAt *time.Time
+}
+
+// schemaMigration is a row of schema_migrations
+type schemaMigration struct {
+	Version   int64 `gorm:"primaryKey"`
+	Name      string
+	AppliedAt time.Time
+}
+
+func (schemaMigration) TableName() string { return "schema_migrations" }
+
+// Load reads the embedded migrations of a dialect, ordered by version
+func Load(dialect string) ([]Migration, error) {
+	entries, err := fs.ReadDir(files, dialect)
+	if err != nil {
+		return nil, fmt.Errorf("no migrations for dialect %q", dialect)
+	}
+
+	byVersion := map[int64]*Migration{}
+	for _, e := range entries {
+		m := fileName.FindStringSubmatch(e.Name())
+		if m == nil {
+			return nil, fmt.Errorf("%s/%s: not a NNNN_name.(up|down).sql file", dialect, e.Name())
+		}
+		version, _ := strconv.ParseInt(m[1], 10, 64)
+		body, err := fs.ReadFile(files, path.Join(dialect, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		mig := byVersion[version]
+		if mig == nil {
+			mig = &Migration{Version: version, Name: m[2]}
+			byVersion[version] = mig
+		}
+		if mig.Name != m[2] {
+			return nil, fmt.Errorf("%s: version %d is used by %s and %s", dialect, version, mig.Name, m[2])
+		}
+		if m[3] == "up" {
+			mig.Up = string(body)
+		} else {
+			mig.Down = string(body)
+		}
+	}
+
+	list := make([]Migration, 0, len(byVersion))
+	for _, mig := range byVersion {
+		if mig.Up == "" {
+			return nil, fmt.Errorf("%s: migration %d_%s has no up file", dialect, mig.Version, mig.Name)
+		}
+		list = append(list, *mig)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Version < list[j].Version })
+	return list, nil
+}
+
+//----------------------------------MIGRATOR------------------------------------------
+
+// Migrator applies the migrations of the database's dialect
+type Migrator struct {
+	db         *gorm.DB
+	migrations []Migration
+}
+
+func New(db *gorm.DB) (*Migrator, error) {
+	list, err := Load(db.Dialector.Name())
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, migrations: list}, nil
+}
+
+// Up applies every pending migration in order
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	var applied []Migration
+	err := m.locked(ctx, func(db *gorm.DB) error {
+		done, err := appliedVersions(db)
+		if err != nil {
+			return err
+		}
+		for _, mig := range m.migrations {
+			if _, ok := done[mig.Version]; ok {
+				continue
+			}
+			err := db.Transaction(func(tx *gorm.DB) error {
+				if err := tx.Exec(mig.Up).Error; err != nil {
+					return err
+				}
+				return tx.Create(&schemaMigration{Version: mig.Version, Name: mig.Name, AppliedAt: time.Now()}).Error
+			})
+			if err != nil {
+				return fmt.Errorf("migration %d_%s: %w", mig.Version, mig.Name, err)
+			}
+			applied = append(applied, mig)
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// Down rolls back the last steps applied migrations, newest first
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	var reverted []Migration
+	err := m.locked(ctx, func(db *gorm.DB) error {
+		var rows []schemaMigration
+		if err := db.Order("version DESC").Limit(steps).Find(&rows).Error; err != nil {
+			return err
+		}
+		for _, row := range rows {
+			mig, ok := m.find(row.Version)
+			if !ok {
+				return fmt.Errorf("migration %d_%s is applied but not known to this binary", row.Version, row.Name)
+			}
+			if mig.Down == "" {
+				return fmt.Errorf("migration %d_%s has no down file", mig.Version, mig.Name)
+			}
+			err := db.Transaction(func(tx *gorm.DB) error {
+				if err := tx.Exec(mig.Down).Error; err != nil {
+					return err
+				}
+				return tx.Delete(&schemaMigration{}, mig.Version).Error
+			})
+			if err != nil {
+				return fmt.Errorf("migration %d_%s: %w", mig.Version, mig.Name, err)
+			}
+			reverted = append(reverted, mig)
+		}
+		return nil
+	})
+	return reverted, err
+}
+
+// Status lists every known migration and the applied ones this binary
+// doesn't know, ordered by version
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	var done map[int64]schemaMigration
+	err := m.locked(ctx, func(db *gorm.DB) error {
+		var err error
+		done, err = appliedVersions(db)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]Status, 0, len(m.migrations))
+	for _, mig := range m.migrations {
+		st := Status{Version: mig.Version, Name: mig.Name}
+		if row, ok := done[mig.Version]; ok {
+			st.AppliedAt = &row.AppliedAt
+			delete(done, mig.Version)
+		}
+		list = append(list, st)
+	}
+	for _, row := range done {
+		appliedAt := row.AppliedAt
+		list = append(list, Status{Version: row.Version, Name: row.Name + " (unknown)", AppliedAt: &appliedAt})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Version < list[j].Version })
+	return list, nil
+}
+
+// Pending lists the migrations not applied yet. Unlike Status it neither
+// takes the migration lock nor creates schema_migrations, so it is cheap
+// enough for readiness probes.
+func (m *Migrator) Pending(ctx context.Context) ([]Migration, error) {
+	done, err := appliedVersions(m.db.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	var pending []Migration
+	for _, mig := range m.migrations {
+		if _, ok := done[mig.Version]; !ok {
+			pending = append(pending, mig)
+		}
+	}
+	return pending, nil
+}
+
+//----------------------------------MIGRATOR---helpers------------------------------
+
+func (m *Migrator) find(version int64) (Migration, bool) {
+	for _, mig := range m.migrations {
+		if mig.Version == version {
+			return mig, true
+		}
+	}
+	return Migration{}, false
+}
+
+// runs fn on one connection holding the migration lock; postgres advisory
+// locks belong to a connection, sqlite has a single writer anyway
+func (m *Migrator) locked(ctx context.Context, fn func(db *gorm.DB) error) error {
+	sqlDB, err := m.db.DB()
+	if err != nil {
+		return err
+	}
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	db := m.db.Session(&gorm.Session{NewDB: true, Context: ctx})
+	db.Statement.ConnPool = conn
+
+	if db.Dialector.Name() == "postgres" {
+		if err := db.Exec("SELECT pg_advisory_lock(?)", lockKey).Error; err != nil {
+			return fmt.Errorf("migration lock: %w", err)
+		}
+		defer unlock(conn)
+	}
+
+	if err := db.Exec(schemaTable[db.Dialector.Name()]).Error; err != nil {
+		return err
+	}
+	return fn(db)
+}
+
+// released on a fresh context, the caller's may be cancelled by now
+func unlock(conn *sql.Conn) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, _ = conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", lockKey)
+}
+
+func appliedVersions(db *gorm.DB) (map[int64]schemaMigration, error) {
+	var rows []schemaMigration
+	if err := db.Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	done := make(map[int64]schemaMigration, len(rows))
+	for _, row := range rows {
+		done[row.Version] = row
+	}
+	return done, nil
+}
+
+//----------------------------------CREATE------------------------------------------
+
+// Create writes empty up & down files of the next version for every dialect
+// into dir (the migrations source directory) and returns their paths
+func Create(dir, name string) ([]string, error) {
+	if !migrationName.MatchString(name) {
+		return nil, errors.New("migration name may only contain a-z, 0-9 and _")
+	}
+
+	var next int64 = 1
+	for _, dialect := range Dialects {
+		list, err := Load(dialect)
+		if err != nil {
+			return nil, err
+		}
+		if n := len(list); n > 0 && list[n-1].Version >= next {
+			next = list[n-1].Version + 1
+		}
+		// files created since this binary was built
+		onDisk, _ := filepath.Glob(filepath.Join(dir, dialect, "*.up.sql"))
+		for _, f := range onDisk {
+			if m := fileName.FindStringSubmatch(filepath.Base(f)); m != nil {
+				if v, _ := strconv.ParseInt(m[1], 10, 64); v >= next {
+					next = v + 1
+				}
+			}
+		}
+	}
+
+	var created []string
+	for _, dialect := range Dialects {
+		for _, direction := range []string{"up", "down"} {
+			p := filepath.Join(dir, dialect, fmt.Sprintf("%04d_%s.%s.sql", next, name, direction))
+			body := fmt.Sprintf("-- %04d %s (%s), %s\n", next, name, dialect, direction)
+			if err := os.WriteFile(p, []byte(body), 0o644); err != nil {
+				return created, err
+			}
+			created = append(created, p)
+		}
+	}
+	return created, nil
+}
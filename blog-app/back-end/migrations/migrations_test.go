@@ -0,0 +1,164 @@
+package migrations
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+func TestUpDown(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:?_pragma=foreign_keys(1)"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := New(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	applied, err := m.Up(ctx)
+	if err != nil || len(applied) != len(m.migrations) {
+		t.Fatalf("up applied %d of %d: %v", len(applied), len(m.migrations), err)
+	}
+	if pending, _ := m.Pending(ctx); len(pending) != 0 {
+		t.Errorf("%d pending after up", len(pending))
+	}
+	if reverted, err := m.Down(ctx, len(m.migrations)); err != nil || len(reverted) != len(m.migrations) {
+		t.Fatalf("down reverted %d: %v", len(reverted), err)
+	}
+	if applied, err := m.Up(ctx); err != nil || len(applied) != len(m.migrations) {
+		t.Fatalf("up again applied %d: %v", len(applied), err)
+	}
+}
+
+// the original models, as AutoMigrate created them before the migrations
+type baselineUser struct {
+	ID             uint   `gorm:"primaryKey;autoIncrement"`
+	Username       string `gorm:"uniqueIndex"`
+	HashedPassword string
+	SessionToken   string `gorm:"uniqueIndex"`
+	CSRFToken      string
+
+	Posts []baselinePost `gorm:"foreignKey:AuthorID;constraint:OnUpdate:CASCADE,OnDelete:SET NULL;"`
+}
+
+func (baselineUser) TableName() string { return "users" }
+
+type baselinePost struct {
+	ID        uint `gorm:"primaryKey;autoIncrement"`
+	Title     string
+	Content   string
+	AuthorID  uint
+	Author    baselineUser `gorm:"foreignKey:AuthorID"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+func (baselinePost) TableName() string { return "posts" }
+
+// upgrades a database AutoMigrate created from the original models, in a
+// fresh schema of a test database:
+//
+//	POSTGRES_TEST_DSN="host=localhost user=postgres password=postgres dbname=blog_test sslmode=disable" go test ./migrations/
+func TestUpgradeBaseline(t *testing.T) {
+	dsn := os.Getenv("POSTGRES_TEST_DSN")
+	if dsn == "" {
+		t.Skip("POSTGRES_TEST_DSN is not set")
+	}
+
+	admin, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	schema := fmt.Sprintf("migrations_test_%d", time.Now().UnixNano())
+	if err := admin.Exec("CREATE SCHEMA " + schema).Error; err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { admin.Exec("DROP SCHEMA " + schema + " CASCADE") })
+
+	db, err := gorm.Open(postgres.Open(withSearchPath(dsn, schema)), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&baselineUser{}, &baselinePost{}); err != nil {
+		t.Fatal(err)
+	}
+	alice := baselineUser{Username: "alice1", HashedPassword: "x", SessionToken: "s1", CSRFToken: "c1"}
+	if err := db.Create(&alice).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&baselinePost{Title: "Old", Content: "# old", AuthorID: alice.ID}).Error; err != nil {
+		t.Fatal(err)
+	}
+	// left behind by a deleted author (SET NULL)
+	if err := db.Exec("INSERT INTO posts (title, content, created_at) VALUES ('Orphan', 'x', now())").Error; err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := New(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Up(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	var user struct {
+		Role  string
+		Email *string
+	}
+	if err := db.Raw("SELECT role, email FROM users WHERE id = ?", alice.ID).Scan(&user).Error; err != nil || user.Role != "user" {
+		t.Errorf("user %+v, %v", user, err)
+	}
+	var legacy int64
+	db.Raw(`SELECT count(*) FROM information_schema.columns
+		WHERE table_schema = ? AND table_name = 'users' AND column_name IN ('session_token', 'csrf_token')`, schema).Scan(&legacy)
+	if legacy != 0 {
+		t.Errorf("%d legacy session columns kept", legacy)
+	}
+
+	var posts []struct {
+		Title     string
+		Status    string
+		Version   int64
+		PublishAt *time.Time
+		CreatedAt time.Time
+	}
+	if err := db.Raw("SELECT title, status, version, publish_at, created_at FROM posts").Scan(&posts).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(posts) != 1 {
+		t.Fatalf("got %d posts, want the orphan removed: %+v", len(posts), posts)
+	}
+	if p := posts[0]; p.Title != "Old" || p.Status != "published" || p.Version != 1 ||
+		p.PublishAt == nil || !p.PublishAt.Equal(p.CreatedAt) {
+		t.Errorf("post %+v", p)
+	}
+
+	// the new schema works on the upgraded tables
+	if err := db.Exec("INSERT INTO users (username, hashed_password, email) VALUES ('bob123', 'x', 'bob@example.com')").Error; err != nil {
+		t.Error(err)
+	}
+	if err := db.Exec("DELETE FROM users WHERE id = ?", alice.ID).Error; err != nil {
+		t.Error(err)
+	}
+}
+
+// dsn with its search path set to schema, keyword/value or URL form
+func withSearchPath(dsn, schema string) string {
+	if !strings.Contains(dsn, "://") {
+		return dsn + " search_path=" + schema
+	}
+	if strings.Contains(dsn, "?") {
+		return dsn + "&search_path=" + schema
+	}
+	return dsn + "?search_path=" + schema
+}
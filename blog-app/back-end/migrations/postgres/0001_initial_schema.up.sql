@@ -0,0 +1,205 @@
+-- schema as of the switch from AutoMigrate. A database AutoMigrate created
+-- from the original models (users and posts only) is upgraded in place: the
+-- tables exist already, so the columns added since are added here, backfilled
+-- and the legacy ones dropped before anything indexes them.
+
+CREATE TABLE IF NOT EXISTS users (
+    id              bigserial PRIMARY KEY,
+    username        text,
+    hashed_password text,
+    email           text,
+    role            text NOT NULL DEFAULT 'user'
+);
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS email text,
+    ADD COLUMN IF NOT EXISTS role text NOT NULL DEFAULT 'user';
+-- sessions moved to their own table, existing logins end
+DROP INDEX IF EXISTS idx_users_session_token;
+ALTER TABLE users
+    DROP COLUMN IF EXISTS session_token,
+    DROP COLUMN IF EXISTS csrf_token;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_username ON users (username);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_email ON users (email);
+
+CREATE TABLE IF NOT EXISTS sessions (
+    id              bigserial PRIMARY KEY,
+    user_id         bigint NOT NULL,
+    token_hash      text NOT NULL,
+    csrf_token      text,
+    user_agent      text,
+    ip              text,
+    created_at      timestamptz,
+    last_seen_at    timestamptz,
+    expires_at      timestamptz,
+    idle_expires_at timestamptz,
+    CONSTRAINT fk_sessions_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS idx_sessions_user_id ON sessions (user_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_sessions_token_hash ON sessions (token_hash);
+CREATE INDEX IF NOT EXISTS idx_sessions_expires_at ON sessions (expires_at);
+CREATE INDEX IF NOT EXISTS idx_sessions_idle_expires_at ON sessions (idle_expires_at);
+
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+    id         bigserial PRIMARY KEY,
+    user_id    bigint NOT NULL,
+    family_id  text NOT NULL,
+    token_hash text NOT NULL,
+    expires_at timestamptz,
+    used_at    timestamptz,
+    revoked_at timestamptz,
+    created_at timestamptz,
+    CONSTRAINT fk_refresh_tokens_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_user_id ON refresh_tokens (user_id);
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_family_id ON refresh_tokens (family_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_refresh_tokens_token_hash ON refresh_tokens (token_hash);
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_expires_at ON refresh_tokens (expires_at);
+
+CREATE TABLE IF NOT EXISTS password_reset_tokens (
+    id         bigserial PRIMARY KEY,
+    user_id    bigint NOT NULL,
+    token_hash text NOT NULL,
+    expires_at timestamptz,
+    used_at    timestamptz,
+    created_at timestamptz,
+    CONSTRAINT fk_password_reset_tokens_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS idx_password_reset_tokens_user_id ON password_reset_tokens (user_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_password_reset_tokens_token_hash ON password_reset_tokens (token_hash);
+CREATE INDEX IF NOT EXISTS idx_password_reset_tokens_expires_at ON password_reset_tokens (expires_at);
+
+CREATE TABLE IF NOT EXISTS categories (
+    id         bigserial PRIMARY KEY,
+    name       text NOT NULL,
+    slug       text NOT NULL,
+    created_at timestamptz
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_categories_slug ON categories (slug);
+
+CREATE TABLE IF NOT EXISTS tags (
+    id         bigserial PRIMARY KEY,
+    name       text NOT NULL,
+    slug       text NOT NULL,
+    created_at timestamptz
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_tags_slug ON tags (slug);
+
+-- deleting a user keeps their posts (author_id set to NULL)
+CREATE TABLE IF NOT EXISTS posts (
+    id            bigserial PRIMARY KEY,
+    title         text,
+    content       text,
+    author_id     bigint,
+    created_at    timestamptz,
+    updated_at    timestamptz,
+    content_html  text,
+    excerpt       text,
+    status        text NOT NULL DEFAULT 'published',
+    publish_at    timestamptz,
+    like_count    bigint NOT NULL DEFAULT 0,
+    dislike_count bigint NOT NULL DEFAULT 0,
+    deleted_at    timestamptz,
+    version       bigint NOT NULL DEFAULT 1,
+    category_id   bigint,
+    CONSTRAINT fk_users_posts FOREIGN KEY (author_id) REFERENCES users (id) ON DELETE SET NULL ON UPDATE CASCADE,
+    CONSTRAINT fk_posts_category FOREIGN KEY (category_id) REFERENCES categories (id) ON DELETE SET NULL
+);
+ALTER TABLE posts
+    ADD COLUMN IF NOT EXISTS content_html text,
+    ADD COLUMN IF NOT EXISTS excerpt text,
+    ADD COLUMN IF NOT EXISTS status text NOT NULL DEFAULT 'published',
+    ADD COLUMN IF NOT EXISTS publish_at timestamptz,
+    ADD COLUMN IF NOT EXISTS like_count bigint NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS dislike_count bigint NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS deleted_at timestamptz,
+    ADD COLUMN IF NOT EXISTS version bigint NOT NULL DEFAULT 1,
+    ADD COLUMN IF NOT EXISTS category_id bigint;
+ALTER TABLE posts DROP CONSTRAINT IF EXISTS fk_posts_category;
+ALTER TABLE posts ADD CONSTRAINT fk_posts_category
+    FOREIGN KEY (category_id) REFERENCES categories (id) ON DELETE SET NULL;
+-- older posts were public from the start, content_html and excerpt are
+-- rendered at startup (jobs.RenderMissingContent)
+UPDATE posts SET publish_at = created_at WHERE status = 'published' AND publish_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_posts_status ON posts (status);
+CREATE INDEX IF NOT EXISTS idx_posts_publish_at ON posts (publish_at);
+CREATE INDEX IF NOT EXISTS idx_posts_deleted_at ON posts (deleted_at);
+CREATE INDEX IF NOT EXISTS idx_posts_category_id ON posts (category_id);
+
+-- full-text search, the expression must match database.PostSearchVector
+CREATE INDEX IF NOT EXISTS idx_posts_search ON posts USING GIN ((
+    setweight(to_tsvector('english', coalesce(title, '')), 'A') ||
+    setweight(to_tsvector('english', coalesce(content, '')), 'B')
+));
+
+CREATE TABLE IF NOT EXISTS post_tags (
+    post_id bigint,
+    tag_id  bigint,
+    PRIMARY KEY (post_id, tag_id),
+    CONSTRAINT fk_post_tags_post FOREIGN KEY (post_id) REFERENCES posts (id) ON DELETE CASCADE,
+    CONSTRAINT fk_post_tags_tag FOREIGN KEY (tag_id) REFERENCES tags (id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS post_revisions (
+    id            bigserial PRIMARY KEY,
+    post_id       bigint NOT NULL,
+    rev           bigint NOT NULL,
+    title         text,
+    content       text,
+    editor_id     bigint,
+    restored_from bigint,
+    created_at    timestamptz,
+    CONSTRAINT fk_post_revisions_post FOREIGN KEY (post_id) REFERENCES posts (id) ON DELETE CASCADE,
+    CONSTRAINT fk_post_revisions_editor FOREIGN KEY (editor_id) REFERENCES users (id) ON DELETE CASCADE
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_post_revisions_post_rev ON post_revisions (post_id, rev);
+CREATE INDEX IF NOT EXISTS idx_post_revisions_editor_id ON post_revisions (editor_id);
+
+CREATE TABLE IF NOT EXISTS uploads (
+    id           bigserial PRIMARY KEY,
+    owner_id     bigint NOT NULL,
+    post_id      bigint,
+    filename     text,
+    content_type text,
+    size         bigint,
+    sha256       text NOT NULL,
+    blob_key     text NOT NULL,
+    thumb_key    text,
+    width        bigint,
+    height       bigint,
+    created_at   timestamptz,
+    CONSTRAINT fk_uploads_owner FOREIGN KEY (owner_id) REFERENCES users (id) ON DELETE CASCADE,
+    CONSTRAINT fk_uploads_post FOREIGN KEY (post_id) REFERENCES posts (id) ON DELETE SET NULL
+);
+CREATE INDEX IF NOT EXISTS idx_uploads_owner_id ON uploads (owner_id);
+CREATE INDEX IF NOT EXISTS idx_uploads_post_id ON uploads (post_id);
+CREATE INDEX IF NOT EXISTS idx_uploads_sha256 ON uploads (sha256);
+
+CREATE TABLE IF NOT EXISTS comments (
+    id         bigserial PRIMARY KEY,
+    content    text NOT NULL,
+    post_id    bigint NOT NULL,
+    author_id  bigint,
+    parent_id  bigint,
+    root_id    bigint,
+    created_at timestamptz,
+    updated_at timestamptz,
+    CONSTRAINT fk_comments_post FOREIGN KEY (post_id) REFERENCES posts (id) ON DELETE CASCADE,
+    CONSTRAINT fk_comments_author FOREIGN KEY (author_id) REFERENCES users (id) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS idx_comments_post_id ON comments (post_id);
+CREATE INDEX IF NOT EXISTS idx_comments_author_id ON comments (author_id);
+CREATE INDEX IF NOT EXISTS idx_comments_parent_id ON comments (parent_id);
+CREATE INDEX IF NOT EXISTS idx_comments_root_id ON comments (root_id);
+
+CREATE TABLE IF NOT EXISTS reactions (
+    id         bigserial PRIMARY KEY,
+    user_id    bigint NOT NULL,
+    post_id    bigint NOT NULL,
+    type       text NOT NULL,
+    created_at timestamptz,
+    updated_at timestamptz,
+    CONSTRAINT fk_reactions_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE,
+    CONSTRAINT fk_reactions_post FOREIGN KEY (post_id) REFERENCES posts (id) ON DELETE CASCADE
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_reactions_user_post ON reactions (user_id, post_id);
+CREATE INDEX IF NOT EXISTS idx_reactions_post_id ON reactions (post_id);
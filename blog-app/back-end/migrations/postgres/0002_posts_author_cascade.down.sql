@@ -0,0 +1,6 @@
+-- 0002 posts_author_cascade (postgres), down
+DROP INDEX IF EXISTS idx_posts_author_id;
+ALTER TABLE posts DROP CONSTRAINT IF EXISTS fk_users_posts;
+ALTER TABLE posts ADD CONSTRAINT fk_users_posts
+    FOREIGN KEY (author_id) REFERENCES users (id) ON DELETE SET NULL ON UPDATE CASCADE;
+ALTER TABLE posts ALTER COLUMN author_id DROP NOT NULL;
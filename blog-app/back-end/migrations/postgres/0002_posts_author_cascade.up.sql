@@ -0,0 +1,9 @@
+-- 0002 posts_author_cascade (postgres), up
+-- posts go with their author, like comments and revisions: Post.AuthorID
+-- can't hold NULL, so posts SET NULL left behind could not be loaded
+DELETE FROM posts WHERE author_id IS NULL;
+ALTER TABLE posts ALTER COLUMN author_id SET NOT NULL;
+ALTER TABLE posts DROP CONSTRAINT IF EXISTS fk_users_posts;
+ALTER TABLE posts ADD CONSTRAINT fk_users_posts
+    FOREIGN KEY (author_id) REFERENCES users (id) ON DELETE CASCADE ON UPDATE CASCADE;
+CREATE INDEX IF NOT EXISTS idx_posts_author_id ON posts (author_id);
@@ -0,0 +1,173 @@
+-- same schema as postgres/0001 in sqlite types, used by the tests
+-- (no full-text index, search falls back to LIKE)
+
+CREATE TABLE IF NOT EXISTS users (
+    id              integer PRIMARY KEY AUTOINCREMENT,
+    username        text,
+    hashed_password text,
+    email           text,
+    role            text NOT NULL DEFAULT 'user'
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_username ON users (username);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_email ON users (email);
+
+CREATE TABLE IF NOT EXISTS sessions (
+    id              integer PRIMARY KEY AUTOINCREMENT,
+    user_id         integer NOT NULL,
+    token_hash      text NOT NULL,
+    csrf_token      text,
+    user_agent      text,
+    ip              text,
+    created_at      datetime,
+    last_seen_at    datetime,
+    expires_at      datetime,
+    idle_expires_at datetime,
+    CONSTRAINT fk_sessions_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS idx_sessions_user_id ON sessions (user_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_sessions_token_hash ON sessions (token_hash);
+CREATE INDEX IF NOT EXISTS idx_sessions_expires_at ON sessions (expires_at);
+CREATE INDEX IF NOT EXISTS idx_sessions_idle_expires_at ON sessions (idle_expires_at);
+
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+    id         integer PRIMARY KEY AUTOINCREMENT,
+    user_id    integer NOT NULL,
+    family_id  text NOT NULL,
+    token_hash text NOT NULL,
+    expires_at datetime,
+    used_at    datetime,
+    revoked_at datetime,
+    created_at datetime,
+    CONSTRAINT fk_refresh_tokens_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_user_id ON refresh_tokens (user_id);
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_family_id ON refresh_tokens (family_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_refresh_tokens_token_hash ON refresh_tokens (token_hash);
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_expires_at ON refresh_tokens (expires_at);
+
+CREATE TABLE IF NOT EXISTS password_reset_tokens (
+    id         integer PRIMARY KEY AUTOINCREMENT,
+    user_id    integer NOT NULL,
+    token_hash text NOT NULL,
+    expires_at datetime,
+    used_at    datetime,
+    created_at datetime,
+    CONSTRAINT fk_password_reset_tokens_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS idx_password_reset_tokens_user_id ON password_reset_tokens (user_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_password_reset_tokens_token_hash ON password_reset_tokens (token_hash);
+CREATE INDEX IF NOT EXISTS idx_password_reset_tokens_expires_at ON password_reset_tokens (expires_at);
+
+CREATE TABLE IF NOT EXISTS categories (
+    id         integer PRIMARY KEY AUTOINCREMENT,
+    name       text NOT NULL,
+    slug       text NOT NULL,
+    created_at datetime
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_categories_slug ON categories (slug);
+
+CREATE TABLE IF NOT EXISTS tags (
+    id         integer PRIMARY KEY AUTOINCREMENT,
+    name       text NOT NULL,
+    slug       text NOT NULL,
+    created_at datetime
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_tags_slug ON tags (slug);
+
+-- deleting a user keeps their posts (author_id set to NULL)
+CREATE TABLE IF NOT EXISTS posts (
+    id            integer PRIMARY KEY AUTOINCREMENT,
+    title         text,
+    content       text,
+    author_id     integer,
+    created_at    datetime,
+    updated_at    datetime,
+    content_html  text,
+    excerpt       text,
+    status        text NOT NULL DEFAULT 'published',
+    publish_at    datetime,
+    like_count    integer NOT NULL DEFAULT 0,
+    dislike_count integer NOT NULL DEFAULT 0,
+    deleted_at    datetime,
+    version       integer NOT NULL DEFAULT 1,
+    category_id   integer,
+    CONSTRAINT fk_users_posts FOREIGN KEY (author_id) REFERENCES users (id) ON DELETE SET NULL ON UPDATE CASCADE,
+    CONSTRAINT fk_posts_category FOREIGN KEY (category_id) REFERENCES categories (id) ON DELETE SET NULL
+);
+CREATE INDEX IF NOT EXISTS idx_posts_status ON posts (status);
+CREATE INDEX IF NOT EXISTS idx_posts_publish_at ON posts (publish_at);
+CREATE INDEX IF NOT EXISTS idx_posts_deleted_at ON posts (deleted_at);
+CREATE INDEX IF NOT EXISTS idx_posts_category_id ON posts (category_id);
+
+CREATE TABLE IF NOT EXISTS post_tags (
+    post_id integer,
+    tag_id  integer,
+    PRIMARY KEY (post_id, tag_id),
+    CONSTRAINT fk_post_tags_post FOREIGN KEY (post_id) REFERENCES posts (id) ON DELETE CASCADE,
+    CONSTRAINT fk_post_tags_tag FOREIGN KEY (tag_id) REFERENCES tags (id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS post_revisions (
+    id            integer PRIMARY KEY AUTOINCREMENT,
+    post_id       integer NOT NULL,
+    rev           integer NOT NULL,
+    title         text,
+    content       text,
+    editor_id     integer,
+    restored_from integer,
+    created_at    datetime,
+    CONSTRAINT fk_post_revisions_post FOREIGN KEY (post_id) REFERENCES posts (id) ON DELETE CASCADE,
+    CONSTRAINT fk_post_revisions_editor FOREIGN KEY (editor_id) REFERENCES users (id) ON DELETE CASCADE
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_post_revisions_post_rev ON post_revisions (post_id, rev);
+CREATE INDEX IF NOT EXISTS idx_post_revisions_editor_id ON post_revisions (editor_id);
+
+CREATE TABLE IF NOT EXISTS uploads (
+    id           integer PRIMARY KEY AUTOINCREMENT,
+    owner_id     integer NOT NULL,
+    post_id      integer,
+    filename     text,
+    content_type text,
+    size         integer,
+    sha256       text NOT NULL,
+    blob_key     text NOT NULL,
+    thumb_key    text,
+    width        integer,
+    height       integer,
+    created_at   datetime,
+    CONSTRAINT fk_uploads_owner FOREIGN KEY (owner_id) REFERENCES users (id) ON DELETE CASCADE,
+    CONSTRAINT fk_uploads_post FOREIGN KEY (post_id) REFERENCES posts (id) ON DELETE SET NULL
+);
+CREATE INDEX IF NOT EXISTS idx_uploads_owner_id ON uploads (owner_id);
+CREATE INDEX IF NOT EXISTS idx_uploads_post_id ON uploads (post_id);
+CREATE INDEX IF NOT EXISTS idx_uploads_sha256 ON uploads (sha256);
+
+CREATE TABLE IF NOT EXISTS comments (
+    id         integer PRIMARY KEY AUTOINCREMENT,
+    content    text NOT NULL,
+    post_id    integer NOT NULL,
+    author_id  integer,
+    parent_id  integer,
+    root_id    integer,
+    created_at datetime,
+    updated_at datetime,
+    CONSTRAINT fk_comments_post FOREIGN KEY (post_id) REFERENCES posts (id) ON DELETE CASCADE,
+    CONSTRAINT fk_comments_author FOREIGN KEY (author_id) REFERENCES users (id) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS idx_comments_post_id ON comments (post_id);
+CREATE INDEX IF NOT EXISTS idx_comments_author_id ON comments (author_id);
+CREATE INDEX IF NOT EXISTS idx_comments_parent_id ON comments (parent_id);
+CREATE INDEX IF NOT EXISTS idx_comments_root_id ON comments (root_id);
+
+CREATE TABLE IF NOT EXISTS reactions (
+    id         integer PRIMARY KEY AUTOINCREMENT,
+    user_id    integer NOT NULL,
+    post_id    integer NOT NULL,
+    type       text NOT NULL,
+    created_at datetime,
+    updated_at datetime,
+    CONSTRAINT fk_reactions_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE,
+    CONSTRAINT fk_reactions_post FOREIGN KEY (post_id) REFERENCES posts (id) ON DELETE CASCADE
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_reactions_user_post ON reactions (user_id, post_id);
+CREATE INDEX IF NOT EXISTS idx_reactions_post_id ON reactions (post_id);
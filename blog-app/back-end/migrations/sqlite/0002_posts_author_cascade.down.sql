@@ -0,0 +1,3 @@
+-- 0002 posts_author_cascade (sqlite), down
+DROP INDEX IF EXISTS idx_posts_author_id;
+DROP TRIGGER IF EXISTS trg_users_delete_posts;
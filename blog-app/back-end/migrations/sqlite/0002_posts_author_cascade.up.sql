@@ -0,0 +1,12 @@
+-- 0002 posts_author_cascade (sqlite), up
+-- posts go with their author, like comments and revisions: Post.AuthorID
+-- can't hold NULL, so posts SET NULL left behind could not be loaded.
+-- sqlite can't change a foreign key in place and rebuilding posts would
+-- cascade into its children, a trigger deletes the posts before the
+-- user instead (their own children follow through their cascades)
+DELETE FROM posts WHERE author_id IS NULL;
+CREATE TRIGGER IF NOT EXISTS trg_users_delete_posts BEFORE DELETE ON users
+BEGIN
+    DELETE FROM posts WHERE author_id = OLD.id;
+END;
+CREATE INDEX IF NOT EXISTS idx_posts_author_id ON posts (author_id);
@@ -1,44 +1,336 @@
 package model
 
-import "time"
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
 
 // User model
 type User struct {
 	ID             uint   `json:"id" gorm:"primaryKey;autoIncrement"`
 	Username       string `json:"username" gorm:"uniqueIndex"`
 	HashedPassword string `json:"-"` // do not expose in JSON
-	SessionToken   string `json:"session_token" gorm:"uniqueIndex"`
-	CSRFToken      string `json:"csrf_token"`
+	// optional, needed for password recovery
+	Email *string `json:"-" gorm:"uniqueIndex"`
+	// user, moderator or admin (see rbac)
+	Role string `json:"role" gorm:"not null;default:user"`
+
+	Posts []Post `json:"posts" gorm:"foreignKey:AuthorID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+}
+
+// Session model, one row per logged-in device
+// only the hash of the session token is stored
+type Session struct {
+	ID         uint      `json:"id" gorm:"primaryKey;autoIncrement"`
+	UserID     uint      `json:"-" gorm:"index;not null"`
+	User       User      `json:"-" gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE;"`
+	TokenHash  string    `json:"-" gorm:"uniqueIndex;not null"`
+	CSRFToken  string    `json:"-"`
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	// absolute expiry, fixed at login
+	ExpiresAt time.Time `json:"expires_at" gorm:"index"`
+	// idle expiry, slides forward while the session is used
+	IdleExpiresAt time.Time `json:"idle_expires_at" gorm:"index"`
+}
 
-	Posts []Post `json:"posts" gorm:"foreignKey:AuthorID;constraint:OnUpdate:CASCADE,OnDelete:SET NULL;"`
+// RefreshToken model for token (API) clients
+// every refresh spends the token and issues the next one of the same family
+type RefreshToken struct {
+	ID        uint      `gorm:"primaryKey;autoIncrement"`
+	UserID    uint      `gorm:"index;not null"`
+	User      User      `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE;"`
+	FamilyID  string    `gorm:"index;not null"`
+	TokenHash string    `gorm:"uniqueIndex;not null"`
+	ExpiresAt time.Time `gorm:"index"`
+	UsedAt    *time.Time
+	RevokedAt *time.Time
+	CreatedAt time.Time
+}
+
+// PasswordResetToken model, single use, only the hash is stored
+type PasswordResetToken struct {
+	ID        uint      `gorm:"primaryKey;autoIncrement"`
+	UserID    uint      `gorm:"index;not null"`
+	User      User      `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE;"`
+	TokenHash string    `gorm:"uniqueIndex;not null"`
+	ExpiresAt time.Time `gorm:"index"`
+	UsedAt    *time.Time
+	CreatedAt time.Time
 }
 
 // Post model
 type Post struct {
 	ID        uint      `json:"id" gorm:"primaryKey;autoIncrement"`
 	Title     string    `json:"title"`
-	Content   string    `json:"content"`
+	Content   string    `json:"content"`   // Markdown source
 	AuthorID  uint      `json:"author_id"` // Foreign key to User.ID
 	Author    User      `json:"author" gorm:"foreignKey:AuthorID"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
+
+	// rendered from Content on every write, the HTML is sanitised
+	ContentHTML string `json:"content_html"`
+	Excerpt     string `json:"excerpt"`
+
+	// lifecycle, only published posts are public
+	Status    string     `json:"status" gorm:"not null;default:published;index"`
+	PublishAt *time.Time `json:"publish_at" gorm:"index"`
+
+	// reaction counters, kept in step with the reactions table
+	LikeCount    int64 `json:"like_count" gorm:"not null;default:0"`
+	DislikeCount int64 `json:"dislike_count" gorm:"not null;default:0"`
+
+	// soft delete, trashed posts are purged after the retention period
+	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
+
+	// bumped on every edit, served as the ETag for optimistic concurrency
+	Version int64 `json:"version" gorm:"not null;default:1"`
+
+	CategoryID *uint     `json:"category_id" gorm:"index"`
+	Category   *Category `json:"category,omitempty" gorm:"foreignKey:CategoryID;constraint:OnDelete:SET NULL;"`
+	Tags       []Tag     `json:"tags" gorm:"many2many:post_tags;constraint:OnDelete:CASCADE;"`
+}
+
+// post statuses
+const (
+	PostDraft     = "draft"
+	PostScheduled = "scheduled" // published by the scheduler at PublishAt
+	PostPublished = "published"
+	PostArchived  = "archived"
+)
+
+// PostRevision model, a snapshot of a post's title and content
+// rev 1 is the post as created, every edit or restore adds the next one
+type PostRevision struct {
+	ID           uint      `json:"id" gorm:"primaryKey;autoIncrement"`
+	PostID       uint      `json:"post_id" gorm:"not null;uniqueIndex:idx_post_revisions_post_rev"`
+	Post         Post      `json:"-" gorm:"foreignKey:PostID;constraint:OnDelete:CASCADE;"`
+	Rev          int       `json:"rev" gorm:"not null;uniqueIndex:idx_post_revisions_post_rev"`
+	Title        string    `json:"title"`
+	Content      string    `json:"content"`
+	EditorID     uint      `json:"editor_id" gorm:"index"`
+	Editor       User      `json:"-" gorm:"foreignKey:EditorID;constraint:OnDelete:CASCADE;"`
+	RestoredFrom *int      `json:"restored_from"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// Upload model, a file uploaded by a user and optionally attached to a post
+// uploads with the same content (SHA256) share one blob in storage
+type Upload struct {
+	ID          uint      `json:"id" gorm:"primaryKey;autoIncrement"`
+	OwnerID     uint      `json:"owner_id" gorm:"not null;index"`
+	Owner       User      `json:"-" gorm:"foreignKey:OwnerID;constraint:OnDelete:CASCADE;"`
+	PostID      *uint     `json:"post_id" gorm:"index"`
+	Post        *Post     `json:"-" gorm:"foreignKey:PostID;constraint:OnDelete:SET NULL;"`
+	Filename    string    `json:"filename"`
+	ContentType string    `json:"content_type"`
+	Size        int64     `json:"size"`
+	SHA256      string    `json:"sha256" gorm:"column:sha256;not null;index"`
+	BlobKey     string    `json:"-" gorm:"not null"`
+	ThumbKey    *string   `json:"-"`
+	Width       int       `json:"width,omitempty"`
+	Height      int       `json:"height,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// Reaction model, at most one per user and post
+type Reaction struct {
+	ID        uint      `json:"id" gorm:"primaryKey;autoIncrement"`
+	UserID    uint      `json:"user_id" gorm:"not null;uniqueIndex:idx_reactions_user_post"`
+	User      User      `json:"-" gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE;"`
+	PostID    uint      `json:"post_id" gorm:"not null;uniqueIndex:idx_reactions_user_post;index"`
+	Post      Post      `json:"-" gorm:"foreignKey:PostID;constraint:OnDelete:CASCADE;"`
+	Type      string    `json:"type" gorm:"not null"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Tag model, created on demand from the names given on a post
+type Tag struct {
+	ID        uint      `json:"id" gorm:"primaryKey;autoIncrement"`
+	Name      string    `json:"name" gorm:"not null"`
+	Slug      string    `json:"slug" gorm:"uniqueIndex;not null"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Category model, one per post, managed by admins
+type Category struct {
+	ID        uint      `json:"id" gorm:"primaryKey;autoIncrement"`
+	Name      string    `json:"name" gorm:"not null"`
+	Slug      string    `json:"slug" gorm:"uniqueIndex;not null"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Comment model
+// ParentID points at the comment being replied to, RootID at the top-level
+// comment of the thread so a whole thread can be loaded with one query.
+type Comment struct {
+	ID        uint      `json:"id" gorm:"primaryKey;autoIncrement"`
+	Content   string    `json:"content" gorm:"not null"`
+	PostID    uint      `json:"post_id" gorm:"index;not null"`
+	Post      Post      `json:"-" gorm:"foreignKey:PostID;constraint:OnDelete:CASCADE;"`
+	AuthorID  uint      `json:"author_id" gorm:"index"`
+	Author    User      `json:"-" gorm:"foreignKey:AuthorID;constraint:OnDelete:CASCADE;"`
+	ParentID  *uint     `json:"parent_id" gorm:"index"`
+	RootID    *uint     `json:"root_id" gorm:"index"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
 }
 
 type UserRegisterInput struct {
-	Username string `json:"username"`
-	Password string `json:"password"`
+	Username string `json:"username" binding:"required,min=6,max=30,username"`
+	// bcrypt refuses more than 72 bytes
+	Password string `json:"password" binding:"required,min=9,maxbytes=72"`
+	Email    string `json:"email" binding:"omitempty,email,max=254"` // optional
 }
 
 type UserLoginInput struct {
-	Username string `json:"username"`
-	Password string `json:"password"`
+	Username string `json:"username" binding:"required"`
+	Password string `json:"password" binding:"required"`
+	// "token" returns an access/refresh token pair instead of cookies
+	Mode string `json:"mode" binding:"omitempty,oneof=token"`
+}
+
+type ChangePasswordInput struct {
+	OldPassword string `json:"old_password" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required,min=9,maxbytes=72"`
+}
+
+type ForgotPasswordInput struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+type ResetPasswordInput struct {
+	Token       string `json:"token" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required,min=9,maxbytes=72"`
+}
+
+type RoleInput struct {
+	Role string `json:"role" binding:"required"` // one of rbac.Roles()
+}
+
+type RefreshTokenInput struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+type PostInput struct {
+	Title     string     `json:"title" binding:"required,notblank,max=200"`
+	Content   string     `json:"content" binding:"required,notblank,max=100000"` // Markdown
+	Tags      []string   `json:"tags" binding:"max=10,dive,max=50"`
+	Category  string     `json:"category" binding:"max=50"`                                           // category slug
+	Status    string     `json:"status" binding:"omitempty,oneof=draft scheduled published archived"` // published when empty
+	PublishAt *time.Time `json:"publish_at"`
+	Uploads   []uint     `json:"uploads" binding:"max=20"` // ids of the author's uploads to attach
+}
+
+// merge-patch update: absent fields keep their value, null clears content,
+// tags, category, uploads and publish_at; title and status can't be null
+type UpdatePostInput struct {
+	Title     Patch[string]    `json:"title" binding:"omitempty,max=200"`
+	Content   Patch[string]    `json:"content" binding:"omitempty,max=100000"`
+	Tags      Patch[[]string]  `json:"tags" binding:"omitempty,max=10,dive,max=50"`
+	Category  Patch[string]    `json:"category" binding:"omitempty,max=50"` // "" removes the category too
+	Uploads   Patch[[]uint]    `json:"uploads" binding:"omitempty,max=20"`
+	Status    Patch[string]    `json:"status" binding:"omitempty,oneof=draft scheduled published archived"`
+	PublishAt Patch[time.Time] `json:"publish_at"`
 }
 
 type PostResponse struct {
+	ID           uint       `json:"id"`
+	Title        string     `json:"title"`
+	Content      string     `json:"content"`
+	Excerpt      string     `json:"excerpt"`
+	Format       string     `json:"format,omitempty" gorm:"-"`
+	Author       string     `json:"author"`
+	Category     string     `json:"category,omitempty"`
+	Tags         []string   `json:"tags" gorm:"-"`
+	Status       string     `json:"status"`
+	PublishAt    *time.Time `json:"publish_at"`
+	CommentCount int64      `json:"comment_count"`
+	LikeCount    int64      `json:"like_count"`
+	DislikeCount int64      `json:"dislike_count"`
+	MyReaction   *string    `json:"my_reaction"`
+	Version      int64      `json:"version"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+
+	// attachments, single post responses only
+	Uploads []UploadResponse `json:"uploads,omitempty" gorm:"-"`
+}
+
+type ReactionInput struct {
+	Type string `json:"type" binding:"required,oneof=like dislike"`
+}
+
+type TagResponse struct {
+	Name      string `json:"name"`
+	Slug      string `json:"slug"`
+	PostCount int64  `json:"post_count"`
+}
+
+type CategoryInput struct {
+	Name string `json:"name" binding:"required,notblank,max=50"`
+}
+
+type CommentInput struct {
+	Content  string `json:"content" binding:"required,notblank,max=5000"`
+	ParentID *uint  `json:"parent_id"`
+}
+
+type CommentResponse struct {
+	ID        uint               `json:"id"`
+	Content   string             `json:"content"`
+	Author    string             `json:"author"`
+	AuthorID  uint               `json:"author_id"`
+	ParentID  *uint              `json:"parent_id"`
+	CreatedAt time.Time          `json:"created_at"`
+	UpdatedAt time.Time          `json:"updated_at"`
+	Replies   []*CommentResponse `json:"replies"`
+	// replies in the whole thread, top-level comments only
+	ReplyCount *int64 `json:"reply_count,omitempty"`
+}
+
+type PostRevisionResponse struct {
+	Rev          int       `json:"rev"`
+	Title        string    `json:"title"`
+	Content      string    `json:"content,omitempty"`
+	Editor       string    `json:"editor"`
+	RestoredFrom *int      `json:"restored_from,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+type TrashedPostResponse struct {
 	ID        uint      `json:"id"`
 	Title     string    `json:"title"`
-	Content   string    `json:"content"`
-	Author    string    `json:"author"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	Status    string    `json:"status"`
+	DeletedAt time.Time `json:"deleted_at"`
+	PurgeAt   time.Time `json:"purge_at" gorm:"-"`
+}
+
+type UploadResponse struct {
+	ID           uint      `json:"id"`
+	Filename     string    `json:"filename"`
+	ContentType  string    `json:"content_type"`
+	Size         int64     `json:"size"`
+	SHA256       string    `json:"sha256"`
+	URL          string    `json:"url"`
+	ThumbnailURL string    `json:"thumbnail_url,omitempty"`
+	Width        int       `json:"width,omitempty"`
+	Height       int       `json:"height,omitempty"`
+	PostID       *uint     `json:"post_id"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+type PostSearchResult struct {
+	ID             uint      `json:"id"`
+	Title          string    `json:"title"`
+	Author         string    `json:"author"`
+	CreatedAt      time.Time `json:"created_at"`
+	Rank           float64   `json:"rank"`
+	TitleHighlight string    `json:"title_highlight"`
+	Snippet        string    `json:"snippet"`
 }
@@ -0,0 +1,36 @@
+package model
+
+import "encoding/json"
+
+// Patch is one field of a JSON merge-patch body (RFC 7396): absent keeps the
+// current value, null removes it, anything else replaces it
+type Patch[T any] struct {
+	Set   bool // the key is in the body
+	Null  bool // the key is in the body as null
+	Value T
+}
+
+// only called for keys present in the body, null included
+func (p *Patch[T]) UnmarshalJSON(data []byte) error {
+	p.Set = true
+	if string(data) == "null" {
+		p.Null = true
+		var zero T
+		p.Value = zero
+		return nil
+	}
+	return json.Unmarshal(data, &p.Value)
+}
+
+// the key is in the body with a value other than null
+func (p Patch[T]) HasValue() bool {
+	return p.Set && !p.Null
+}
+
+// the new value, nil when the field is absent or null (validation skips it)
+func (p Patch[T]) Present() interface{} {
+	if !p.HasValue() {
+		return nil
+	}
+	return p.Value
+}
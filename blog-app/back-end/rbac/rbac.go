@@ -0,0 +1,58 @@
+package rbac
+
+// roles
+const (
+	RoleUser      = "user"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
+// Permission is "<resource>:<action>:<scope>"
+type Permission string
+
+// permissions that reach past ownership
+const (
+	PostEditAny      Permission = "post:edit:any"
+	PostDeleteAny    Permission = "post:delete:any"
+	CommentEditAny   Permission = "comment:edit:any"
+	CommentDeleteAny Permission = "comment:delete:any"
+	UserManage       Permission = "user:manage"
+	CategoryManage   Permission = "category:manage"
+)
+
+var moderatorPermissions = []Permission{
+	PostEditAny,
+	PostDeleteAny,
+	CommentEditAny,
+	CommentDeleteAny,
+}
+
+var rolePermissions = map[string]map[Permission]bool{
+	RoleUser:      set(),
+	RoleModerator: set(moderatorPermissions...),
+	RoleAdmin:     set(append([]Permission{UserManage, CategoryManage}, moderatorPermissions...)...),
+}
+
+func set(perms ...Permission) map[Permission]bool {
+	m := make(map[Permission]bool, len(perms))
+	for _, p := range perms {
+		m[p] = true
+	}
+	return m
+}
+
+// Can reports whether the role holds the permission
+func Can(role string, p Permission) bool {
+	return rolePermissions[role][p]
+}
+
+// ValidRole reports whether role is known
+func ValidRole(role string) bool {
+	_, ok := rolePermissions[role]
+	return ok
+}
+
+// Roles lists the known roles
+func Roles() []string {
+	return []string{RoleUser, RoleModerator, RoleAdmin}
+}
@@ -0,0 +1,91 @@
+// Package render turns Markdown post content into sanitised HTML, plain text
+// and excerpts.
+package render
+
+import (
+	"bytes"
+	"html"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+)
+
+// ExcerptLength is the maximum length of an excerpt in characters
+const ExcerptLength = 200
+
+// CommonMark + GitHub flavoured extras, raw HTML in the source is dropped
+// by goldmark (no html.WithUnsafe) and the output still goes through the
+// allow-list below
+var markdown = goldmark.New(
+	goldmark.WithExtensions(
+		extension.NewTable(extension.WithTableCellAlignMethod(extension.TableCellAlignAttribute)),
+		extension.Strikethrough,
+		extension.Linkify,
+		extension.TaskList,
+	),
+)
+
+// allow-list of what the Markdown renderer produces, anything else is removed
+var policy = func() *bluemonday.Policy {
+	p := bluemonday.NewPolicy()
+
+	p.AllowElements(
+		"p", "br", "hr", "h1", "h2", "h3", "h4", "h5", "h6",
+		"em", "strong", "del", "blockquote", "ul", "ol", "li", "pre", "code",
+		"table", "thead", "tbody", "tr", "th", "td",
+	)
+	p.AllowAttrs("start").Matching(bluemonday.Integer).OnElements("ol")
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^language-[\w+-]+$`)).OnElements("code")
+	p.AllowAttrs("align").Matching(regexp.MustCompile(`^(left|center|right)$`)).OnElements("th", "td")
+
+	// links & images, only web and mail URLs
+	p.AllowStandardURLs()
+	p.AllowURLSchemes("http", "https", "mailto")
+	p.AllowAttrs("href", "title").OnElements("a")
+	p.RequireNoFollowOnLinks(true)
+	p.AddTargetBlankToFullyQualifiedLinks(true)
+	p.AllowAttrs("src", "alt", "title").OnElements("img")
+
+	// task list checkboxes
+	p.AllowAttrs("type").Matching(regexp.MustCompile(`^checkbox$`)).OnElements("input")
+	p.AllowAttrs("checked", "disabled").Matching(regexp.MustCompile(`^(|checked|disabled)$`)).OnElements("input")
+
+	return p
+}()
+
+var (
+	stripTags  = bluemonday.StrictPolicy()
+	whitespace = regexp.MustCompile(`\s+`)
+)
+
+// HTML renders Markdown source into sanitised HTML
+func HTML(source string) string {
+	var buf bytes.Buffer
+	// writing into a bytes.Buffer does not fail
+	_ = markdown.Convert([]byte(source), &buf)
+	return policy.Sanitize(buf.String())
+}
+
+// Text is the plain text of rendered HTML, whitespace collapsed
+func Text(rendered string) string {
+	text := html.UnescapeString(stripTags.Sanitize(rendered))
+	return strings.TrimSpace(whitespace.ReplaceAllString(text, " "))
+}
+
+// Excerpt is the start of a plain text, cut at a word boundary
+func Excerpt(text string) string {
+	if utf8.RuneCountInString(text) <= ExcerptLength {
+		return text
+	}
+
+	runes := []rune(text)
+	cut := string(runes[:ExcerptLength])
+	if i := strings.LastIndexByte(cut, ' '); i > len(cut)/2 {
+		cut = cut[:i]
+	}
+	return strings.TrimRight(cut, " ,.;:") + "…"
+}
@@ -0,0 +1,78 @@
+package render
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHTML(t *testing.T) {
+	// sanitize is the allow-list alone, for HTML goldmark would never let
+	// through, in case raw HTML is ever enabled
+	sanitize := policy.Sanitize
+
+	tests := []struct {
+		name   string
+		render func(string) string
+		source string
+		want   []string // substrings of the output
+		banned []string // must not appear, case-insensitive
+	}{
+		{"script", HTML, "hi <script>alert(1)</script> there", []string{"<p>hi"}, []string{"<script"}},
+		{"script sanitised", sanitize, `<p>hi</p><script>alert(1)</script>`, []string{"<p>hi</p>"}, []string{"<script", "alert"}},
+		{"javascript link", HTML, "[x](javascript:alert(1))", []string{"x"}, []string{"javascript:", "<a"}},
+		{"javascript link mixed case", HTML, "[x](JaVaScRiPt:alert(1))", []string{"x"}, []string{"javascript:", "<a"}},
+		{"javascript link sanitised", sanitize, `<a href="javascript:alert(1)">x</a>`, []string{"x"}, []string{"javascript:", "href"}},
+		{"data link", HTML, "[x](data:text/html;base64,PHNjcmlwdD4=)", []string{"x"}, []string{"data:", "<a"}},
+		{"data image", HTML, "![i](data:image/svg+xml;base64,PHN2Zz4=)", []string{`alt="i"`}, []string{"data:", "src="}},
+		{"data link sanitised", sanitize, `<a href="data:text/html,<script>alert(1)</script>">x</a>`, []string{"x"}, []string{"data:", "href"}},
+		{"event handler", HTML, `<img src=x onerror=alert(1)>`, nil, []string{"onerror", "<img"}},
+		{"event handler sanitised", sanitize, `<img src="https://example.com/a.png" onerror="alert(1)">`,
+			[]string{`src="https://example.com/a.png"`}, []string{"onerror"}},
+		{"onclick sanitised", sanitize, `<a href="https://example.com" onclick="alert(1)">x</a>`,
+			[]string{`href="https://example.com"`}, []string{"onclick"}},
+		{"style sanitised", sanitize, `<p style="background:url(javascript:alert(1))">x</p>`, []string{"<p>x</p>"}, []string{"style", "javascript:"}},
+		{"raw html block", HTML, "<div><iframe src=\"https://evil.example\"></iframe></div>\n\ntext", []string{"<p>text</p>"}, []string{"<div", "<iframe"}},
+		{"raw inline html", HTML, "a <b>bold</b> word", []string{"<p>a bold word</p>"}, []string{"<b>"}},
+		{"iframe sanitised", sanitize, `<iframe src="https://evil.example"></iframe><p>x</p>`, []string{"<p>x</p>"}, []string{"<iframe"}},
+		{"external link", HTML, "[ok](https://example.com)",
+			[]string{`href="https://example.com"`, `rel="nofollow noopener"`, `target="_blank"`}, nil},
+		{"relative link", HTML, "[post](/post/1)", []string{`<a href="/post/1" rel="nofollow">post</a>`}, []string{"target"}},
+		{"mailto link", HTML, "[mail](mailto:a@example.com)", []string{`href="mailto:a@example.com"`}, nil},
+		{"task list", HTML, "- [x] done", []string{`<input checked="" disabled="" type="checkbox">`}, nil},
+		{"code language", HTML, "```go\nx := 1\n```", []string{`<code class="language-go">`}, nil},
+		{"code class sanitised", sanitize, `<code class="evil" onmouseover="x">y</code>`, []string{"<code>y</code>"}, []string{"evil", "onmouseover"}},
+		{"table alignment", HTML, "| a |\n|:-:|\n| b |", []string{`<th align="center">a</th>`, `<td align="center">b</td>`}, nil},
+		{"list start", HTML, "3. a", []string{`<ol start="3">`}, nil},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got := tc.render(tc.source)
+			for _, want := range tc.want {
+				if !strings.Contains(got, want) {
+					t.Errorf("%q lacks %q", got, want)
+				}
+			}
+			for _, banned := range tc.banned {
+				if strings.Contains(strings.ToLower(got), banned) {
+					t.Errorf("%q contains %q", got, banned)
+				}
+			}
+		})
+	}
+}
+
+func TestTextAndExcerpt(t *testing.T) {
+	if got := Text(HTML("# Title\n\nfish &amp; *chips*")); got != "Title fish & chips" {
+		t.Errorf("text %q", got)
+	}
+
+	long := strings.Repeat("word ", 60)
+	excerpt := Excerpt(strings.TrimSpace(long))
+	if !strings.HasSuffix(excerpt, "word…") || len([]rune(excerpt)) > ExcerptLength+1 {
+		t.Errorf("excerpt %q", excerpt)
+	}
+	if got := Excerpt("short"); got != "short" {
+		t.Errorf("short excerpt %q", got)
+	}
+}
@@ -0,0 +1,175 @@
+package repository
+
+import (
+	"gin-blog-app/model"
+
+	"gorm.io/gorm"
+)
+
+// CommentThreads is a page of a post's top-level comments with the first
+// replies of each thread, replies in creation order
+type CommentThreads struct {
+	Roots   []model.Comment
+	Replies []model.Comment
+	// replies per thread, by top-level comment
+	Counts map[uint]int64
+	// top-level comments of the post
+	Total int64
+}
+
+// CommentRepository stores the comment threads of posts
+type CommentRepository interface {
+	// FindByID returns a comment with its author and post
+	FindByID(id uint) (*model.Comment, error)
+	// Create stores a new comment and loads its author
+	Create(comment *model.Comment) error
+	// UpdateContent replaces the content of a comment and reloads it
+	UpdateContent(comment *model.Comment, content string) error
+	// DeleteSubtree deletes a comment and every reply below it
+	DeleteSubtree(comment model.Comment) error
+	// Threads returns a page of the top-level comments of a post, each with
+	// the first perThread replies of its thread
+	Threads(postID uint, offset, limit, perThread int) (*CommentThreads, error)
+	// Replies returns a page of the replies of a thread, by its top-level
+	// comment, in creation order and their total
+	Replies(rootID uint, offset, limit int) ([]model.Comment, int64, error)
+}
+
+// GORM backed comments
+type gormCommentRepository struct {
+	db *gorm.DB
+}
+
+func NewGormCommentRepository(db *gorm.DB) CommentRepository {
+	return &gormCommentRepository{db: db}
+}
+
+func (r *gormCommentRepository) FindByID(id uint) (*model.Comment, error) {
+	var comment model.Comment
+	if err := r.db.Preload("Author").Preload("Post").First(&comment, id).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &comment, nil
+}
+
+func (r *gormCommentRepository) Create(comment *model.Comment) error {
+	if err := r.db.Create(comment).Error; err != nil {
+		return err
+	}
+	return r.db.Preload("Author").First(comment, comment.ID).Error
+}
+
+func (r *gormCommentRepository) UpdateContent(comment *model.Comment, content string) error {
+	if err := r.db.Model(comment).Update("content", content).Error; err != nil {
+		return err
+	}
+	return r.db.Preload("Author").First(comment, comment.ID).Error
+}
+
+func (r *gormCommentRepository) DeleteSubtree(comment model.Comment) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		ids, err := commentSubtreeIDs(tx, comment)
+		if err != nil {
+			return err
+		}
+		return tx.Where("id IN ?", ids).Delete(&model.Comment{}).Error
+	})
+}
+
+func (r *gormCommentRepository) Threads(postID uint, offset, limit, perThread int) (*CommentThreads, error) {
+	threads := CommentThreads{Counts: make(map[uint]int64)}
+
+	topLevel := r.db.Model(&model.Comment{}).Where("post_id = ? AND parent_id IS NULL", postID)
+	if err := topLevel.Session(&gorm.Session{}).Count(&threads.Total).Error; err != nil {
+		return nil, err
+	}
+	if err := topLevel.Preload("Author").
+		Order("created_at ASC, id ASC").
+		Offset(offset).
+		Limit(limit).
+		Find(&threads.Roots).Error; err != nil {
+		return nil, err
+	}
+	if len(threads.Roots) == 0 {
+		return &threads, nil
+	}
+
+	rootIDs := make([]uint, 0, len(threads.Roots))
+	for _, root := range threads.Roots {
+		rootIDs = append(rootIDs, root.ID)
+	}
+
+	// the first replies of the selected threads; a parent is older than its
+	// replies, so every reply kept has its parent kept too
+	numbered := r.db.Model(&model.Comment{}).
+		Select("comments.*, ROW_NUMBER() OVER (PARTITION BY root_id ORDER BY created_at ASC, id ASC) AS n").
+		Where("root_id IN ?", rootIDs)
+	if err := r.db.Preload("Author").
+		Table("(?) AS comments", numbered).
+		Where("n <= ?", perThread).
+		Order("created_at ASC, id ASC").
+		Find(&threads.Replies).Error; err != nil {
+		return nil, err
+	}
+
+	var rows []struct {
+		RootID uint
+		Count  int64
+	}
+	if err := r.db.Model(&model.Comment{}).
+		Select("root_id, COUNT(*) AS count").
+		Where("root_id IN ?", rootIDs).
+		Group("root_id").
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		threads.Counts[row.RootID] = row.Count
+	}
+	return &threads, nil
+}
+
+func (r *gormCommentRepository) Replies(rootID uint, offset, limit int) ([]model.Comment, int64, error) {
+	thread := r.db.Model(&model.Comment{}).Where("root_id = ?", rootID)
+
+	var total int64
+	if err := thread.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var replies []model.Comment
+	err := thread.Preload("Author").
+		Order("created_at ASC, id ASC").
+		Offset(offset).
+		Limit(limit).
+		Find(&replies).Error
+	return replies, total, err
+}
+
+//----------------------------------COMMENTS---helpers------------------------------
+
+// ids of the comment and every reply below it
+func commentSubtreeIDs(tx *gorm.DB, comment model.Comment) ([]uint, error) {
+	rootID := comment.ID
+	if comment.RootID != nil {
+		rootID = *comment.RootID
+	}
+
+	var thread []model.Comment
+	if err := tx.Select("id", "parent_id").Where("root_id = ?", rootID).Find(&thread).Error; err != nil {
+		return nil, err
+	}
+
+	children := make(map[uint][]uint)
+	for _, t := range thread {
+		if t.ParentID != nil {
+			children[*t.ParentID] = append(children[*t.ParentID], t.ID)
+		}
+	}
+
+	ids := []uint{comment.ID}
+	for i := 0; i < len(ids); i++ {
+		ids = append(ids, children[ids[i]]...)
+	}
+	return ids, nil
+}
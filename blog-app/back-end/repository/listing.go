@@ -0,0 +1,411 @@
+package repository
+
+import (
+	"gin-blog-app/database"
+	"gin-blog-app/model"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"gorm.io/gorm"
+)
+
+// listing sort orders
+const (
+	SortNewest        = "newest"
+	SortOldest        = "oldest"
+	SortMostCommented = "most_commented"
+)
+
+// highlight markers of search results, private-use runes the caller swaps
+// for markup after escaping the text
+const (
+	MarkStart = "\ue000"
+	MarkStop  = "\ue001"
+)
+
+const snippetLength = 200
+
+// ListParams select one page of a post listing
+type ListParams struct {
+	Limit    int
+	Sort     string
+	After    *ListCursor
+	Author   string
+	Tag      string
+	Category string
+	From     *time.Time
+	To       *time.Time
+	// logged-in caller, zero for anonymous, used for my_reaction
+	ViewerID uint
+	// OwnerID lists one author's posts in every status (their own listing),
+	// otherwise only published posts are listed
+	OwnerID uint
+	Status  string
+}
+
+// ListCursor is the position after the last post of a page
+type ListCursor struct {
+	Sort         string
+	SortAt       time.Time
+	CommentCount int64
+	ID           uint
+}
+
+// ListingRepository reads post listings, search results and the trash
+type ListingRepository interface {
+	// List returns a page of posts with author, category, tags, comment
+	// count and the viewer's reaction, and the cursor of the next page (nil
+	// on the last one)
+	List(p ListParams) ([]model.PostResponse, *ListCursor, error)
+	// Search returns a page of the published posts matching q, best match
+	// first, and the total; highlights are wrapped in MarkStart & MarkStop
+	Search(q string, offset, limit int) ([]model.PostSearchResult, int64, error)
+	// Trash returns a page of an author's trashed posts, most recently
+	// deleted first, and the total
+	Trash(authorID uint, offset, limit int) ([]model.TrashedPostResponse, int64, error)
+}
+
+// GORM backed listings
+type gormListingRepository struct {
+	db *gorm.DB
+}
+
+func NewGormListingRepository(db *gorm.DB) ListingRepository {
+	return &gormListingRepository{db: db}
+}
+
+// one page of posts with author names and comment counts in a single query
+func (r *gormListingRepository) List(p ListParams) ([]model.PostResponse, *ListCursor, error) {
+	inner := r.db.Table("posts").
+		Select(`posts.id, posts.title, posts.content, posts.excerpt, users.username AS author,
+			categories.slug AS category, posts.status, posts.publish_at,
+			posts.created_at, posts.updated_at, posts.like_count, posts.dislike_count, posts.version,
+			`+p.sortAt()+` AS sort_at,
+			(SELECT COUNT(*) FROM comments WHERE comments.post_id = posts.id) AS comment_count,
+			(SELECT reactions.type FROM reactions
+				WHERE reactions.post_id = posts.id AND reactions.user_id = ?) AS my_reaction`, p.ViewerID).
+		Joins("LEFT JOIN users ON users.id = posts.author_id").
+		Joins("LEFT JOIN categories ON categories.id = posts.category_id")
+
+	if p.OwnerID != 0 {
+		inner = inner.Where("posts.author_id = ? AND posts.deleted_at IS NULL", p.OwnerID)
+		if p.Status != "" {
+			inner = inner.Where("posts.status = ?", p.Status)
+		}
+	} else {
+		inner = inner.Scopes(publishedPosts)
+	}
+	if p.Author != "" {
+		inner = inner.Where("users.username = ?", p.Author)
+	}
+	if p.Tag != "" {
+		inner = inner.Where(`EXISTS (SELECT 1 FROM post_tags JOIN tags ON tags.id = post_tags.tag_id
+			WHERE post_tags.post_id = posts.id AND tags.slug = ?)`, p.Tag)
+	}
+	if p.Category != "" {
+		inner = inner.Where("categories.slug = ?", p.Category)
+	}
+	if p.From != nil {
+		inner = inner.Where("posts.created_at >= ?", *p.From)
+	}
+	if p.To != nil {
+		inner = inner.Where("posts.created_at <= ?", *p.To)
+	}
+
+	// wrapped so the keyset can use the computed comment_count
+	query := r.db.Table("(?) AS p", inner)
+
+	switch p.Sort {
+	case SortOldest:
+		if cur := p.After; cur != nil {
+			query = query.Where("p.sort_at > ? OR (p.sort_at = ? AND p.id > ?)", cur.SortAt, cur.SortAt, cur.ID)
+		}
+		query = query.Order("p.sort_at ASC, p.id ASC")
+	case SortMostCommented:
+		if cur := p.After; cur != nil {
+			query = query.Where("p.comment_count < ? OR (p.comment_count = ? AND p.id < ?)", cur.CommentCount, cur.CommentCount, cur.ID)
+		}
+		query = query.Order("p.comment_count DESC, p.id DESC")
+	default:
+		if cur := p.After; cur != nil {
+			query = query.Where("p.sort_at < ? OR (p.sort_at = ? AND p.id < ?)", cur.SortAt, cur.SortAt, cur.ID)
+		}
+		query = query.Order("p.sort_at DESC, p.id DESC")
+	}
+
+	// one extra row tells whether there is a next page
+	posts := make([]model.PostResponse, 0, p.Limit+1)
+	if err := query.Limit(p.Limit + 1).Scan(&posts).Error; err != nil {
+		return nil, nil, err
+	}
+
+	if len(posts) <= p.Limit {
+		return posts, nil, r.attachTags(posts)
+	}
+
+	posts = posts[:p.Limit]
+	if err := r.attachTags(posts); err != nil {
+		return nil, nil, err
+	}
+	last := posts[len(posts)-1]
+	return posts, &ListCursor{
+		Sort:         p.Sort,
+		SortAt:       p.sortAtOf(last),
+		CommentCount: last.CommentCount,
+		ID:           last.ID,
+	}, nil
+}
+
+// postgres uses the weighted tsvector index, other dialects fall back to a
+// case-insensitive LIKE scan
+func (r *gormListingRepository) Search(q string, offset, limit int) ([]model.PostSearchResult, int64, error) {
+	if r.db.Dialector.Name() == "postgres" {
+		return r.searchFullText(q, offset, limit)
+	}
+	return r.searchLike(q, offset, limit)
+}
+
+func (r *gormListingRepository) Trash(authorID uint, offset, limit int) ([]model.TrashedPostResponse, int64, error) {
+	trashed := r.db.Unscoped().Model(&model.Post{}).
+		Where("author_id = ? AND deleted_at IS NOT NULL", authorID)
+
+	var total int64
+	if err := trashed.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var posts []model.TrashedPostResponse
+	err := trashed.Select("id, title, status, deleted_at").
+		Order("deleted_at DESC, id DESC").
+		Offset(offset).
+		Limit(limit).
+		Scan(&posts).Error
+	return posts, total, err
+}
+
+//----------------------------------LISTING---helpers------------------------------
+
+// time the listing is ordered by: public listings go by when a post went
+// public, so a draft published later shows up as new, the owner's listing
+// (drafts and scheduled posts included) by when it was written
+func (p ListParams) sortAt() string {
+	if p.OwnerID != 0 {
+		return "posts.created_at"
+	}
+	return "COALESCE(posts.publish_at, posts.created_at)"
+}
+
+// sortAt of a listed post, for the cursor
+func (p ListParams) sortAtOf(post model.PostResponse) time.Time {
+	if p.OwnerID == 0 && post.PublishAt != nil {
+		return *post.PublishAt
+	}
+	return post.CreatedAt
+}
+
+// fills the tag names of a page of posts with one query
+func (r *gormListingRepository) attachTags(posts []model.PostResponse) error {
+	if len(posts) == 0 {
+		return nil
+	}
+
+	ids := make([]uint, 0, len(posts))
+	for i := range posts {
+		posts[i].Tags = []string{}
+		ids = append(ids, posts[i].ID)
+	}
+
+	var rows []struct {
+		PostID uint
+		Slug   string
+	}
+	if err := r.db.Table("post_tags").
+		Select("post_tags.post_id, tags.slug").
+		Joins("JOIN tags ON tags.id = post_tags.tag_id").
+		Where("post_tags.post_id IN ?", ids).
+		Order("tags.slug ASC").
+		Scan(&rows).Error; err != nil {
+		return err
+	}
+
+	index := make(map[uint]int, len(posts))
+	for i := range posts {
+		index[posts[i].ID] = i
+	}
+	for _, row := range rows {
+		posts[index[row.PostID]].Tags = append(posts[index[row.PostID]].Tags, row.Slug)
+	}
+	return nil
+}
+
+// postgres: ts_rank over the weighted vector, ts_headline for highlighting
+func (r *gormListingRepository) searchFullText(q string, offset, limit int) ([]model.PostSearchResult, int64, error) {
+	match := "(" + database.PostSearchVector + ") @@ websearch_to_tsquery('english', ?)"
+
+	var total int64
+	if err := r.db.Model(&model.Post{}).Scopes(publishedPosts).Where(match, q).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	markers := `StartSel="` + MarkStart + `", StopSel="` + MarkStop + `"`
+	titleOpts := markers + ", HighlightAll=true"
+	snippetOpts := markers + ", MaxFragments=2, MaxWords=30, MinWords=10"
+
+	var results []model.PostSearchResult
+	err := r.db.Raw(`
+		SELECT posts.id, posts.title, posts.created_at, users.username AS author,
+			ts_rank(`+database.PostSearchVector+`, query) AS rank,
+			ts_headline('english', posts.title, query, ?) AS title_highlight,
+			ts_headline('english', posts.content, query, ?) AS snippet
+		FROM posts
+		LEFT JOIN users ON users.id = posts.author_id
+		CROSS JOIN websearch_to_tsquery('english', ?) AS query
+		WHERE (`+database.PostSearchVector+`) @@ query AND posts.status = ? AND posts.deleted_at IS NULL
+		ORDER BY rank DESC, posts.id DESC
+		LIMIT ? OFFSET ?`,
+		titleOpts, snippetOpts, q, model.PostPublished, limit, offset,
+	).Scan(&results).Error
+
+	return results, total, err
+}
+
+// other dialects (sqlite in tests): every term must appear in title or
+// content, title hits weigh double, highlighting is done in Go
+func (r *gormListingRepository) searchLike(q string, offset, limit int) ([]model.PostSearchResult, int64, error) {
+	terms := strings.Fields(strings.ToLower(q))
+
+	query := r.db.Table("posts").Joins("LEFT JOIN users ON users.id = posts.author_id").Scopes(publishedPosts)
+	rank := make([]string, 0, 2*len(terms))
+	rankArgs := make([]interface{}, 0, 2*len(terms))
+	for _, t := range terms {
+		pattern := "%" + escapeLike(t) + "%"
+		query = query.Where(`(LOWER(posts.title) LIKE ? ESCAPE '\' OR LOWER(posts.content) LIKE ? ESCAPE '\')`, pattern, pattern)
+		rank = append(rank,
+			`CASE WHEN LOWER(posts.title) LIKE ? ESCAPE '\' THEN 2 ELSE 0 END`,
+			`CASE WHEN LOWER(posts.content) LIKE ? ESCAPE '\' THEN 1 ELSE 0 END`)
+		rankArgs = append(rankArgs, pattern, pattern)
+	}
+
+	var total int64
+	if err := query.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var rows []struct {
+		model.PostSearchResult
+		Content string
+	}
+	err := query.
+		Select("posts.id, posts.title, posts.content, posts.created_at, users.username AS author, ("+
+			strings.Join(rank, " + ")+") AS rank", rankArgs...).
+		Order("rank DESC, posts.id DESC").
+		Limit(limit).
+		Offset(offset).
+		Scan(&rows).Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	results := make([]model.PostSearchResult, 0, len(rows))
+	for _, row := range rows {
+		row.TitleHighlight = markTerms(row.Title, terms)
+		row.Snippet = markTerms(snippetAround(row.Content, terms), terms)
+		results = append(results, row.PostSearchResult)
+	}
+	return results, total, nil
+}
+
+// escapes LIKE wildcards, '\' is declared as the escape character
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// wraps case-insensitive occurrences of the terms in highlight markers
+func markTerms(text string, terms []string) string {
+	lower := strings.ToLower(text)
+	if len(lower) != len(text) {
+		// lower-casing changed byte offsets, leave unmarked
+		return text
+	}
+
+	hit := make([]bool, len(text))
+	for _, t := range terms {
+		for from := 0; ; {
+			i := strings.Index(lower[from:], t)
+			if i < 0 {
+				break
+			}
+			for j := from + i; j < from+i+len(t); j++ {
+				hit[j] = true
+			}
+			from += i + len(t)
+		}
+	}
+
+	var b strings.Builder
+	inMark := false
+	for i := 0; i < len(text); i++ {
+		if hit[i] != inMark {
+			if hit[i] {
+				b.WriteString(MarkStart)
+			} else {
+				b.WriteString(MarkStop)
+			}
+			inMark = hit[i]
+		}
+		b.WriteByte(text[i])
+	}
+	if inMark {
+		b.WriteString(MarkStop)
+	}
+	return b.String()
+}
+
+// a window of the content around the first matching term
+func snippetAround(content string, terms []string) string {
+	if len(content) <= snippetLength {
+		return content
+	}
+
+	lower := strings.ToLower(content)
+	first := -1
+	for _, t := range terms {
+		if i := strings.Index(lower, t); i >= 0 && (first < 0 || i < first) {
+			first = i
+		}
+	}
+
+	start := 0
+	if first > snippetLength/4 {
+		start = first - snippetLength/4
+	}
+	end := start + snippetLength
+	if end > len(content) {
+		end = len(content)
+	}
+
+	// keep whole runes
+	for start > 0 && !utf8.RuneStart(content[start]) {
+		start--
+	}
+	for end < len(content) && !utf8.RuneStart(content[end]) {
+		end++
+	}
+
+	snippet := content[start:end]
+	if start > 0 {
+		snippet = "…" + snippet
+	}
+	if end < len(content) {
+		snippet += "…"
+	}
+	return snippet
+}
+
+// scope limiting a posts query to what the public may see
+// trashed posts are spelled out for queries on Table("posts"), which skip
+// gorm's soft delete filter
+func publishedPosts(db *gorm.DB) *gorm.DB {
+	return db.Where("posts.status = ? AND posts.deleted_at IS NULL", model.PostPublished)
+}
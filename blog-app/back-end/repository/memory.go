@@ -0,0 +1,531 @@
+package repository
+
+import (
+	"errors"
+	"gin-blog-app/model"
+	"gin-blog-app/rbac"
+	"gin-blog-app/utils"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// in-memory repositories, for tests: no uploads are kept, revisions have no
+// editor loaded and unique columns are the only constraints checked
+
+var errDuplicate = errors.New("duplicate key")
+
+//----------------------------------USERS------------------------------------------
+
+type memoryUserRepository struct {
+	mu          sync.Mutex
+	users       map[uint]model.User
+	resetTokens map[uint]model.PasswordResetToken
+	nextID      uint
+}
+
+func NewMemoryUserRepository() UserRepository {
+	return &memoryUserRepository{users: make(map[uint]model.User), resetTokens: make(map[uint]model.PasswordResetToken)}
+}
+
+func (r *memoryUserRepository) FindByID(id uint) (*model.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	user, ok := r.users[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &user, nil
+}
+
+func (r *memoryUserRepository) FindByUsername(username string) (*model.User, error) {
+	return r.find(func(u model.User) bool { return u.Username == username })
+}
+
+func (r *memoryUserRepository) FindByEmail(email string) (*model.User, error) {
+	return r.find(func(u model.User) bool { return u.Email != nil && *u.Email == email })
+}
+
+func (r *memoryUserRepository) Create(user *model.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, u := range r.users {
+		if u.Username == user.Username || (u.Email != nil && user.Email != nil && *u.Email == *user.Email) {
+			return errDuplicate
+		}
+	}
+	r.nextID++
+	user.ID = r.nextID
+	if user.Role == "" {
+		user.Role = rbac.RoleUser
+	}
+	r.users[user.ID] = *user
+	return nil
+}
+
+func (r *memoryUserRepository) UpdatePassword(id uint, hashedPassword string) error {
+	return r.update(id, func(u *model.User) { u.HashedPassword = hashedPassword })
+}
+
+func (r *memoryUserRepository) UpdateRole(id uint, role string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	user, ok := r.users[id]
+	if !ok {
+		return ErrNotFound
+	}
+	if user.Role == rbac.RoleAdmin && role != rbac.RoleAdmin {
+		admins := 0
+		for _, u := range r.users {
+			if u.Role == rbac.RoleAdmin {
+				admins++
+			}
+		}
+		if admins == 1 {
+			return ErrLastAdmin
+		}
+	}
+	user.Role = role
+	r.users[id] = user
+	return nil
+}
+
+func (r *memoryUserRepository) CountByRole(role string) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var count int64
+	for _, u := range r.users {
+		if u.Role == role {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (r *memoryUserRepository) List(offset, limit int) ([]model.User, int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	users := make([]model.User, 0, len(r.users))
+	for _, u := range r.users {
+		users = append(users, u)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+	return page(users, offset, limit), int64(len(users)), nil
+}
+
+func (r *memoryUserRepository) CreateResetToken(rt *model.PasswordResetToken) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for id, t := range r.resetTokens {
+		if t.UserID == rt.UserID && t.UsedAt == nil {
+			delete(r.resetTokens, id)
+		}
+	}
+	r.nextID++
+	rt.ID = r.nextID
+	rt.CreatedAt = time.Now()
+	r.resetTokens[rt.ID] = *rt
+	return nil
+}
+
+func (r *memoryUserRepository) FindResetToken(tokenHash string, now time.Time) (*model.PasswordResetToken, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, t := range r.resetTokens {
+		if t.TokenHash == tokenHash && t.UsedAt == nil && t.ExpiresAt.After(now) {
+			return &t, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (r *memoryUserRepository) ResetPassword(rt model.PasswordResetToken, hashedPassword string, now time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored, ok := r.resetTokens[rt.ID]
+	user, found := r.users[stored.UserID]
+	if !ok || stored.UsedAt != nil || !found {
+		return ErrNotFound
+	}
+	stored.UsedAt = &now
+	r.resetTokens[rt.ID] = stored
+	user.HashedPassword = hashedPassword
+	r.users[user.ID] = user
+	return nil
+}
+
+func (r *memoryUserRepository) find(match func(model.User) bool) (*model.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, u := range r.users {
+		if match(u) {
+			return &u, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (r *memoryUserRepository) update(id uint, change func(*model.User)) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	user, ok := r.users[id]
+	if !ok {
+		return ErrNotFound
+	}
+	change(&user)
+	r.users[id] = user
+	return nil
+}
+
+//----------------------------------POSTS------------------------------------------
+
+type memoryPostRepository struct {
+	mu         sync.Mutex
+	posts      map[uint]model.Post
+	categories map[string]model.Category
+	tags       map[string]model.Tag
+	revisions  map[uint][]model.PostRevision // by post, oldest first
+	nextID     uint
+}
+
+// NewMemoryPostRepository knows the given categories only, listing any
+// upload on a post fails with ErrUnknownUpload
+func NewMemoryPostRepository(categories ...model.Category) PostRepository {
+	r := &memoryPostRepository{
+		posts:      make(map[uint]model.Post),
+		categories: make(map[string]model.Category),
+		tags:       make(map[string]model.Tag),
+		revisions:  make(map[uint][]model.PostRevision),
+	}
+	for i, cat := range categories {
+		if cat.ID == 0 {
+			cat.ID = uint(i + 1)
+		}
+		r.categories[cat.Slug] = cat
+	}
+	return r
+}
+
+func (r *memoryPostRepository) FindByID(id uint) (*model.Post, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	post, ok := r.posts[id]
+	if !ok || post.DeletedAt.Valid {
+		return nil, ErrNotFound
+	}
+	return clonePost(post), nil
+}
+
+func (r *memoryPostRepository) Create(post *model.Post, rel PostRelations) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored := *post
+	if err := r.applyRelations(&stored, rel); err != nil {
+		return err
+	}
+	r.nextID++
+	stored.ID = r.nextID
+	if stored.Version == 0 {
+		stored.Version = 1
+	}
+	stored.UpdatedAt = time.Now()
+	r.posts[stored.ID] = stored
+	r.recordRevision(stored, stored.AuthorID, nil)
+	*post = *clonePost(stored)
+	return nil
+}
+
+func (r *memoryPostRepository) Update(id uint, change PostChange, versions []int64, editorID uint) (*model.Post, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored, ok := r.posts[id]
+	if !ok || stored.DeletedAt.Valid {
+		return nil, ErrNotFound
+	}
+	if versions != nil && !slices.Contains(versions, stored.Version) {
+		return clonePost(stored), ErrVersionMismatch
+	}
+
+	post := *clonePost(stored)
+	rel, err := change(&post)
+	if err != nil {
+		return nil, err
+	}
+	changed := post.Title != stored.Title || post.Content != stored.Content
+	stored.Title, stored.Content = post.Title, post.Content
+	stored.ContentHTML, stored.Excerpt = post.ContentHTML, post.Excerpt
+	stored.Status, stored.PublishAt = post.Status, post.PublishAt
+	if err := r.applyRelations(&stored, rel); err != nil {
+		return nil, err
+	}
+	stored.Version++
+	stored.UpdatedAt = time.Now()
+	r.posts[stored.ID] = stored
+	if changed || rel.RestoredFrom != nil {
+		r.recordRevision(stored, editorID, rel.RestoredFrom)
+	}
+	return clonePost(stored), nil
+}
+
+func (r *memoryPostRepository) Delete(id uint) error {
+	return r.setDeleted(id, false, gorm.DeletedAt{Time: time.Now(), Valid: true})
+}
+
+func (r *memoryPostRepository) FindTrashed(id uint) (*model.Post, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	post, ok := r.posts[id]
+	if !ok || !post.DeletedAt.Valid {
+		return nil, ErrNotFound
+	}
+	return clonePost(post), nil
+}
+
+func (r *memoryPostRepository) Restore(id uint) error {
+	return r.setDeleted(id, true, gorm.DeletedAt{})
+}
+
+func (r *memoryPostRepository) FindRevision(postID uint, rev int) (*model.PostRevision, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, revision := range r.revisions[postID] {
+		if revision.Rev == rev {
+			return &revision, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (r *memoryPostRepository) LatestRevision(postID uint) (*model.PostRevision, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	list := r.revisions[postID]
+	if len(list) == 0 {
+		return nil, ErrNotFound
+	}
+	latest := list[len(list)-1]
+	return &latest, nil
+}
+
+func (r *memoryPostRepository) ListRevisions(postID uint) ([]model.PostRevision, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	list := r.revisions[postID]
+	revisions := make([]model.PostRevision, 0, len(list))
+	for i := len(list) - 1; i >= 0; i-- {
+		revision := list[i]
+		revision.Content = ""
+		revisions = append(revisions, revision)
+	}
+	return revisions, nil
+}
+
+func (r *memoryPostRepository) recordRevision(post model.Post, editorID uint, restoredFrom *int) {
+	list := r.revisions[post.ID]
+	r.revisions[post.ID] = append(list, model.PostRevision{
+		ID:           uint(len(list) + 1),
+		PostID:       post.ID,
+		Rev:          len(list) + 1,
+		Title:        post.Title,
+		Content:      post.Content,
+		EditorID:     editorID,
+		RestoredFrom: restoredFrom,
+		CreatedAt:    time.Now(),
+	})
+}
+
+func (r *memoryPostRepository) setDeleted(id uint, trashed bool, deletedAt gorm.DeletedAt) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	post, ok := r.posts[id]
+	if !ok || post.DeletedAt.Valid != trashed {
+		return ErrNotFound
+	}
+	post.DeletedAt = deletedAt
+	r.posts[id] = post
+	return nil
+}
+
+// validates and applies the relations before anything is stored, so a
+// failed write changes nothing
+func (r *memoryPostRepository) applyRelations(post *model.Post, rel PostRelations) error {
+	if rel.Uploads.Set && len(rel.Uploads.Value) > 0 {
+		return ErrUnknownUpload
+	}
+
+	if rel.Category.Set {
+		post.CategoryID, post.Category = nil, nil
+		if slug := strings.TrimSpace(rel.Category.Value); slug != "" {
+			cat, ok := r.categories[slug]
+			if !ok {
+				return ErrUnknownCategory
+			}
+			post.CategoryID, post.Category = &cat.ID, &cat
+		}
+	}
+
+	if rel.Tags.Set {
+		tags := make([]model.Tag, 0, len(rel.Tags.Value))
+		for _, t := range rel.Tags.Value {
+			existing, ok := r.tags[t.Slug]
+			if !ok {
+				existing = model.Tag{ID: uint(len(r.tags) + 1), Name: t.Name, Slug: t.Slug}
+				r.tags[t.Slug] = existing
+			}
+			tags = append(tags, existing)
+		}
+		post.Tags = tags
+	}
+	return nil
+}
+
+// copy that shares no slice or pointer with the stored post
+func clonePost(post model.Post) *model.Post {
+	post.Tags = slices.Clone(post.Tags)
+	if post.Category != nil {
+		cat := *post.Category
+		post.Category = &cat
+	}
+	return &post
+}
+
+//----------------------------------SESSIONS------------------------------------------
+
+type memorySessionRepository struct {
+	mu       sync.Mutex
+	users    UserRepository
+	sessions map[uint]model.Session
+	nextID   uint
+}
+
+// NewMemorySessionRepository loads the user of a session from users
+func NewMemorySessionRepository(users UserRepository) SessionRepository {
+	return &memorySessionRepository{users: users, sessions: make(map[uint]model.Session)}
+}
+
+func (r *memorySessionRepository) Create(token string, sess *model.Session) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.nextID++
+	sess.ID = r.nextID
+	sess.TokenHash = utils.HashToken(token)
+	if sess.CreatedAt.IsZero() {
+		sess.CreatedAt = time.Now()
+	}
+	r.sessions[sess.ID] = *sess
+	return nil
+}
+
+func (r *memorySessionRepository) FindByToken(token string) (*model.Session, error) {
+	r.mu.Lock()
+	hash, now := utils.HashToken(token), time.Now()
+	var (
+		sess  model.Session
+		found bool
+	)
+	for _, s := range r.sessions {
+		if s.TokenHash == hash && sessionAlive(s, now) {
+			sess, found = s, true
+			break
+		}
+	}
+	r.mu.Unlock()
+	if !found {
+		return nil, ErrNotFound
+	}
+
+	user, err := r.users.FindByID(sess.UserID)
+	if err != nil {
+		return nil, err
+	}
+	sess.User = *user
+	return &sess, nil
+}
+
+func (r *memorySessionRepository) Touch(id uint, lastSeen, idleExpiresAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if sess, ok := r.sessions[id]; ok {
+		sess.LastSeenAt, sess.IdleExpiresAt = lastSeen, idleExpiresAt
+		r.sessions[id] = sess
+	}
+	return nil
+}
+
+func (r *memorySessionRepository) RotateCSRF(id uint, csrfToken string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if sess, ok := r.sessions[id]; ok {
+		sess.CSRFToken = csrfToken
+		r.sessions[id] = sess
+	}
+	return nil
+}
+
+func (r *memorySessionRepository) ListByUser(userID uint) ([]model.Session, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	var sessions []model.Session
+	for _, s := range r.sessions {
+		if s.UserID == userID && sessionAlive(s, now) {
+			sessions = append(sessions, s)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].LastSeenAt.After(sessions[j].LastSeenAt) })
+	return sessions, nil
+}
+
+func (r *memorySessionRepository) Revoke(userID, sessionID uint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if sess, ok := r.sessions[sessionID]; !ok || sess.UserID != userID {
+		return ErrNotFound
+	}
+	delete(r.sessions, sessionID)
+	return nil
+}
+
+func (r *memorySessionRepository) RevokeAll(userID uint) error {
+	return r.RevokeOthers(userID, 0)
+}
+
+func (r *memorySessionRepository) RevokeOthers(userID, keepID uint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for id, s := range r.sessions {
+		if s.UserID == userID && id != keepID {
+			delete(r.sessions, id)
+		}
+	}
+	return nil
+}
+
+func (r *memorySessionRepository) DeleteExpired(now time.Time) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var n int64
+	for id, s := range r.sessions {
+		if !sessionAlive(s, now) {
+			delete(r.sessions, id)
+			n++
+		}
+	}
+	return n, nil
+}
+
+func sessionAlive(s model.Session, now time.Time) bool {
+	return s.ExpiresAt.After(now) && s.IdleExpiresAt.After(now)
+}
+
+// offset/limit window of a list
+func page[T any](items []T, offset, limit int) []T {
+	if offset >= len(items) {
+		return []T{}
+	}
+	return items[offset:min(offset+limit, len(items))]
+}
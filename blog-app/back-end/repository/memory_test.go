@@ -0,0 +1,56 @@
+package repository
+
+import (
+	"errors"
+	"gin-blog-app/model"
+	"testing"
+	"time"
+)
+
+func TestMemorySessions(t *testing.T) {
+	users := NewMemoryUserRepository()
+	alice := model.User{Username: "alice1", HashedPassword: "x"}
+	if err := users.Create(&alice); err != nil {
+		t.Fatal(err)
+	}
+	sessions := NewMemorySessionRepository(users)
+
+	now := time.Now()
+	newSession := func(token string, idle time.Duration) model.Session {
+		s := model.Session{UserID: alice.ID, LastSeenAt: now, ExpiresAt: now.Add(time.Hour), IdleExpiresAt: now.Add(idle)}
+		if err := sessions.Create(token, &s); err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+	laptop := newSession("laptop", time.Hour)
+	phone := newSession("phone", time.Hour)
+	newSession("stale", -time.Minute)
+
+	got, err := sessions.FindByToken("laptop")
+	if err != nil || got.ID != laptop.ID || got.User.Username != "alice1" || got.TokenHash == "laptop" {
+		t.Fatalf("FindByToken: %+v, %v", got, err)
+	}
+	if _, err := sessions.FindByToken("stale"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("idle session found: %v", err)
+	}
+	if list, _ := sessions.ListByUser(alice.ID); len(list) != 2 {
+		t.Errorf("listed %d sessions, want 2", len(list))
+	}
+
+	if n, _ := sessions.DeleteExpired(now); n != 1 {
+		t.Errorf("purged %d sessions, want 1", n)
+	}
+	if err := sessions.Revoke(alice.ID+1, phone.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("revoking another user's session: %v", err)
+	}
+	if err := sessions.RevokeOthers(alice.ID, laptop.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sessions.FindByToken("phone"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("revoked session found: %v", err)
+	}
+	if _, err := sessions.FindByToken("laptop"); err != nil {
+		t.Errorf("kept session: %v", err)
+	}
+}
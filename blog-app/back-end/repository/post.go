@@ -0,0 +1,320 @@
+package repository
+
+import (
+	"errors"
+	"gin-blog-app/model"
+	"slices"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// GORM backed posts
+type gormPostRepository struct {
+	db *gorm.DB
+}
+
+func NewGormPostRepository(db *gorm.DB) PostRepository {
+	return &gormPostRepository{db: db}
+}
+
+func (r *gormPostRepository) FindByID(id uint) (*model.Post, error) {
+	var post model.Post
+	if err := r.db.Preload("Category").Preload("Tags").First(&post, id).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &post, nil
+}
+
+func (r *gormPostRepository) Create(post *model.Post, rel PostRelations) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if rel.Category.Set {
+			categoryID, err := resolveCategory(tx, rel.Category.Value)
+			if err != nil {
+				return err
+			}
+			post.CategoryID = categoryID
+		}
+
+		if rel.Tags.Set {
+			tags, err := ensureTags(tx, rel.Tags.Value)
+			if err != nil {
+				return err
+			}
+			post.Tags = tags
+		}
+
+		// tags already exist, only link them
+		if err := tx.Omit("Tags.*").Create(post).Error; err != nil {
+			return err
+		}
+		if rel.Uploads.Set {
+			if err := attachUploads(tx, *post, rel.Uploads.Value); err != nil {
+				return err
+			}
+		}
+
+		_, err := RecordRevision(tx, *post, post.AuthorID, nil)
+		return err
+	})
+}
+
+func (r *gormPostRepository) Update(id uint, change PostChange, versions []int64, editorID uint) (*model.Post, error) {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		// the change is applied to the row as it is under the lock, so a
+		// concurrent edit of other fields is kept; the revision is numbered
+		// from it too
+		var before model.Post
+		if err := LockForUpdate(tx).First(&before, id).Error; err != nil {
+			return notFound(err)
+		}
+		if versions != nil && !slices.Contains(versions, before.Version) {
+			return ErrVersionMismatch
+		}
+
+		post := before
+		rel, err := change(&post)
+		if err != nil {
+			return err
+		}
+		if err := ensureBaseRevision(tx, before); err != nil {
+			return err
+		}
+
+		// only if the row is still the one read (sqlite has no row lock); a
+		// map so an emptied content is written too
+		res := tx.Model(&model.Post{}).Where("id = ? AND version = ?", id, before.Version).Updates(map[string]interface{}{
+			"title":        post.Title,
+			"content":      post.Content,
+			"content_html": post.ContentHTML,
+			"excerpt":      post.Excerpt,
+			"status":       post.Status,
+			"publish_at":   post.PublishAt,
+			"version":      gorm.Expr("version + 1"),
+		})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrVersionMismatch
+		}
+
+		// title or content changed, or a revision put back: new revision
+		if post.Title != before.Title || post.Content != before.Content || rel.RestoredFrom != nil {
+			if _, err := RecordRevision(tx, post, editorID, rel.RestoredFrom); err != nil {
+				return err
+			}
+		}
+
+		// "" removes the category
+		if rel.Category.Set {
+			categoryID, err := resolveCategory(tx, rel.Category.Value)
+			if err != nil {
+				return err
+			}
+			if err := tx.Model(&model.Post{}).Where("id = ?", id).Update("category_id", categoryID).Error; err != nil {
+				return err
+			}
+		}
+
+		if rel.Tags.Set {
+			tags, err := ensureTags(tx, rel.Tags.Value)
+			if err != nil {
+				return err
+			}
+			if err := tx.Model(&model.Post{ID: id}).Omit("Tags.*").Association("Tags").Replace(tags); err != nil {
+				return err
+			}
+		}
+
+		if rel.Uploads.Set {
+			return attachUploads(tx, before, rel.Uploads.Value)
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, ErrVersionMismatch) {
+		return nil, err
+	}
+
+	// saved, or the current one the caller's version didn't match
+	saved, findErr := r.FindByID(id)
+	if findErr != nil {
+		return nil, findErr
+	}
+	return saved, err
+}
+
+func (r *gormPostRepository) Delete(id uint) error {
+	res := r.db.Delete(&model.Post{}, id)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *gormPostRepository) FindTrashed(id uint) (*model.Post, error) {
+	var post model.Post
+	if err := r.db.Unscoped().Where("deleted_at IS NOT NULL").First(&post, id).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &post, nil
+}
+
+func (r *gormPostRepository) Restore(id uint) error {
+	res := r.db.Unscoped().Model(&model.Post{}).
+		Where("id = ? AND deleted_at IS NOT NULL", id).
+		Update("deleted_at", nil)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *gormPostRepository) FindRevision(postID uint, rev int) (*model.PostRevision, error) {
+	var revision model.PostRevision
+	if err := r.db.Preload("Editor").Where("post_id = ? AND rev = ?", postID, rev).First(&revision).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &revision, nil
+}
+
+func (r *gormPostRepository) LatestRevision(postID uint) (*model.PostRevision, error) {
+	var revision model.PostRevision
+	if err := r.db.Preload("Editor").Where("post_id = ?", postID).Order("rev DESC").First(&revision).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &revision, nil
+}
+
+func (r *gormPostRepository) ListRevisions(postID uint) ([]model.PostRevision, error) {
+	var revisions []model.PostRevision
+	err := r.db.Preload("Editor").
+		Select("id", "post_id", "rev", "title", "editor_id", "restored_from", "created_at").
+		Where("post_id = ?", postID).
+		Order("rev DESC").
+		Find(&revisions).Error
+	return revisions, err
+}
+
+//----------------------------------POSTS---helpers------------------------------
+
+// the given tags, missing ones are created
+func ensureTags(tx *gorm.DB, tags []model.Tag) ([]model.Tag, error) {
+	if len(tags) == 0 {
+		return []model.Tag{}, nil
+	}
+
+	// create what is missing, a concurrent insert of the same slug is fine
+	missing := make([]model.Tag, 0, len(tags))
+	slugs := make([]string, 0, len(tags))
+	for _, t := range tags {
+		missing = append(missing, model.Tag{Name: t.Name, Slug: t.Slug})
+		slugs = append(slugs, t.Slug)
+	}
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&missing).Error; err != nil {
+		return nil, err
+	}
+
+	var existing []model.Tag
+	if err := tx.Where("slug IN ?", slugs).Find(&existing).Error; err != nil {
+		return nil, err
+	}
+	return existing, nil
+}
+
+// category id for a slug, nil for an empty slug
+func resolveCategory(tx *gorm.DB, slug string) (*uint, error) {
+	slug = strings.TrimSpace(slug)
+	if slug == "" {
+		return nil, nil
+	}
+
+	var category model.Category
+	if err := tx.Where("slug = ?", slug).First(&category).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUnknownCategory
+		}
+		return nil, err
+	}
+	return &category.ID, nil
+}
+
+// attaches the listed uploads to a post and detaches the ones not listed,
+// detached uploads become orphans for the cleanup job
+func attachUploads(tx *gorm.DB, post model.Post, ids []uint) error {
+	unique := make(map[uint]bool, len(ids))
+	for _, id := range ids {
+		unique[id] = true
+	}
+
+	detach := tx.Model(&model.Upload{}).Where("post_id = ?", post.ID)
+	if len(ids) > 0 {
+		detach = detach.Where("id NOT IN ?", ids)
+	}
+	if err := detach.Update("post_id", nil).Error; err != nil {
+		return err
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	res := tx.Model(&model.Upload{}).
+		Where("id IN ? AND owner_id = ? AND (post_id IS NULL OR post_id = ?)", ids, post.AuthorID, post.ID).
+		Update("post_id", post.ID)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected != int64(len(unique)) {
+		return ErrUnknownUpload
+	}
+	return nil
+}
+
+// RecordRevision stores the post's current title and content as its next
+// revision. Callers hold the post row (locked or just written) inside tx,
+// which keeps concurrent edits from picking the same number.
+func RecordRevision(tx *gorm.DB, post model.Post, editorID uint, restoredFrom *int) (model.PostRevision, error) {
+	var last int
+	if err := tx.Model(&model.PostRevision{}).Where("post_id = ?", post.ID).
+		Select("COALESCE(MAX(rev), 0)").Scan(&last).Error; err != nil {
+		return model.PostRevision{}, err
+	}
+
+	revision := model.PostRevision{
+		PostID:       post.ID,
+		Rev:          last + 1,
+		Title:        post.Title,
+		Content:      post.Content,
+		EditorID:     editorID,
+		RestoredFrom: restoredFrom,
+	}
+	return revision, tx.Omit("Post", "Editor").Create(&revision).Error
+}
+
+// posts written before revisions existed get their current state as rev 1
+// before the first edit, so that state is not lost
+func ensureBaseRevision(tx *gorm.DB, post model.Post) error {
+	var count int64
+	if err := tx.Model(&model.PostRevision{}).Where("post_id = ?", post.ID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+
+	return tx.Omit("Post", "Editor").Create(&model.PostRevision{
+		PostID:    post.ID,
+		Rev:       1,
+		Title:     post.Title,
+		Content:   post.Content,
+		EditorID:  post.AuthorID,
+		CreatedAt: post.UpdatedAt,
+	}).Error
+}
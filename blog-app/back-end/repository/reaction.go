@@ -0,0 +1,129 @@
+package repository
+
+import (
+	"errors"
+	"gin-blog-app/model"
+
+	"gorm.io/gorm"
+)
+
+// reaction types and the post column counting them
+var reactionCounters = map[string]string{
+	"like":    "like_count",
+	"dislike": "dislike_count",
+}
+
+// ReactionCounts are the reaction counters of a post
+type ReactionCounts struct {
+	LikeCount    int64
+	DislikeCount int64
+}
+
+// ReactionRepository stores the likes and dislikes of users on posts
+type ReactionRepository interface {
+	// Find returns a user's reaction to a post
+	Find(userID, postID uint) (*model.Reaction, error)
+	// Set sets (or switches) a user's reaction on a published post and
+	// returns the post's counters, ErrNotFound when the post isn't published
+	Set(userID, postID uint, reactionType string) (ReactionCounts, error)
+	// Remove takes a user's reaction off a published post, if there is one,
+	// and returns the post's counters
+	Remove(userID, postID uint) (ReactionCounts, error)
+}
+
+// GORM backed reactions, the counters on the post are kept in step
+type gormReactionRepository struct {
+	db *gorm.DB
+}
+
+func NewGormReactionRepository(db *gorm.DB) ReactionRepository {
+	return &gormReactionRepository{db: db}
+}
+
+func (r *gormReactionRepository) Find(userID, postID uint) (*model.Reaction, error) {
+	var reaction model.Reaction
+	if err := r.db.Where("user_id = ? AND post_id = ?", userID, postID).First(&reaction).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &reaction, nil
+}
+
+func (r *gormReactionRepository) Set(userID, postID uint, reactionType string) (ReactionCounts, error) {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		// the post row lock serialises toggles on one post
+		var post model.Post
+		if err := LockForUpdate(tx).Scopes(publishedPosts).First(&post, postID).Error; err != nil {
+			return err
+		}
+
+		var existing model.Reaction
+		err := tx.Where("user_id = ? AND post_id = ?", userID, post.ID).First(&existing).Error
+		switch {
+		case err == nil:
+			if existing.Type == reactionType {
+				return nil
+			}
+			// Update writes the new type into existing, keep the old one
+			previous := existing.Type
+			if err := tx.Model(&existing).Update("type", reactionType).Error; err != nil {
+				return err
+			}
+			if err := bumpReactionCounter(tx, post.ID, previous, -1); err != nil {
+				return err
+			}
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			if err := tx.Create(&model.Reaction{UserID: userID, PostID: post.ID, Type: reactionType}).Error; err != nil {
+				return err
+			}
+		default:
+			return err
+		}
+
+		return bumpReactionCounter(tx, post.ID, reactionType, 1)
+	})
+	if err != nil {
+		return ReactionCounts{}, notFound(err)
+	}
+	return r.counts(postID)
+}
+
+func (r *gormReactionRepository) Remove(userID, postID uint) (ReactionCounts, error) {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var post model.Post
+		if err := LockForUpdate(tx).Scopes(publishedPosts).First(&post, postID).Error; err != nil {
+			return err
+		}
+
+		var existing model.Reaction
+		if err := tx.Where("user_id = ? AND post_id = ?", userID, post.ID).First(&existing).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil // nothing to remove
+			}
+			return err
+		}
+
+		if err := tx.Delete(&existing).Error; err != nil {
+			return err
+		}
+		return bumpReactionCounter(tx, post.ID, existing.Type, -1)
+	})
+	if err != nil {
+		return ReactionCounts{}, notFound(err)
+	}
+	return r.counts(postID)
+}
+
+//----------------------------------REACTIONS---helpers------------------------------
+
+func bumpReactionCounter(tx *gorm.DB, postID uint, reactionType string, delta int) error {
+	column := reactionCounters[reactionType]
+	return tx.Model(&model.Post{}).Where("id = ?", postID).
+		UpdateColumn(column, gorm.Expr(column+" + ?", delta)).Error
+}
+
+func (r *gormReactionRepository) counts(postID uint) (ReactionCounts, error) {
+	var counts ReactionCounts
+	err := r.db.Model(&model.Post{}).Select("like_count", "dislike_count").
+		Where("id = ?", postID).Scan(&counts).Error
+	return counts, err
+}
@@ -0,0 +1,171 @@
+// Package repository reads and writes the blog's records. Every repository
+// has a GORM implementation used by the server; users, posts and sessions
+// also have an in-memory one (memory.go) for tests that should not need a
+// database, the query-heavy rest (comments, reactions, tags, uploads and
+// listings) is tested end to end against sqlite.
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"gin-blog-app/model"
+	"strconv"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	// ErrNotFound is returned when no (live) record matches
+	ErrNotFound = errors.New("record not found")
+	// ErrVersionMismatch is returned by PostRepository.Update when the stored
+	// version is not one the caller accepts
+	ErrVersionMismatch = errors.New("post was changed in the meantime, reload it and retry")
+	// ErrUnknownCategory is returned for a category slug that doesn't exist
+	ErrUnknownCategory = errors.New("unknown category")
+	// ErrUnknownUpload is returned when a listed upload can't be attached
+	ErrUnknownUpload = errors.New("uploads must exist, belong to the post author and not be attached to another post")
+	// ErrLastAdmin is returned by UserRepository.UpdateRole for a change that
+	// would leave no admin
+	ErrLastAdmin = errors.New("cannot remove the last admin")
+)
+
+// UserRepository stores the accounts
+type UserRepository interface {
+	FindByID(id uint) (*model.User, error)
+	FindByUsername(username string) (*model.User, error)
+	FindByEmail(email string) (*model.User, error)
+	Create(user *model.User) error
+	UpdatePassword(id uint, hashedPassword string) error
+	// UpdateRole sets the role of a user, ErrLastAdmin when that demotes the
+	// only admin; the admins are locked while they are counted, so two
+	// concurrent demotions can't both pass
+	UpdateRole(id uint, role string) error
+	// CountByRole returns how many users hold a role
+	CountByRole(role string) (int64, error)
+	// List returns a page of users ordered by id and the total count
+	List(offset, limit int) ([]model.User, int64, error)
+	// CreateResetToken stores a password reset token and drops the user's
+	// unused ones, only the latest link works
+	CreateResetToken(rt *model.PasswordResetToken) error
+	// FindResetToken returns the unused, unexpired reset token of a hash
+	FindResetToken(tokenHash string, now time.Time) (*model.PasswordResetToken, error)
+	// ResetPassword spends a reset token and sets the password of its user,
+	// ErrNotFound when the token was spent in the meantime
+	ResetPassword(rt model.PasswordResetToken, hashedPassword string, now time.Time) error
+}
+
+// PostRelations are the links written together with a post, the ones
+// that are not Set stay as they are
+type PostRelations struct {
+	Category model.Patch[string]      // slug, empty removes the category
+	Tags     model.Patch[[]model.Tag] // matched by slug, missing tags are created
+	Uploads  model.Patch[[]uint]      // the author's uploads, the unlisted ones are detached
+	// revision an Update puts back, the new revision records it and is
+	// written even when title and content are unchanged
+	RestoredFrom *int
+}
+
+// PostChange edits a post as it is stored at the time of the write (under
+// the row lock) and returns the relations to change with it
+type PostChange func(post *model.Post) (PostRelations, error)
+
+// PostRepository stores posts with their tags, category, attachments and
+// revision history
+type PostRepository interface {
+	// FindByID returns a post that is not in the trash, with its category and tags
+	FindByID(id uint) (*model.Post, error)
+	// Create stores a new post with its relations as revision 1
+	Create(post *model.Post, rel PostRelations) error
+	// Update applies change to the stored post and writes title, content,
+	// status and relations back with a bumped version, provided the stored
+	// version is one of versions (nil accepts any). Otherwise the stored
+	// post is returned with ErrVersionMismatch. A changed title or content
+	// (or RestoredFrom) is recorded as a new revision by editorID.
+	Update(id uint, change PostChange, versions []int64, editorID uint) (*model.Post, error)
+	// Delete moves a post to the trash
+	Delete(id uint) error
+	// FindTrashed returns a post that is in the trash
+	FindTrashed(id uint) (*model.Post, error)
+	// Restore takes a post out of the trash
+	Restore(id uint) error
+	// FindRevision returns revision rev of a post with its editor
+	FindRevision(postID uint, rev int) (*model.PostRevision, error)
+	// LatestRevision returns the newest revision of a post with its editor
+	LatestRevision(postID uint) (*model.PostRevision, error)
+	// ListRevisions returns the revisions of a post with their editors,
+	// newest first and without content
+	ListRevisions(postID uint) ([]model.PostRevision, error)
+}
+
+// SessionRepository keeps one session per logged-in device
+type SessionRepository interface {
+	// Create stores a new session for the raw token, only its hash is kept
+	Create(token string, s *model.Session) error
+	// FindByToken returns the session of a raw token with its user loaded
+	FindByToken(token string) (*model.Session, error)
+	// Touch records activity on a session and moves its idle expiry
+	Touch(id uint, lastSeen, idleExpiresAt time.Time) error
+	// RotateCSRF replaces the csrf token of a session
+	RotateCSRF(id uint, csrfToken string) error
+	// ListByUser returns the active sessions of a user, newest first
+	ListByUser(userID uint) ([]model.Session, error)
+	// Revoke ends one session of a user
+	Revoke(userID, sessionID uint) error
+	// RevokeAll ends every session of a user
+	RevokeAll(userID uint) error
+	// RevokeOthers ends every session of a user except keepID
+	RevokeOthers(userID, keepID uint) error
+	// DeleteExpired purges sessions past their absolute or idle expiry
+	DeleteExpired(now time.Time) (int64, error)
+}
+
+// LockForUpdate is SELECT ... FOR UPDATE where the dialect has it, sqlite
+// locks the whole database on write anyway
+func LockForUpdate(tx *gorm.DB) *gorm.DB {
+	if tx.Dialector.Name() == "sqlite" {
+		return tx
+	}
+	return tx.Clauses(clause.Locking{Strength: "UPDATE"})
+}
+
+// advisory lock class of blob locks, see WithBlobLock
+const blobLockClass = 0x626c6f62
+
+// stripes of the in-process blob lock, for sqlite
+var blobLocks [64]sync.Mutex
+
+// WithBlobLock runs fn in a transaction holding a lock on the content hash
+// of an upload (hex SHA256), so deciding whether a shared blob is still
+// needed and writing a row that needs it can't interleave. Postgres takes an
+// advisory lock held until the transaction ends, sqlite (tests, a single
+// process) an in-process one.
+func WithBlobLock(db *gorm.DB, sha256 string, fn func(tx *gorm.DB) error) error {
+	key, err := strconv.ParseUint(sha256[:min(len(sha256), 8)], 16, 32)
+	if err != nil {
+		return fmt.Errorf("blob lock: invalid hash %q", sha256)
+	}
+
+	if db.Dialector.Name() == "sqlite" {
+		mu := &blobLocks[key%uint64(len(blobLocks))]
+		mu.Lock()
+		defer mu.Unlock()
+		return db.Transaction(fn)
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(?, ?)", blobLockClass, int32(key)).Error; err != nil {
+			return err
+		}
+		return fn(tx)
+	})
+}
+
+// gorm's not found as ErrNotFound
+func notFound(err error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrNotFound
+	}
+	return err
+}
@@ -0,0 +1,90 @@
+package repository
+
+import (
+	"errors"
+	"gin-blog-app/model"
+	"gin-blog-app/utils"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// GORM backed sessions
+type gormSessionRepository struct {
+	db *gorm.DB
+}
+
+func NewGormSessionRepository(db *gorm.DB) SessionRepository {
+	return &gormSessionRepository{db: db}
+}
+
+func (s *gormSessionRepository) Create(token string, sess *model.Session) error {
+	sess.TokenHash = utils.HashToken(token)
+	return s.db.Create(sess).Error
+}
+
+func (s *gormSessionRepository) FindByToken(token string) (*model.Session, error) {
+	var sess model.Session
+	err := s.db.Scopes(alive(time.Now())).
+		Preload("User").
+		Where("token_hash = ?", utils.HashToken(token)).
+		First(&sess).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &sess, nil
+}
+
+func (s *gormSessionRepository) Touch(id uint, lastSeen, idleExpiresAt time.Time) error {
+	return s.db.Model(&model.Session{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"last_seen_at":    lastSeen,
+		"idle_expires_at": idleExpiresAt,
+	}).Error
+}
+
+func (s *gormSessionRepository) RotateCSRF(id uint, csrfToken string) error {
+	return s.db.Model(&model.Session{}).Where("id = ?", id).Update("csrf_token", csrfToken).Error
+}
+
+func (s *gormSessionRepository) ListByUser(userID uint) ([]model.Session, error) {
+	var sessions []model.Session
+	err := s.db.Scopes(alive(time.Now())).
+		Where("user_id = ?", userID).
+		Order("last_seen_at DESC").
+		Find(&sessions).Error
+	return sessions, err
+}
+
+func (s *gormSessionRepository) Revoke(userID, sessionID uint) error {
+	res := s.db.Where("id = ? AND user_id = ?", sessionID, userID).Delete(&model.Session{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *gormSessionRepository) RevokeAll(userID uint) error {
+	return s.db.Where("user_id = ?", userID).Delete(&model.Session{}).Error
+}
+
+func (s *gormSessionRepository) RevokeOthers(userID, keepID uint) error {
+	return s.db.Where("user_id = ? AND id <> ?", userID, keepID).Delete(&model.Session{}).Error
+}
+
+func (s *gormSessionRepository) DeleteExpired(now time.Time) (int64, error) {
+	res := s.db.Where("expires_at <= ? OR idle_expires_at <= ?", now, now).Delete(&model.Session{})
+	return res.RowsAffected, res.Error
+}
+
+// sessions neither past the absolute nor the idle expiry
+func alive(now time.Time) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("expires_at > ? AND idle_expires_at > ?", now, now)
+	}
+}
@@ -0,0 +1,82 @@
+package repository
+
+import (
+	"errors"
+	"gin-blog-app/model"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrCategoryExists is returned when a new category's slug is taken
+var ErrCategoryExists = errors.New("category already exists")
+
+// TagRepository reads tags and categories with the number of published
+// posts using them
+type TagRepository interface {
+	// ListTags returns every tag, most used first
+	ListTags() ([]model.TagResponse, error)
+	// FindTag returns the tag of a slug
+	FindTag(slug string) (*model.TagResponse, error)
+	// ListCategories returns every category by name
+	ListCategories() ([]model.TagResponse, error)
+	// CreateCategory stores a new category, ErrCategoryExists when its slug
+	// is taken
+	CreateCategory(category *model.Category) error
+}
+
+// GORM backed tags & categories
+type gormTagRepository struct {
+	db *gorm.DB
+}
+
+func NewGormTagRepository(db *gorm.DB) TagRepository {
+	return &gormTagRepository{db: db}
+}
+
+func (r *gormTagRepository) ListTags() ([]model.TagResponse, error) {
+	var tags []model.TagResponse
+	err := r.tagCounts().
+		Order("post_count DESC, tags.slug ASC").
+		Scan(&tags).Error
+	return tags, err
+}
+
+func (r *gormTagRepository) FindTag(slug string) (*model.TagResponse, error) {
+	var tag model.TagResponse
+	if err := r.tagCounts().Where("tags.slug = ?", slug).Take(&tag).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &tag, nil
+}
+
+func (r *gormTagRepository) ListCategories() ([]model.TagResponse, error) {
+	var categories []model.TagResponse
+	err := r.db.Table("categories").
+		Select("categories.name, categories.slug, COUNT(posts.id) AS post_count").
+		Joins("LEFT JOIN posts ON posts.category_id = categories.id AND posts.status = ? AND posts.deleted_at IS NULL", model.PostPublished).
+		Group("categories.id, categories.name, categories.slug").
+		Order("categories.name ASC").
+		Scan(&categories).Error
+	return categories, err
+}
+
+func (r *gormTagRepository) CreateCategory(category *model.Category) error {
+	res := r.db.Clauses(clause.OnConflict{DoNothing: true}).Create(category)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrCategoryExists
+	}
+	return nil
+}
+
+// tags with their published post count
+func (r *gormTagRepository) tagCounts() *gorm.DB {
+	return r.db.Table("tags").
+		Select("tags.name, tags.slug, COUNT(posts.id) AS post_count").
+		Joins("LEFT JOIN post_tags ON post_tags.tag_id = tags.id").
+		Joins("LEFT JOIN posts ON posts.id = post_tags.post_id AND posts.status = ? AND posts.deleted_at IS NULL", model.PostPublished).
+		Group("tags.id, tags.name, tags.slug")
+}
@@ -0,0 +1,51 @@
+package repository
+
+import (
+	"gin-blog-app/model"
+
+	"gorm.io/gorm"
+)
+
+// UploadRepository stores uploaded files, their content lives in the blob
+// store
+type UploadRepository interface {
+	FindByID(id uint) (*model.Upload, error)
+	// ListByPost returns the attachments of a post in upload order
+	ListByPost(postID uint) ([]model.Upload, error)
+	// Create stores an upload once storeBlob has made sure its content is in
+	// the blob store, both under the blob lock of the content (see
+	// WithBlobLock)
+	Create(upload *model.Upload, storeBlob func() error) error
+}
+
+// GORM backed uploads
+type gormUploadRepository struct {
+	db *gorm.DB
+}
+
+func NewGormUploadRepository(db *gorm.DB) UploadRepository {
+	return &gormUploadRepository{db: db}
+}
+
+func (r *gormUploadRepository) FindByID(id uint) (*model.Upload, error) {
+	var upload model.Upload
+	if err := r.db.First(&upload, id).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &upload, nil
+}
+
+func (r *gormUploadRepository) ListByPost(postID uint) ([]model.Upload, error) {
+	var uploads []model.Upload
+	err := r.db.Where("post_id = ?", postID).Order("id ASC").Find(&uploads).Error
+	return uploads, err
+}
+
+func (r *gormUploadRepository) Create(upload *model.Upload, storeBlob func() error) error {
+	return WithBlobLock(r.db, upload.SHA256, func(tx *gorm.DB) error {
+		if err := storeBlob(); err != nil {
+			return err
+		}
+		return tx.Create(upload).Error
+	})
+}
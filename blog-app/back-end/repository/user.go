@@ -0,0 +1,141 @@
+package repository
+
+import (
+	"gin-blog-app/model"
+	"gin-blog-app/rbac"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// GORM backed users
+type gormUserRepository struct {
+	db *gorm.DB
+}
+
+func NewGormUserRepository(db *gorm.DB) UserRepository {
+	return &gormUserRepository{db: db}
+}
+
+func (r *gormUserRepository) FindByID(id uint) (*model.User, error) {
+	var user model.User
+	if err := r.db.First(&user, id).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &user, nil
+}
+
+func (r *gormUserRepository) FindByUsername(username string) (*model.User, error) {
+	var user model.User
+	if err := r.db.Where("username = ?", username).First(&user).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &user, nil
+}
+
+func (r *gormUserRepository) FindByEmail(email string) (*model.User, error) {
+	var user model.User
+	if err := r.db.Where("email = ?", email).First(&user).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &user, nil
+}
+
+func (r *gormUserRepository) Create(user *model.User) error {
+	return r.db.Create(user).Error
+}
+
+func (r *gormUserRepository) UpdatePassword(id uint, hashedPassword string) error {
+	return r.update(id, "hashed_password", hashedPassword)
+}
+
+func (r *gormUserRepository) UpdateRole(id uint, role string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		// a concurrent demotion waits for these locks, then counts without
+		// the admin demoted here; taken in id order so two can't deadlock
+		var admins []uint
+		if err := LockForUpdate(tx).Model(&model.User{}).Where("role = ?", rbac.RoleAdmin).
+			Order("id").Pluck("id", &admins).Error; err != nil {
+			return err
+		}
+		if role != rbac.RoleAdmin && len(admins) == 1 && admins[0] == id {
+			return ErrLastAdmin
+		}
+
+		res := tx.Model(&model.User{}).Where("id = ?", id).Update("role", role)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrNotFound
+		}
+		return nil
+	})
+}
+
+func (r *gormUserRepository) CountByRole(role string) (int64, error) {
+	var count int64
+	err := r.db.Model(&model.User{}).Where("role = ?", role).Count(&count).Error
+	return count, err
+}
+
+func (r *gormUserRepository) List(offset, limit int) ([]model.User, int64, error) {
+	var total int64
+	if err := r.db.Model(&model.User{}).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var users []model.User
+	err := r.db.Select("id", "username", "role").
+		Order("id ASC").
+		Offset(offset).
+		Limit(limit).
+		Find(&users).Error
+	return users, total, err
+}
+
+func (r *gormUserRepository) CreateResetToken(rt *model.PasswordResetToken) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ? AND used_at IS NULL", rt.UserID).
+			Delete(&model.PasswordResetToken{}).Error; err != nil {
+			return err
+		}
+		return tx.Omit("User").Create(rt).Error
+	})
+}
+
+func (r *gormUserRepository) FindResetToken(tokenHash string, now time.Time) (*model.PasswordResetToken, error) {
+	var rt model.PasswordResetToken
+	if err := r.db.Where("token_hash = ? AND used_at IS NULL AND expires_at > ?", tokenHash, now).
+		First(&rt).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &rt, nil
+}
+
+func (r *gormUserRepository) ResetPassword(rt model.PasswordResetToken, hashedPassword string, now time.Time) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		// spend the token, a concurrent reset with the same token loses here
+		res := tx.Model(&model.PasswordResetToken{}).
+			Where("id = ? AND used_at IS NULL", rt.ID).
+			Update("used_at", now)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrNotFound
+		}
+		return (&gormUserRepository{db: tx}).UpdatePassword(rt.UserID, hashedPassword)
+	})
+}
+
+func (r *gormUserRepository) update(id uint, column string, value interface{}) error {
+	res := r.db.Model(&model.User{}).Where("id = ?", id).Update(column, value)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
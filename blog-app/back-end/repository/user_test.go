@@ -0,0 +1,97 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gin-blog-app/migrations"
+	"gin-blog-app/model"
+	"gin-blog-app/rbac"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// two admins demoted at once leave one admin, on postgres where the
+// demotions really run side by side (sqlite serialises them):
+//
+//	POSTGRES_TEST_DSN="host=localhost user=postgres password=postgres dbname=blog_test sslmode=disable" go test ./repository/
+func TestUpdateRoleLastAdminRace(t *testing.T) {
+	dsn := os.Getenv("POSTGRES_TEST_DSN")
+	if dsn == "" {
+		t.Skip("POSTGRES_TEST_DSN is not set")
+	}
+
+	admin, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	schema := fmt.Sprintf("repository_test_%d", time.Now().UnixNano())
+	if err := admin.Exec("CREATE SCHEMA " + schema).Error; err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { admin.Exec("DROP SCHEMA " + schema + " CASCADE") })
+
+	db, err := gorm.Open(postgres.Open(withSearchPath(dsn, schema)), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	migrator, err := migrations.New(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := migrator.Up(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	users := NewGormUserRepository(db)
+	alice := model.User{Username: "alice1", HashedPassword: "x"}
+	bob := model.User{Username: "bob123", HashedPassword: "x"}
+	for _, u := range []*model.User{&alice, &bob} {
+		if err := users.Create(u); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for round := 0; round < 20; round++ {
+		if err := db.Model(&model.User{}).Where("id IN ?", []uint{alice.ID, bob.ID}).Update("role", rbac.RoleAdmin).Error; err != nil {
+			t.Fatal(err)
+		}
+
+		var wg sync.WaitGroup
+		errs := make([]error, 2)
+		for i, id := range []uint{alice.ID, bob.ID} {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				errs[i] = users.UpdateRole(id, rbac.RoleUser)
+			}()
+		}
+		wg.Wait()
+
+		admins, err := users.CountByRole(rbac.RoleAdmin)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lastAdmin := errors.Is(errs[0], ErrLastAdmin) != errors.Is(errs[1], ErrLastAdmin)
+		if admins != 1 || !lastAdmin {
+			t.Fatalf("round %d: %d admins left, errors %v", round, admins, errs)
+		}
+	}
+}
+
+func withSearchPath(dsn, schema string) string {
+	if !strings.Contains(dsn, "://") {
+		return dsn + " search_path=" + schema
+	}
+	if strings.Contains(dsn, "?") {
+		return dsn + "&search_path=" + schema
+	}
+	return dsn + "?search_path=" + schema
+}
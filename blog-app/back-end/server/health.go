@@ -0,0 +1,73 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"gin-blog-app/migrations"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// how long a readiness check may wait on the database
+const readyTimeout = 2 * time.Second
+
+// Health answers the orchestrator's probes: /healthz while the process
+// serves requests, /readyz while it can also reach a migrated database
+type Health struct {
+	db       *gorm.DB
+	migrator *migrations.Migrator
+}
+
+func NewHealth(db *gorm.DB) (*Health, error) {
+	migrator, err := migrations.New(db)
+	if err != nil {
+		return nil, err
+	}
+	return &Health{db: db, migrator: migrator}, nil
+}
+
+// liveness, nothing but the process is checked so a database outage
+// doesn't get every instance restarted
+func (hc *Health) Live(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// readiness, 503 when the database is unreachable or migrations are
+// pending; migrations newer than this binary (a rolling deploy) are fine
+func (hc *Health) Ready(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), readyTimeout)
+	defer cancel()
+
+	sqlDB, err := hc.db.DB()
+	if err == nil {
+		err = sqlDB.PingContext(ctx)
+	}
+	if err != nil {
+		log.Println("Readiness: database:", err)
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "unavailable", "database": "unreachable"})
+		return
+	}
+
+	pending, err := hc.migrator.Pending(ctx)
+	if err != nil {
+		log.Println("Readiness: migrations:", err)
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "unavailable", "database": "ok", "migrations": "unknown"})
+		return
+	}
+
+	names := make([]string, 0, len(pending))
+	for _, m := range pending {
+		names = append(names, fmt.Sprintf("%04d_%s", m.Version, m.Name))
+	}
+	migrationState := gin.H{"pending": names}
+	if len(pending) > 0 {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "unavailable", "database": "ok", "migrations": migrationState})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ready", "database": "ok", "migrations": migrationState})
+
+}
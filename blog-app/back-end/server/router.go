@@ -0,0 +1,112 @@
+// Package server builds the HTTP API: every route with its middleware.
+package server
+
+import (
+	"gin-blog-app/controler"
+	"gin-blog-app/middleware"
+	"gin-blog-app/rbac"
+	"time"
+
+	"github.com/gin-contrib/cors"
+	"github.com/gin-gonic/gin"
+)
+
+// NewRouter registers the routes of the API on a new engine, allowOrigins
+// are the front-end origins CORS lets in, trustedProxies the proxies whose
+// X-Forwarded-For sets the client IP (none: the peer address is the client)
+func NewRouter(h *controler.Handler, auth *middleware.Auth, health *Health, allowOrigins, trustedProxies []string) (*gin.Engine, error) {
+
+	//multiplexer
+	router := gin.New()
+	// gin trusts every proxy by default, anyone could pick their IP
+	if err := router.SetTrustedProxies(trustedProxies); err != nil {
+		return nil, err
+	}
+	router.Use(gin.Recovery())
+
+	// probes, registered before the logger: they are polled every few seconds
+	router.GET("/healthz", health.Live)
+	router.GET("/readyz", health.Ready)
+
+	router.Use(cors.New(cors.Config{
+		AllowOrigins:     allowOrigins, // frontend URLs
+		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization", "X-CSRF-Token", "If-Match", "If-None-Match"},
+		ExposeHeaders:    []string{"Content-Length", "ETag"},
+		AllowCredentials: true,
+		MaxAge:           12 * time.Hour,
+	}), middleware.LoggerMiddleware())
+
+	//public routes
+	router.GET("/", h.HomeHandler)
+	router.GET("/posts", auth.OptionalAuth(), h.PostPageHandler)
+	router.GET("/posts/search", h.SearchPostsHandler)
+	router.GET("/tags", h.TagsHandler)
+	router.GET("/tags/:slug/posts", auth.OptionalAuth(), h.TagPostsHandler)
+	router.GET("/categories", h.CategoriesHandler)
+	router.GET("/post/:id", auth.OptionalAuth(), h.GetPostByID)
+	router.GET("/post/:id/comments", h.GetCommentsHandler)
+	router.GET("/comment/:commentid/replies", h.GetRepliesHandler)
+	router.GET("/post/:id/revisions", auth.OptionalAuth(), h.PostRevisionsHandler)
+	router.GET("/post/:id/revisions/:rev", auth.OptionalAuth(), h.PostRevisionHandler)
+	router.GET("/post/:id/diff", auth.OptionalAuth(), h.PostDiffHandler)
+	router.GET("/uploads/:id", auth.OptionalAuth(), h.GetUploadHandler)
+	router.GET("/uploads/:id/thumbnail", auth.OptionalAuth(), h.GetUploadThumbnailHandler)
+	router.POST("/register", h.RegistrationHandler)
+	router.POST("/login", h.LoginHandler)
+	router.POST("/logout", h.LogoutHandler)
+	router.POST("/token/refresh", h.RefreshTokenHandler)
+	router.POST("/token/revoke", h.RevokeTokenHandler)
+	router.POST("/password/forgot", h.ForgotPasswordHandler)
+	router.POST("/password/reset", h.ResetPasswordHandler)
+
+	// private routes
+
+	// csrf refresh sits outside the csrf check so a client that lost its token can recover
+	router.POST("/user/csrf/refresh", auth.RequireAuth(), h.RefreshCSRFHandler)
+
+	private := router.Group("/user")
+	private.Use(auth.RequireAuth(), middleware.RequireCSRF())
+	{
+
+		// post creation, updation, delete routes
+		private.POST("/create", h.CreatePostHandler)
+		private.PATCH("/update/:postid", auth.RequireOwner(rbac.PostEditAny), h.UpdatePostHandler)
+		private.DELETE("/delete/:postid", auth.RequireOwner(rbac.PostDeleteAny), h.DeletePostHandler)
+		private.POST("/uploads", h.UploadHandler)
+		private.GET("/trash", h.TrashHandler)
+		private.POST("/trash/:postid/restore", h.RestorePostHandler)
+		private.POST("/post/:postid/revisions/:rev/restore", auth.RequireOwner(rbac.PostEditAny), h.RestoreRevisionHandler)
+
+		// account
+		private.POST("/password", h.ChangePasswordHandler)
+		private.GET("/posts", h.MyPostsHandler)
+
+		// active sessions (devices)
+		private.GET("/sessions", h.ListSessionsHandler)
+		private.DELETE("/sessions", h.RevokeAllSessionsHandler)
+		private.DELETE("/sessions/:sessionid", h.RevokeSessionHandler)
+
+		// reactions
+		private.PUT("/post/:postid/reaction", h.PutReactionHandler)
+		private.DELETE("/post/:postid/reaction", h.DeleteReactionHandler)
+
+		// comments & replies
+		private.POST("/post/:postid/comments", h.CreateCommentHandler)
+		private.PATCH("/comment/:commentid", auth.RequireCommentOwner(rbac.CommentEditAny), h.UpdateCommentHandler)
+		private.DELETE("/comment/:commentid", auth.RequireCommentOwner(rbac.CommentDeleteAny), h.DeleteCommentHandler)
+
+	}
+
+	// admin routes
+	admin := router.Group("/admin")
+	admin.Use(auth.RequireAuth(), middleware.RequireCSRF())
+	{
+		admin.GET("/users", middleware.RequirePermission(rbac.UserManage), h.ListUsersHandler)
+		admin.PUT("/users/:userid/role", middleware.RequirePermission(rbac.UserManage), h.AssignRoleHandler)
+		admin.POST("/categories", middleware.RequirePermission(rbac.CategoryManage), h.CreateCategoryHandler)
+	}
+
+	return router, nil
+
+}
@@ -0,0 +1,50 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+const readHeaderTimeout = 10 * time.Second
+
+// Serve serves handler on addr until ctx is done (SIGTERM in main). It then
+// stops accepting connections and gives in-flight requests up to
+// drainTimeout to finish before the remaining ones are cut off.
+func Serve(ctx context.Context, addr string, handler http.Handler, drainTimeout time.Duration) error {
+	srv := &http.Server{
+		Addr:    addr,
+		Handler: handler,
+		// a client that never finishes its headers can't hold a connection
+		// open, nor stretch a shutdown to the full drain timeout
+		ReadHeaderTimeout: readHeaderTimeout,
+	}
+
+	listenErr := make(chan error, 1)
+	go func() {
+		log.Println("Listening on", addr)
+		listenErr <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-listenErr:
+		return err
+	case <-ctx.Done():
+	}
+
+	log.Printf("Shutting down, draining requests for up to %s", drainTimeout)
+	drainCtx, cancel := context.WithTimeout(context.Background(), drainTimeout)
+	defer cancel()
+	if err := srv.Shutdown(drainCtx); err != nil {
+		srv.Close()
+		if errors.Is(err, context.DeadlineExceeded) {
+			return fmt.Errorf("requests still running after %s were cut off", drainTimeout)
+		}
+		return err
+	}
+	log.Println("Server stopped")
+	return nil
+}
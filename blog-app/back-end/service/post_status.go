@@ -0,0 +1,47 @@
+package service
+
+import (
+	"gin-blog-app/model"
+	"time"
+)
+
+var (
+	ErrInvalidStatus     = &FieldError{Field: "status", Message: "status must be one of draft, scheduled, published, archived"}
+	ErrPublishAtRequired = &FieldError{Field: "publish_at", Message: "scheduled posts need a publish_at in the future"}
+)
+
+//----------------------------------POST---lifecycle------------------------------
+
+// applies a requested status (and publish time) to a post
+// an empty status keeps the current one, publish_at alone reschedules a
+// scheduled post
+func applyPostStatus(post *model.Post, status string, publishAt *time.Time, now time.Time) error {
+	if status == "" {
+		status = post.Status
+	}
+
+	switch status {
+	case model.PostPublished:
+		// keep the original publish time when already public
+		if post.Status != model.PostPublished || post.PublishAt == nil {
+			post.PublishAt = &now
+		}
+	case model.PostScheduled:
+		at := publishAt
+		if at == nil {
+			at = post.PublishAt
+		}
+		if at == nil || !at.After(now) {
+			return ErrPublishAtRequired
+		}
+		post.PublishAt = at
+	case model.PostDraft:
+		post.PublishAt = nil
+	case model.PostArchived:
+	default:
+		return ErrInvalidStatus
+	}
+
+	post.Status = status
+	return nil
+}
@@ -0,0 +1,268 @@
+package service
+
+import (
+	"errors"
+	"gin-blog-app/model"
+	"gin-blog-app/rbac"
+	"gin-blog-app/render"
+	"gin-blog-app/repository"
+	"gin-blog-app/utils"
+	"strings"
+	"time"
+)
+
+const (
+	maxTagsPerPost = 10
+	// MaxSlugLength bounds tag and category slugs
+	MaxSlugLength = 50
+)
+
+var (
+	ErrTitleRequired   = &FieldError{Field: "title", Message: "is required"}
+	ErrStatusNull      = &FieldError{Field: "status", Message: "can't be null"}
+	ErrTooManyTags     = &FieldError{Field: "tags", Message: "a post can have at most 10 tags"}
+	ErrInvalidTag      = &FieldError{Field: "tags", Message: "tag names need letters or digits and at most 50 characters"}
+	ErrUnknownCategory = &FieldError{Field: "category", Message: repository.ErrUnknownCategory.Error()}
+	ErrUnknownUpload   = &FieldError{Field: "uploads", Message: repository.ErrUnknownUpload.Error()}
+)
+
+// PostService writes posts on behalf of their authors
+type PostService struct {
+	posts repository.PostRepository
+}
+
+func NewPostService(posts repository.PostRepository) *PostService {
+	return &PostService{posts: posts}
+}
+
+// Get returns a post the viewer may see, unpublished posts are only
+// visible to their author (viewerID is zero for anonymous callers)
+func (s *PostService) Get(id, viewerID uint) (*model.Post, error) {
+	post, err := s.posts.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if post.Status != model.PostPublished && post.AuthorID != viewerID {
+		return nil, repository.ErrNotFound
+	}
+	return post, nil
+}
+
+// Authorize returns a post the actor may change, see Actor.Owns
+func (s *PostService) Authorize(actor Actor, id uint, override rbac.Permission) (*model.Post, error) {
+	post, err := s.posts.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if !actor.Owns(post.AuthorID, override) {
+		return nil, ErrNotOwner
+	}
+	return post, nil
+}
+
+// Create writes a new post, published unless another status is asked for
+func (s *PostService) Create(authorID uint, in model.PostInput) (*model.Post, error) {
+	post := model.Post{
+		Title:     in.Title,
+		Content:   in.Content,
+		AuthorID:  authorID,
+		CreatedAt: time.Now(),
+		Version:   1,
+	}
+	RenderContent(&post)
+
+	// draft, scheduled or published (default)
+	status := in.Status
+	if status == "" {
+		status = model.PostPublished
+	}
+	if err := applyPostStatus(&post, status, in.PublishAt, post.CreatedAt); err != nil {
+		return nil, err
+	}
+
+	tags, err := postTags(in.Tags)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.posts.Create(&post, repository.PostRelations{
+		Category: model.Patch[string]{Set: true, Value: in.Category},
+		Tags:     model.Patch[[]model.Tag]{Set: true, Value: tags},
+		Uploads:  model.Patch[[]uint]{Set: true, Value: in.Uploads},
+	})
+	if err != nil {
+		return nil, inputError(err)
+	}
+	return &post, nil
+}
+
+// Update applies a merge-patch to a post, provided its stored version is
+// one of versions (nil accepts any). The patch is applied to the post as
+// stored at the time of the write, so concurrent edits of other fields are
+// kept. On repository.ErrVersionMismatch the current post is returned too.
+func (s *PostService) Update(actor Actor, id uint, in model.UpdatePostInput, versions []int64) (*model.Post, error) {
+	// title and status can't be removed
+	if in.Title.Set && strings.TrimSpace(in.Title.Value) == "" {
+		return nil, ErrTitleRequired
+	}
+	if in.Status.Null {
+		return nil, ErrStatusNull
+	}
+
+	// null or "" removes the category, null removes tags and uploads
+	rel := repository.PostRelations{Category: in.Category, Uploads: in.Uploads}
+	if in.Tags.Set {
+		tags, err := postTags(in.Tags.Value)
+		if err != nil {
+			return nil, err
+		}
+		rel.Tags = model.Patch[[]model.Tag]{Set: true, Value: tags}
+	}
+
+	if _, err := s.Authorize(actor, id, rbac.PostEditAny); err != nil {
+		return nil, err
+	}
+
+	post, err := s.posts.Update(id, func(post *model.Post) (repository.PostRelations, error) {
+		// lifecycle change, a null publish_at drops the schedule of a scheduled post
+		if in.Status.Set || in.PublishAt.Set {
+			var publishAt *time.Time
+			if in.PublishAt.HasValue() {
+				publishAt = &in.PublishAt.Value
+			} else if in.PublishAt.Null && post.Status == model.PostScheduled {
+				post.PublishAt = nil
+			}
+			if err := applyPostStatus(post, in.Status.Value, publishAt, time.Now()); err != nil {
+				return rel, err
+			}
+		}
+
+		if in.Title.Set {
+			post.Title = in.Title.Value
+		}
+		if in.Content.Set {
+			post.Content = in.Content.Value
+			RenderContent(post)
+		}
+		return rel, nil
+	}, versions, actor.UserID)
+	if err != nil {
+		if errors.Is(err, repository.ErrVersionMismatch) {
+			return post, err
+		}
+		return nil, inputError(err)
+	}
+	return post, nil
+}
+
+// Revisions returns the history of a post, newest first and without content
+func (s *PostService) Revisions(id uint) ([]model.PostRevision, error) {
+	return s.posts.ListRevisions(id)
+}
+
+// Revision returns revision rev of a post
+func (s *PostService) Revision(id uint, rev int) (*model.PostRevision, error) {
+	return s.posts.FindRevision(id, rev)
+}
+
+// LatestRevision returns the newest revision of a post
+func (s *PostService) LatestRevision(id uint) (*model.PostRevision, error) {
+	return s.posts.LatestRevision(id)
+}
+
+// RestoreRevision puts the title and content of revision rev back as a new
+// revision, through the same versioned write as Update. On
+// repository.ErrVersionMismatch the current post is returned too.
+func (s *PostService) RestoreRevision(actor Actor, id uint, rev int, versions []int64) (*model.Post, *model.PostRevision, error) {
+	if _, err := s.Authorize(actor, id, rbac.PostEditAny); err != nil {
+		return nil, nil, err
+	}
+	source, err := s.posts.FindRevision(id, rev)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	post, err := s.posts.Update(id, func(post *model.Post) (repository.PostRelations, error) {
+		post.Title, post.Content = source.Title, source.Content
+		RenderContent(post)
+		return repository.PostRelations{RestoredFrom: &source.Rev}, nil
+	}, versions, actor.UserID)
+	if err != nil {
+		if errors.Is(err, repository.ErrVersionMismatch) {
+			return post, nil, err
+		}
+		return nil, nil, err
+	}
+
+	restored, err := s.posts.LatestRevision(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	return post, restored, nil
+}
+
+// Delete moves a post to its author's trash
+func (s *PostService) Delete(actor Actor, id uint) error {
+	if _, err := s.Authorize(actor, id, rbac.PostDeleteAny); err != nil {
+		return err
+	}
+	return s.posts.Delete(id)
+}
+
+// Restore takes a post out of the trash, its author and whoever may
+// delete any post are allowed
+func (s *PostService) Restore(actor Actor, id uint) (*model.Post, error) {
+	post, err := s.posts.FindTrashed(id)
+	if err != nil {
+		return nil, err
+	}
+	if !actor.Owns(post.AuthorID, rbac.PostDeleteAny) {
+		return nil, ErrNotOwner
+	}
+	if err := s.posts.Restore(id); err != nil {
+		return nil, err
+	}
+	return post, nil
+}
+
+//----------------------------------POSTS---helpers------------------------------
+
+// RenderContent renders the markdown content of a post into its html & excerpt
+func RenderContent(post *model.Post) {
+	post.ContentHTML = render.HTML(post.Content)
+	post.Excerpt = render.Excerpt(render.Text(post.ContentHTML))
+}
+
+// tags for the given names, deduplicated by slug
+func postTags(names []string) ([]model.Tag, error) {
+	seen := make(map[string]bool, len(names))
+	tags := make([]model.Tag, 0, len(names))
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		slug := utils.Slugify(name)
+		if slug == "" || len(slug) > MaxSlugLength {
+			return nil, ErrInvalidTag
+		}
+		if seen[slug] {
+			continue
+		}
+		seen[slug] = true
+		tags = append(tags, model.Tag{Name: name, Slug: slug})
+	}
+
+	if len(tags) > maxTagsPerPost {
+		return nil, ErrTooManyTags
+	}
+	return tags, nil
+}
+
+// repository errors caused by the input as the field they belong to
+func inputError(err error) error {
+	switch {
+	case errors.Is(err, repository.ErrUnknownCategory):
+		return ErrUnknownCategory
+	case errors.Is(err, repository.ErrUnknownUpload):
+		return ErrUnknownUpload
+	}
+	return err
+}
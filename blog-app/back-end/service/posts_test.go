@@ -0,0 +1,188 @@
+package service
+
+import (
+	"errors"
+	"gin-blog-app/model"
+	"gin-blog-app/rbac"
+	"gin-blog-app/repository"
+	"testing"
+)
+
+var (
+	author    = Actor{UserID: 1, Role: rbac.RoleUser}
+	stranger  = Actor{UserID: 2, Role: rbac.RoleUser}
+	moderator = Actor{UserID: 3, Role: rbac.RoleModerator}
+)
+
+// post service on the in-memory repository, with one post by author
+func newPostService(t *testing.T) (*PostService, *model.Post) {
+	t.Helper()
+
+	s := NewPostService(repository.NewMemoryPostRepository(model.Category{ID: 1, Name: "Go", Slug: "go"}))
+	post, err := s.Create(author.UserID, model.PostInput{Title: "First", Content: "# hello", Category: "go"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, post
+}
+
+func set[T any](v T) model.Patch[T] {
+	return model.Patch[T]{Set: true, Value: v}
+}
+
+func null[T any]() model.Patch[T] {
+	return model.Patch[T]{Set: true, Null: true}
+}
+
+func TestCreatePost(t *testing.T) {
+	s, post := newPostService(t)
+
+	if post.Status != model.PostPublished || post.Version != 1 || post.ContentHTML == "" {
+		t.Errorf("created %+v", post)
+	}
+	if post.Category == nil || post.Category.Slug != "go" {
+		t.Errorf("category %+v, want go", post.Category)
+	}
+
+	_, err := s.Create(author.UserID, model.PostInput{Title: "t", Content: "c", Category: "rust"})
+	if !errors.Is(err, ErrUnknownCategory) {
+		t.Errorf("unknown category: %v, want ErrUnknownCategory", err)
+	}
+	_, err = s.Create(author.UserID, model.PostInput{Title: "t", Content: "c", Tags: []string{"!!"}})
+	if !errors.Is(err, ErrInvalidTag) {
+		t.Errorf("invalid tag: %v, want ErrInvalidTag", err)
+	}
+}
+
+func TestUpdatePost(t *testing.T) {
+	tests := []struct {
+		name     string
+		actor    Actor
+		in       model.UpdatePostInput
+		versions []int64
+		wantErr  error
+	}{
+		{"title", author, model.UpdatePostInput{Title: set("Second")}, []int64{1}, nil},
+		{"any version", author, model.UpdatePostInput{Title: set("Second")}, nil, nil},
+		{"moderator", moderator, model.UpdatePostInput{Title: set("Second")}, nil, nil},
+		{"not owner", stranger, model.UpdatePostInput{Title: set("Second")}, nil, ErrNotOwner},
+		{"stale version", author, model.UpdatePostInput{Title: set("Second")}, []int64{7}, repository.ErrVersionMismatch},
+		{"no version matches", author, model.UpdatePostInput{Title: set("Second")}, []int64{}, repository.ErrVersionMismatch},
+		{"null title", author, model.UpdatePostInput{Title: null[string]()}, nil, ErrTitleRequired},
+		{"blank title", author, model.UpdatePostInput{Title: set("  ")}, nil, ErrTitleRequired},
+		{"null status", author, model.UpdatePostInput{Status: null[string]()}, nil, ErrStatusNull},
+		{"unknown status", author, model.UpdatePostInput{Status: set("hidden")}, nil, ErrInvalidStatus},
+		{"scheduled without date", author, model.UpdatePostInput{Status: set(model.PostScheduled)}, nil, ErrPublishAtRequired},
+		{"unknown category", author, model.UpdatePostInput{Category: set("rust")}, nil, ErrUnknownCategory},
+		{"upload", author, model.UpdatePostInput{Uploads: set([]uint{1})}, nil, ErrUnknownUpload},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			s, post := newPostService(t)
+
+			got, err := s.Update(tc.actor, post.ID, tc.in, tc.versions)
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("error %v, want %v", err, tc.wantErr)
+			}
+
+			switch {
+			case tc.wantErr == nil:
+				if got.Title != "Second" || got.Version != 2 {
+					t.Errorf("updated %+v", got)
+				}
+			case errors.Is(tc.wantErr, repository.ErrVersionMismatch):
+				if got == nil || got.Version != 1 {
+					t.Errorf("mismatch returned %+v, want the stored post", got)
+				}
+			default:
+				stored, _ := s.Get(post.ID, author.UserID)
+				if stored.Title != "First" || stored.Version != 1 || stored.Category == nil {
+					t.Errorf("rejected update changed the post: %+v", stored)
+				}
+			}
+		})
+	}
+}
+
+func TestUpdatePostKeepsOtherFields(t *testing.T) {
+	s, post := newPostService(t)
+
+	if _, err := s.Update(author, post.ID, model.UpdatePostInput{Content: set("new")}, nil); err != nil {
+		t.Fatal(err)
+	}
+	got, err := s.Update(author, post.ID, model.UpdatePostInput{Status: set(model.PostDraft), Category: null[string]()}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Title != "First" || got.Content != "new" || got.Status != model.PostDraft || got.Category != nil || got.Version != 3 {
+		t.Errorf("got %+v", got)
+	}
+}
+
+func TestPostVisibilityAndTrash(t *testing.T) {
+	s, post := newPostService(t)
+
+	if _, err := s.Update(author, post.ID, model.UpdatePostInput{Status: set(model.PostDraft)}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Get(post.ID, 0); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("anonymous sees a draft: %v", err)
+	}
+	if _, err := s.Get(post.ID, author.UserID); err != nil {
+		t.Errorf("author can't see their draft: %v", err)
+	}
+
+	if err := s.Delete(stranger, post.ID); !errors.Is(err, ErrNotOwner) {
+		t.Errorf("stranger delete: %v, want ErrNotOwner", err)
+	}
+	if err := s.Delete(author, post.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Get(post.ID, author.UserID); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("trashed post still found: %v", err)
+	}
+	if _, err := s.Restore(stranger, post.ID); !errors.Is(err, ErrNotOwner) {
+		t.Errorf("stranger restore: %v, want ErrNotOwner", err)
+	}
+	if _, err := s.Restore(author, post.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Get(post.ID, author.UserID); err != nil {
+		t.Errorf("restored post: %v", err)
+	}
+}
+
+func TestRestoreRevision(t *testing.T) {
+	s, post := newPostService(t)
+	if _, err := s.Update(author, post.ID, model.UpdatePostInput{Title: set("Second"), Content: set("new")}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := s.RestoreRevision(stranger, post.ID, 1, nil); !errors.Is(err, ErrNotOwner) {
+		t.Errorf("stranger: %v, want ErrNotOwner", err)
+	}
+	if _, _, err := s.RestoreRevision(author, post.ID, 9, nil); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("unknown revision: %v, want ErrNotFound", err)
+	}
+	current, _, err := s.RestoreRevision(author, post.ID, 1, []int64{1})
+	if !errors.Is(err, repository.ErrVersionMismatch) || current == nil || current.Version != 2 {
+		t.Fatalf("stale version: %v, post %+v", err, current)
+	}
+
+	got, revision, err := s.RestoreRevision(author, post.ID, 1, []int64{2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Title != "First" || got.Content != "# hello" || got.ContentHTML == "" || got.Version != 3 {
+		t.Errorf("restored %+v", got)
+	}
+	if revision.Rev != 3 || revision.RestoredFrom == nil || *revision.RestoredFrom != 1 {
+		t.Errorf("revision %+v, want 3 restored from 1", revision)
+	}
+
+	// putting back what is already there is still recorded
+	if _, revision, err = s.RestoreRevision(author, post.ID, 3, nil); err != nil || revision.Rev != 4 {
+		t.Errorf("restoring the current revision: %v, revision %+v", err, revision)
+	}
+}
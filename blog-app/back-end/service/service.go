@@ -0,0 +1,35 @@
+// Package service holds the business rules of users and posts: which input
+// is accepted and who may change what. Services only talk to the
+// repositories, so they run as well against the in-memory ones.
+package service
+
+import (
+	"errors"
+	"gin-blog-app/rbac"
+)
+
+// ErrNotOwner is returned when the actor neither owns a post nor holds the
+// permission to change anyone's
+var ErrNotOwner = errors.New("not allowed to modify this post")
+
+// FieldError is input rejected on one field, answered with 422
+type FieldError struct {
+	Field   string
+	Message string
+}
+
+func (e *FieldError) Error() string {
+	return e.Field + ": " + e.Message
+}
+
+// Actor is the logged-in user a change is made for
+type Actor struct {
+	UserID uint
+	Role   string
+}
+
+// Owns reports whether the actor may change what authorID owns: the owner
+// may, so may anyone holding the override permission
+func (a Actor) Owns(authorID uint, override rbac.Permission) bool {
+	return a.UserID == authorID || rbac.Can(a.Role, override)
+}
@@ -0,0 +1,210 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"gin-blog-app/model"
+	"gin-blog-app/rbac"
+	"gin-blog-app/repository"
+	"gin-blog-app/utils"
+	"strings"
+	"time"
+)
+
+// ResetTokenTTL is how long a password reset link works
+const ResetTokenTTL = time.Hour
+
+var (
+	ErrUsernameTaken      = errors.New("username already exists")
+	ErrEmailTaken         = errors.New("email already in use")
+	ErrInvalidCredentials = errors.New("invalid username or password")
+	ErrWrongPassword      = errors.New("old password is incorrect")
+	ErrLastAdmin          = repository.ErrLastAdmin
+
+	ErrInvalidRole       = &FieldError{Field: "role", Message: "must be one of " + strings.Join(rbac.Roles(), ", ")}
+	ErrInvalidResetToken = &FieldError{Field: "token", Message: "is invalid or expired"}
+)
+
+// UserService registers, authenticates and manages accounts
+type UserService struct {
+	users      repository.UserRepository
+	bcryptCost int
+	dummyHash  func() string
+}
+
+// NewUserService hashes new passwords at bcryptCost
+func NewUserService(users repository.UserRepository, bcryptCost int) *UserService {
+	return &UserService{users: users, bcryptCost: bcryptCost, dummyHash: utils.DummyPasswordHash(bcryptCost)}
+}
+
+// Register creates an account, length, charset & email format are checked
+// by the input's binding tags
+func (s *UserService) Register(in model.UserRegisterInput) (*model.User, error) {
+	// email is optional, it is only used for password recovery
+	var email *string
+	if e := strings.ToLower(strings.TrimSpace(in.Email)); e != "" {
+		if _, err := s.users.FindByEmail(e); err == nil {
+			return nil, ErrEmailTaken
+		} else if !errors.Is(err, repository.ErrNotFound) {
+			return nil, err
+		}
+		email = &e
+	}
+
+	if _, err := s.users.FindByUsername(in.Username); err == nil {
+		return nil, ErrUsernameTaken
+	} else if !errors.Is(err, repository.ErrNotFound) {
+		return nil, err
+	}
+
+	hashedPassword, err := utils.GenerateHashedPassword(in.Password, s.bcryptCost)
+	if err != nil {
+		return nil, err
+	}
+
+	user := model.User{
+		Username:       in.Username,
+		HashedPassword: hashedPassword,
+		Email:          email,
+	}
+	if err := s.users.Create(&user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// Authenticate checks a username & password pair
+// an unknown user still pays for a bcrypt comparison so both failures look
+// the same from outside
+func (s *UserService) Authenticate(username, password string) (*model.User, error) {
+	user, err := s.users.FindByUsername(username)
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		return nil, err
+	}
+
+	hashed := s.dummyHash()
+	if user != nil {
+		hashed = user.HashedPassword
+	}
+	if !utils.CompareHashAndPassword(password, hashed) || user == nil {
+		return nil, ErrInvalidCredentials
+	}
+	return user, nil
+}
+
+func (s *UserService) Get(id uint) (*model.User, error) {
+	return s.users.FindByID(id)
+}
+
+// ByEmail finds the account of an email address, case-insensitive
+func (s *UserService) ByEmail(email string) (*model.User, error) {
+	return s.users.FindByEmail(strings.ToLower(strings.TrimSpace(email)))
+}
+
+// ChangePassword replaces the password of a user who knows the current one
+func (s *UserService) ChangePassword(id uint, oldPassword, newPassword string) error {
+	user, err := s.users.FindByID(id)
+	if err != nil {
+		return err
+	}
+	if !utils.CompareHashAndPassword(oldPassword, user.HashedPassword) {
+		return ErrWrongPassword
+	}
+
+	hashedPassword, err := utils.GenerateHashedPassword(newPassword, s.bcryptCost)
+	if err != nil {
+		return err
+	}
+	return s.users.UpdatePassword(id, hashedPassword)
+}
+
+// StartPasswordReset issues a reset token for the account of an email and
+// returns the account with the raw token to mail, only its hash is stored
+func (s *UserService) StartPasswordReset(email string) (*model.User, string, error) {
+	user, err := s.ByEmail(email)
+	if err != nil {
+		return nil, "", err
+	}
+
+	resetToken := utils.GenerateToken(32)
+	err = s.users.CreateResetToken(&model.PasswordResetToken{
+		UserID:    user.ID,
+		TokenHash: utils.HashToken(resetToken),
+		ExpiresAt: time.Now().Add(ResetTokenTTL),
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return user, resetToken, nil
+}
+
+// ResetPassword sets a new password with a reset token and returns the
+// user it belongs to. The token is checked before the password is hashed,
+// so guessing tokens costs no bcrypt.
+func (s *UserService) ResetPassword(resetToken, newPassword string) (uint, error) {
+	rt, err := s.users.FindResetToken(utils.HashToken(resetToken), time.Now())
+	if errors.Is(err, repository.ErrNotFound) {
+		return 0, ErrInvalidResetToken
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	hashedPassword, err := utils.GenerateHashedPassword(newPassword, s.bcryptCost)
+	if err != nil {
+		return 0, err
+	}
+	// spent by a concurrent reset in the meantime
+	if err := s.users.ResetPassword(*rt, hashedPassword, time.Now()); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return 0, ErrInvalidResetToken
+		}
+		return 0, err
+	}
+	return rt.UserID, nil
+}
+
+// List returns a page of users and the total count
+func (s *UserService) List(page, limit int) ([]model.User, int64, error) {
+	return s.users.List((page-1)*limit, limit)
+}
+
+// AssignRole gives a user a role, the last admin can't be demoted so there
+// is always someone left to manage users
+func (s *UserService) AssignRole(id uint, role string) (*model.User, error) {
+	if !rbac.ValidRole(role) {
+		return nil, ErrInvalidRole
+	}
+
+	user, err := s.users.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	// the last admin check happens with the write, see UpdateRole
+	if err := s.users.UpdateRole(id, role); err != nil {
+		return nil, err
+	}
+	user.Role = role
+	return user, nil
+}
+
+// BootstrapAdmin promotes the account of username to admin while there is
+// no admin, a leftover setting can't undo a later demotion. The account must
+// exist already: promoting whoever registers the name later would hand the
+// first admin to anyone who gets there first.
+func (s *UserService) BootstrapAdmin(username string) error {
+	admins, err := s.users.CountByRole(rbac.RoleAdmin)
+	if err != nil || admins > 0 {
+		return err
+	}
+
+	user, err := s.users.FindByUsername(username)
+	if errors.Is(err, repository.ErrNotFound) {
+		return fmt.Errorf("user %q does not exist, register it before naming it the bootstrap admin", username)
+	}
+	if err != nil {
+		return err
+	}
+	return s.users.UpdateRole(user.ID, rbac.RoleAdmin)
+}
@@ -0,0 +1,178 @@
+package service
+
+import (
+	"errors"
+	"gin-blog-app/model"
+	"gin-blog-app/rbac"
+	"gin-blog-app/repository"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func newUserService(t *testing.T) (*UserService, *model.User) {
+	t.Helper()
+
+	s := NewUserService(repository.NewMemoryUserRepository(), bcrypt.MinCost)
+	user, err := s.Register(model.UserRegisterInput{Username: "alice1", Password: "password123", Email: "Alice@Example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, user
+}
+
+func TestRegister(t *testing.T) {
+	s, user := newUserService(t)
+
+	if user.Email == nil || *user.Email != "alice@example.com" {
+		t.Errorf("email %v, want it lowercased", user.Email)
+	}
+
+	tests := []struct {
+		name    string
+		in      model.UserRegisterInput
+		wantErr error
+	}{
+		{"taken username", model.UserRegisterInput{Username: "alice1", Password: "password123"}, ErrUsernameTaken},
+		{"taken email", model.UserRegisterInput{Username: "bob123", Password: "password123", Email: "ALICE@example.com "}, ErrEmailTaken},
+		{"no email", model.UserRegisterInput{Username: "bob123", Password: "password123"}, nil},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := s.Register(tc.in); !errors.Is(err, tc.wantErr) {
+				t.Errorf("error %v, want %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	s, user := newUserService(t)
+
+	got, err := s.Authenticate("alice1", "password123")
+	if err != nil || got.ID != user.ID {
+		t.Fatalf("got %+v, %v", got, err)
+	}
+	if _, err := s.Authenticate("alice1", "wrong-password"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("wrong password: %v", err)
+	}
+	if _, err := s.Authenticate("nobody", "password123"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("unknown user: %v", err)
+	}
+}
+
+func TestChangePassword(t *testing.T) {
+	s, user := newUserService(t)
+
+	if err := s.ChangePassword(user.ID, "wrong-password", "new-password"); !errors.Is(err, ErrWrongPassword) {
+		t.Errorf("wrong old password: %v", err)
+	}
+	if err := s.ChangePassword(user.ID, "password123", "new-password"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Authenticate("alice1", "new-password"); err != nil {
+		t.Errorf("new password refused: %v", err)
+	}
+}
+
+func TestPasswordReset(t *testing.T) {
+	s, user := newUserService(t)
+
+	if _, _, err := s.StartPasswordReset("nobody@example.com"); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("unknown email: %v", err)
+	}
+	_, first, err := s.StartPasswordReset(" ALICE@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, latest, err := s.StartPasswordReset("alice@example.com")
+	if err != nil || got.ID != user.ID {
+		t.Fatalf("got %+v, %v", got, err)
+	}
+
+	// a long password would be refused by bcrypt, the token is checked first
+	long := string(make([]byte, 100))
+	if _, err := s.ResetPassword(first, long); !errors.Is(err, ErrInvalidResetToken) {
+		t.Errorf("superseded token: %v", err)
+	}
+	if _, err := s.ResetPassword("guess", long); !errors.Is(err, ErrInvalidResetToken) {
+		t.Errorf("unknown token: %v", err)
+	}
+
+	userID, err := s.ResetPassword(latest, "new-password")
+	if err != nil || userID != user.ID {
+		t.Fatalf("reset: user %d, %v", userID, err)
+	}
+	if _, err := s.Authenticate("alice1", "new-password"); err != nil {
+		t.Errorf("new password refused: %v", err)
+	}
+	if _, err := s.ResetPassword(latest, "other-password"); !errors.Is(err, ErrInvalidResetToken) {
+		t.Errorf("spent token: %v", err)
+	}
+}
+
+func TestAssignRole(t *testing.T) {
+	s, user := newUserService(t)
+
+	if _, err := s.AssignRole(user.ID, "root"); !errors.Is(err, ErrInvalidRole) {
+		t.Errorf("unknown role: %v", err)
+	}
+	if _, err := s.AssignRole(99, rbac.RoleAdmin); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("unknown user: %v", err)
+	}
+
+	if _, err := s.AssignRole(user.ID, rbac.RoleAdmin); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.AssignRole(user.ID, rbac.RoleUser); !errors.Is(err, ErrLastAdmin) {
+		t.Errorf("demoting the last admin: %v", err)
+	}
+
+	bob, err := s.Register(model.UserRegisterInput{Username: "bob123", Password: "password123"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.AssignRole(bob.ID, rbac.RoleAdmin); err != nil {
+		t.Fatal(err)
+	}
+	got, err := s.AssignRole(user.ID, rbac.RoleModerator)
+	if err != nil || got.Role != rbac.RoleModerator {
+		t.Errorf("demoting one of two admins: %+v, %v", got, err)
+	}
+}
+
+func TestBootstrapAdmin(t *testing.T) {
+	s, user := newUserService(t)
+
+	if err := s.BootstrapAdmin("nobody"); err == nil {
+		t.Error("promoted an account that doesn't exist")
+	}
+	if err := s.BootstrapAdmin(user.Username); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := s.Get(user.ID); got.Role != rbac.RoleAdmin {
+		t.Fatalf("role %q, want admin", got.Role)
+	}
+
+	// once there is an admin the setting does nothing, even for a name
+	// nobody has registered
+	bob, err := s.Register(model.UserRegisterInput{Username: "bob123", Password: "password123"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.AssignRole(bob.ID, rbac.RoleAdmin); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.AssignRole(user.ID, rbac.RoleUser); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.BootstrapAdmin(user.Username); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := s.Get(user.ID); got.Role != rbac.RoleUser {
+		t.Errorf("demoted admin promoted again: %q", got.Role)
+	}
+	if err := s.BootstrapAdmin("nobody"); err != nil {
+		t.Errorf("with an admin: %v", err)
+	}
+}
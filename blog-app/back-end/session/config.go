@@ -0,0 +1,95 @@
+package session
+
+import (
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Config holds the session lifetimes and cookie attributes
+type Config struct {
+	// AbsoluteLifetime is the hard limit of a session from login
+	AbsoluteLifetime time.Duration
+	// IdleTimeout ends a session that saw no request for this long
+	IdleTimeout time.Duration
+	// SweepInterval is how often dead sessions are purged
+	SweepInterval time.Duration
+
+	// cookie attributes, an empty domain makes host-only cookies
+	CookieSecure   bool
+	CookieSameSite http.SameSite
+	CookieDomain   string
+}
+
+// TouchInterval limits how often last-seen is written for a session
+const TouchInterval = time.Minute
+
+func DefaultConfig() Config {
+	return Config{
+		AbsoluteLifetime: 7 * 24 * time.Hour,
+		IdleTimeout:      24 * time.Hour,
+		SweepInterval:    time.Hour,
+		CookieSameSite:   http.SameSiteLaxMode,
+	}
+}
+
+// SameSite parses lax, strict or none
+func SameSite(mode string) http.SameSite {
+	switch mode {
+	case "strict":
+		return http.SameSiteStrictMode
+	case "none":
+		return http.SameSiteNoneMode
+	}
+	return http.SameSiteLaxMode
+}
+
+// IdleDeadline is the next idle expiry, never past the absolute expiry
+func (cfg Config) IdleDeadline(now, expiresAt time.Time) time.Time {
+	deadline := now.Add(cfg.IdleTimeout)
+	if deadline.After(expiresAt) {
+		return expiresAt
+	}
+	return deadline
+}
+
+// NeedsRenewal reports whether less than half of the idle window is left
+func (cfg Config) NeedsRenewal(now, idleExpiresAt time.Time) bool {
+	return idleExpiresAt.Sub(now) < cfg.IdleTimeout/2
+}
+
+//----------------------------------COOKIES------------------------------------------
+
+// SetCookies writes the session & csrf cookies, both expire with the idle deadline
+func (cfg Config) SetCookies(c *gin.Context, sessionToken, csrfToken string, expires time.Time) {
+	maxAge := int(time.Until(expires).Seconds())
+	cfg.setCookie(c, "session_token", sessionToken, maxAge, true)
+	cfg.setCookie(c, "csrf_token", csrfToken, maxAge, false)
+}
+
+// SetCSRFCookie writes a new csrf cookie, the client script reads it
+func (cfg Config) SetCSRFCookie(c *gin.Context, csrfToken string, expires time.Time) {
+	cfg.setCookie(c, "csrf_token", csrfToken, int(time.Until(expires).Seconds()), false)
+}
+
+// ClearCookies expires session & csrf cookies on the client
+func (cfg Config) ClearCookies(c *gin.Context) {
+	cfg.setCookie(c, "session_token", "", -1, true)
+	cfg.setCookie(c, "csrf_token", "", -1, true)
+}
+
+// attributes from the config, gin's SetCookie has no SameSite argument
+func (cfg Config) setCookie(c *gin.Context, name, value string, maxAge int, httpOnly bool) {
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     name,
+		Value:    url.QueryEscape(value),
+		MaxAge:   maxAge,
+		Path:     "/",
+		Domain:   cfg.CookieDomain,
+		Secure:   cfg.CookieSecure,
+		HttpOnly: httpOnly,
+		SameSite: cfg.CookieSameSite,
+	})
+}
@@ -0,0 +1,35 @@
+package session
+
+import (
+	"gin-blog-app/repository"
+	"log"
+	"time"
+)
+
+// StartSweeper purges expired and idle sessions every interval
+// until the returned stop function is called
+func StartSweeper(store repository.SessionRepository, interval time.Duration) (stop func()) {
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case now := <-ticker.C:
+				n, err := store.DeleteExpired(now)
+				if err != nil {
+					log.Printf("session sweeper: %v", err)
+					continue
+				}
+				if n > 0 {
+					log.Printf("session sweeper: purged %d sessions", n)
+				}
+			}
+		}
+	}()
+
+	return func() { close(done) }
+}
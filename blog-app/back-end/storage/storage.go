@@ -0,0 +1,21 @@
+// Package storage keeps uploaded files behind the BlobStore interface, on the
+// local filesystem or in an S3-compatible bucket.
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+var ErrNotFound = errors.New("blob not found")
+
+// BlobStore stores immutable blobs under string keys like "ab/cdef…"
+type BlobStore interface {
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	// Get returns ErrNotFound for a missing key
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Exists(ctx context.Context, key string) (bool, error)
+	// Delete of a missing key is not an error
+	Delete(ctx context.Context, key string) error
+}
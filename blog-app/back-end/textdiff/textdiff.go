@@ -0,0 +1,230 @@
+// Package textdiff produces line based unified diffs.
+package textdiff
+
+import (
+	"fmt"
+	"strings"
+)
+
+// lines of unchanged context around every hunk
+const context = 3
+
+// past these the diff gives up on the shortest edit script and replaces the
+// changed lines as a whole. The search keeps a copy of its frontier per step,
+// about maxEditDistance² ints (2 MB), and compares lines in proportion to
+// maxLines × maxEditDistance; diffs are served to anonymous clients.
+const (
+	maxEditDistance = 500
+	maxLines        = 20000 // of both sides, once the common ends are cut off
+)
+
+type op struct {
+	kind byte // ' ', '-' or '+'
+	line string
+	// lines of a and b before this one
+	a, b int
+}
+
+// Unified returns the unified diff turning from into to, empty when both are
+// equal. fromName and toName label the --- and +++ lines.
+func Unified(fromName, toName, from, to string) string {
+	ops := edits(splitLines(from), splitLines(to))
+
+	var out strings.Builder
+	for i := 0; i < len(ops); {
+		// next change
+		for i < len(ops) && ops[i].kind == ' ' {
+			i++
+		}
+		if i == len(ops) {
+			break
+		}
+
+		// changes closer than twice the context share a hunk
+		start := max(i-context, 0)
+		end := i
+		for j := i; j < len(ops); j++ {
+			if ops[j].kind != ' ' {
+				end = j + 1
+				continue
+			}
+			if j-end >= 2*context {
+				break
+			}
+		}
+		stop := min(end+context, len(ops))
+
+		if out.Len() == 0 {
+			fmt.Fprintf(&out, "--- %s\n+++ %s\n", fromName, toName)
+		}
+		writeHunk(&out, ops[start:stop])
+		i = stop
+	}
+	return out.String()
+}
+
+func writeHunk(out *strings.Builder, ops []op) {
+	var aCount, bCount int
+	for _, o := range ops {
+		if o.kind != '+' {
+			aCount++
+		}
+		if o.kind != '-' {
+			bCount++
+		}
+	}
+
+	// an empty side is addressed by the line before it
+	aStart, bStart := ops[0].a+1, ops[0].b+1
+	if aCount == 0 {
+		aStart--
+	}
+	if bCount == 0 {
+		bStart--
+	}
+
+	fmt.Fprintf(out, "@@ -%s +%s @@\n", hunkRange(aStart, aCount), hunkRange(bStart, bCount))
+	for _, o := range ops {
+		out.WriteByte(o.kind)
+		out.WriteString(o.line)
+		out.WriteByte('\n')
+	}
+}
+
+func hunkRange(start, count int) string {
+	if count == 1 {
+		return fmt.Sprint(start)
+	}
+	return fmt.Sprintf("%d,%d", start, count)
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// edit script between a and b: the common first and last lines are kept
+// as they are, the lines between get the shortest script
+func edits(a, b []string) []op {
+	pre := 0
+	for pre < len(a) && pre < len(b) && a[pre] == b[pre] {
+		pre++
+	}
+	suf := 0
+	for suf < len(a)-pre && suf < len(b)-pre && a[len(a)-1-suf] == b[len(b)-1-suf] {
+		suf++
+	}
+
+	ops := make([]op, 0, len(a)+len(b)-pre-suf)
+	for i := 0; i < pre; i++ {
+		ops = append(ops, op{kind: ' ', line: a[i], a: i, b: i})
+	}
+	for _, o := range shortest(a[pre:len(a)-suf], b[pre:len(b)-suf]) {
+		o.a += pre
+		o.b += pre
+		ops = append(ops, o)
+	}
+	for i := suf; i > 0; i-- {
+		x, y := len(a)-i, len(b)-i
+		ops = append(ops, op{kind: ' ', line: a[x], a: x, b: y})
+	}
+	return ops
+}
+
+// shortest edit script between a and b (Myers' algorithm), or all of a
+// replaced by all of b past maxLines or maxEditDistance
+func shortest(a, b []string) []op {
+	n, m := len(a), len(b)
+	if n+m > maxLines {
+		return replace(a, b)
+	}
+	limit := min(n+m, maxEditDistance)
+	offset := limit + 1
+	v := make([]int, 2*limit+3)
+
+	// trace[d] holds the furthest x of every diagonal k (-d <= k <= d)
+	// before step d, indexed by k+d
+	var trace [][]int
+	for d := 0; d <= limit; d++ {
+		trace = append(trace, append([]int(nil), v[offset-d:offset+d+1]...))
+
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1] // down: insertion
+			} else {
+				x = v[offset+k-1] + 1 // right: deletion
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+
+			if x >= n && y >= m {
+				return backtrack(a, b, trace)
+			}
+		}
+	}
+	return replace(a, b)
+}
+
+// every line of a removed, then every line of b added
+func replace(a, b []string) []op {
+	ops := make([]op, 0, len(a)+len(b))
+	for i, line := range a {
+		ops = append(ops, op{kind: '-', line: line, a: i, b: 0})
+	}
+	for i, line := range b {
+		ops = append(ops, op{kind: '+', line: line, a: len(a), b: i})
+	}
+	return ops
+}
+
+func backtrack(a, b []string, trace [][]int) []op {
+	x, y := len(a), len(b)
+	var rev []op
+
+	for d := len(trace) - 1; d > 0; d-- {
+		v := trace[d]
+		at := func(k int) int { return v[k+d] }
+
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && at(k-1) < at(k+1)) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := at(prevK)
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			x--
+			y--
+			rev = append(rev, op{kind: ' ', line: a[x], a: x, b: y})
+		}
+		if x == prevX {
+			y--
+			rev = append(rev, op{kind: '+', line: b[y], a: x, b: y})
+		} else {
+			x--
+			rev = append(rev, op{kind: '-', line: a[x], a: x, b: y})
+		}
+	}
+	for x > 0 && y > 0 {
+		x--
+		y--
+		rev = append(rev, op{kind: ' ', line: a[x], a: x, b: y})
+	}
+
+	ops := make([]op, len(rev))
+	for i := range rev {
+		ops[i] = rev[len(rev)-1-i]
+	}
+	return ops
+}
@@ -0,0 +1,164 @@
+package textdiff
+
+import (
+	"fmt"
+	"math/rand"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestUnified(t *testing.T) {
+	tests := []struct {
+		name     string
+		from, to string
+		want     string
+	}{
+		{"equal", "a\nb\n", "a\nb", ""},
+		{"both empty", "", "", ""},
+		{"crlf", "a\r\nb\r\n", "a\nb\n", ""},
+		{"change", "a\nb\nc\n", "a\nB\nc\n", "--- old\n+++ new\n@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n"},
+		{"from empty", "", "a\nb\n", "--- old\n+++ new\n@@ -0,0 +1,2 @@\n+a\n+b\n"},
+		{"to empty", "a\n", "", "--- old\n+++ new\n@@ -1 +0,0 @@\n-a\n"},
+		{"insert first", "b\nc\n", "a\nb\nc\n", "--- old\n+++ new\n@@ -1,2 +1,3 @@\n+a\n b\n c\n"},
+		{"context", lines(1, 10), strings.Replace(lines(1, 10), "line 5\n", "five\n", 1),
+			"--- old\n+++ new\n@@ -2,7 +2,7 @@\n line 2\n line 3\n line 4\n-line 5\n+five\n line 6\n line 7\n line 8\n"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := Unified("old", "new", tc.from, tc.to); got != tc.want {
+				t.Errorf("got\n%s\nwant\n%s", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestHunks(t *testing.T) {
+	from := lines(1, 30)
+	far := strings.NewReplacer("line 2\n", "two\n", "line 20\n", "twenty\n").Replace(from)
+	near := strings.NewReplacer("line 2\n", "two\n", "line 7\n", "seven\n").Replace(from)
+
+	if n := strings.Count(Unified("a", "b", from, far), "@@ -"); n != 2 {
+		t.Errorf("far apart changes in %d hunks, want 2", n)
+	}
+	if n := strings.Count(Unified("a", "b", from, near), "@@ -"); n != 1 {
+		t.Errorf("close changes in %d hunks, want 1", n)
+	}
+}
+
+// random edits, the diff applied to from must give to
+func TestRoundTrip(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	words := []string{"a", "b", "c", "d", ""}
+	text := func(n int) string {
+		var b strings.Builder
+		for i := 0; i < n; i++ {
+			b.WriteString(words[rnd.Intn(len(words))] + "\n")
+		}
+		return b.String()
+	}
+
+	for i := 0; i < 200; i++ {
+		from, to := text(rnd.Intn(30)), text(rnd.Intn(30))
+		diff := Unified("a", "b", from, to)
+		if got := apply(t, from, diff); got != strings.Join(splitLines(to), "\n") {
+			t.Fatalf("from %q to %q: diff\n%s\napplied to %q", from, to, diff, got)
+		}
+	}
+}
+
+// one changed line in a long text is found however long the text is
+func TestLongCommonEnds(t *testing.T) {
+	from := lines(1, 50000)
+	to := strings.Replace(from, "line 25000\n", "changed\n", 1)
+
+	want := "--- a\n+++ b\n@@ -24997,7 +24997,7 @@\n line 24997\n line 24998\n line 24999\n-line 25000\n+changed\n" +
+		" line 25001\n line 25002\n line 25003\n"
+	if got := Unified("a", "b", from, to); got != want {
+		t.Errorf("got\n%s", got)
+	}
+}
+
+// inputs too different or too long are replaced as a whole, within bounded memory
+func TestBounded(t *testing.T) {
+	tests := []struct {
+		name     string
+		from, to string
+	}{
+		{"edit distance", lines(1, 5000), lines(5001, 10000)},
+		{"lines", lines(1, 15000) + "x\n", lines(1, 15000)[len("line 1\n"):] + "y\n"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var before, after runtime.MemStats
+			runtime.ReadMemStats(&before)
+			diff := Unified("a", "b", tc.from, tc.to)
+			runtime.ReadMemStats(&after)
+
+			if got := apply(t, tc.from, diff); got != strings.Join(splitLines(tc.to), "\n") {
+				t.Fatal("diff does not turn from into to")
+			}
+			if alloc := after.TotalAlloc - before.TotalAlloc; alloc > 16<<20 {
+				t.Errorf("allocated %d MB", alloc>>20)
+			}
+		})
+	}
+}
+
+// "line <first>\n" to "line <last>\n"
+func lines(first, last int) string {
+	var b strings.Builder
+	for i := first; i <= last; i++ {
+		fmt.Fprintf(&b, "line %d\n", i)
+	}
+	return b.String()
+}
+
+// apply runs the hunks of a unified diff on from
+func apply(t *testing.T, from, diff string) string {
+	t.Helper()
+
+	src := splitLines(from)
+	var out []string
+	next := 0 // first line of src not copied yet
+	for _, line := range splitLines(diff) {
+		switch {
+		case strings.HasPrefix(line, "--- "), strings.HasPrefix(line, "+++ "):
+		case strings.HasPrefix(line, "@@ "):
+			start := hunkStart(t, line)
+			out = append(out, src[next:start]...)
+			next = start
+		case strings.HasPrefix(line, "+"):
+			out = append(out, line[1:])
+		case strings.HasPrefix(line, "-"), strings.HasPrefix(line, " "):
+			if next >= len(src) || src[next] != line[1:] {
+				t.Fatalf("hunk line %q does not match from", line)
+			}
+			if line[0] == ' ' {
+				out = append(out, line[1:])
+			}
+			next++
+		default:
+			t.Fatalf("unexpected diff line %q", line)
+		}
+	}
+	return strings.Join(append(out, src[next:]...), "\n")
+}
+
+// index in from of the first line of a hunk "@@ -start[,count] ..."
+func hunkStart(t *testing.T, header string) int {
+	t.Helper()
+
+	field := strings.Fields(header)[1][1:]
+	start, count, _ := strings.Cut(field, ",")
+	n, err := strconv.Atoi(start)
+	if err != nil {
+		t.Fatalf("bad hunk header %q", header)
+	}
+	// an empty side names the line before it
+	if count == "0" {
+		return n
+	}
+	return n - 1
+}
@@ -0,0 +1,265 @@
+package throttle
+
+import (
+	"gin-blog-app/audit"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Policy of one throttling dimension (account or IP)
+type Policy struct {
+	// FreeAttempts failures are allowed before any delay kicks in
+	FreeAttempts int
+	// MaxFailures within Window lock the key for LockoutDuration
+	MaxFailures     int
+	Window          time.Duration
+	LockoutDuration time.Duration
+	// delay after each failure past FreeAttempts, doubling up to MaxDelay
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+}
+
+// delay imposed after the n-th failure
+func (p Policy) delay(n int) time.Duration {
+	if n >= p.MaxFailures {
+		return p.LockoutDuration
+	}
+	if n <= p.FreeAttempts {
+		return 0
+	}
+
+	d := p.BaseDelay
+	for i := p.FreeAttempts + 1; i < n && d < p.MaxDelay; i++ {
+		d *= 2
+	}
+	if d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	return d
+}
+
+// LoginLimiter throttles failed logins per username and per client IP, and
+// password reset requests per email and per client IP
+type LoginLimiter struct {
+	store   FailureStore
+	audit   audit.Logger
+	Account Policy
+	IP      Policy
+	// reset requests of one email, every request counts
+	Reset Policy
+}
+
+func NewLoginLimiter(store FailureStore, auditLog audit.Logger) *LoginLimiter {
+	return &LoginLimiter{
+		store: store,
+		audit: auditLog,
+		Account: Policy{
+			FreeAttempts:    2,
+			MaxFailures:     5,
+			Window:          15 * time.Minute,
+			LockoutDuration: 15 * time.Minute,
+			BaseDelay:       time.Second,
+			MaxDelay:        30 * time.Second,
+		},
+		// an IP may front many users (NAT), so it gets more room
+		IP: Policy{
+			FreeAttempts:    10,
+			MaxFailures:     50,
+			Window:          15 * time.Minute,
+			LockoutDuration: time.Hour,
+			BaseDelay:       time.Second,
+			MaxDelay:        time.Minute,
+		},
+		Reset: Policy{
+			FreeAttempts:    3,
+			MaxFailures:     10,
+			Window:          time.Hour,
+			LockoutDuration: time.Hour,
+			BaseDelay:       time.Minute,
+			MaxDelay:        15 * time.Minute,
+		},
+	}
+}
+
+func accountKey(username string) string {
+	return "login:user:" + strings.ToLower(strings.TrimSpace(username))
+}
+
+func ipKey(ip string) string {
+	return "login:ip:" + ip
+}
+
+func resetKey(email string) string {
+	return "reset:email:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+// dimension is one counter an attempt is throttled on
+type dimension struct {
+	key    string
+	policy Policy
+}
+
+// Attempt is a login attempt reserved by Reserve, it ends with exactly one
+// of Failure, Success or Release
+type Attempt struct {
+	l       *LoginLimiter
+	event   string // audit event of a lockout
+	subject string // username or email
+	ip      string
+	dims    []dimension // account first, then IP
+	counts  []int       // failure count per dimension after the reservation, 0 when not counted
+}
+
+// Reserve counts a login attempt as a failure before the password is
+// checked, so parallel guesses can't all get past the check before any of
+// them is counted: past MaxFailures only one attempt per lockout goes ahead
+// however many run at once (the backoff delays before that are per
+// reservation). It returns nil and how long the client has to wait when the
+// attempt may not go ahead. Blocks set by the reservation stay when it is
+// given back.
+func (l *LoginLimiter) Reserve(username, ip string) (*Attempt, time.Duration) {
+	return l.reserve(&Attempt{
+		event:   "login.lockout",
+		subject: username,
+		ip:      ip,
+		dims:    []dimension{{accountKey(username), l.Account}, {ipKey(ip), l.IP}},
+	})
+}
+
+// ReserveReset counts a password reset request on the email and on the IP,
+// which it shares with logins. Every request is kept (Failure) whether the
+// email is known or not, so the reset mail can't flood an inbox and asking
+// for many addresses wears down the IP like guessing passwords does.
+func (l *LoginLimiter) ReserveReset(email, ip string) (*Attempt, time.Duration) {
+	return l.reserve(&Attempt{
+		event:   "password_reset.lockout",
+		subject: email,
+		ip:      ip,
+		dims:    []dimension{{resetKey(email), l.Reset}, {ipKey(ip), l.IP}},
+	})
+}
+
+func (l *LoginLimiter) reserve(a *Attempt) (*Attempt, time.Duration) {
+	dims := a.dims
+	if wait := l.blockedFor(dims); wait > 0 {
+		return nil, wait
+	}
+
+	a.l = l
+	a.counts = make([]int, len(dims))
+	var refused time.Duration
+	for i, d := range dims {
+		n, err := l.store.Incr(d.key, d.policy.Window)
+		if err != nil {
+			// a broken store must not lock everybody out
+			log.Printf("throttle: %v", err)
+			continue
+		}
+		a.counts[i] = n
+		if n > d.policy.MaxFailures && !l.firstAfterLockout(d) && d.policy.LockoutDuration > refused {
+			refused = d.policy.LockoutDuration
+		}
+	}
+
+	// a parallel attempt took the last one, the lockout it set tells the wait
+	if refused > 0 {
+		a.Release()
+		if wait := l.blockedFor(dims); wait > 0 {
+			return nil, wait
+		}
+		return nil, refused
+	}
+
+	// the next attempt waits as if this one failed
+	now := time.Now()
+	for i, d := range dims {
+		if n := a.counts[i]; n > 0 {
+			if delay := d.policy.delay(n); delay > 0 {
+				if err := l.store.Block(d.key, now.Add(delay)); err != nil {
+					log.Printf("throttle: %v", err)
+				}
+			}
+		}
+	}
+	return a, 0
+}
+
+// whether this is the one attempt let through once a lockout is over,
+// before the failures are forgotten (it locks again when it fails); the
+// attempts racing for it count on a key of that lockout, the first one wins
+func (l *LoginLimiter) firstAfterLockout(d dimension) bool {
+	until, err := l.store.BlockedUntil(d.key)
+	if err != nil || until.IsZero() || until.After(time.Now()) {
+		return false
+	}
+	n, err := l.store.Incr(d.key+":after:"+strconv.FormatInt(until.UnixNano(), 10), d.policy.Window)
+	return err == nil && n == 1
+}
+
+// longest block on any of dims
+func (l *LoginLimiter) blockedFor(dims []dimension) time.Duration {
+	var wait time.Duration
+	now := time.Now()
+
+	for _, d := range dims {
+		until, err := l.store.BlockedUntil(d.key)
+		if err != nil {
+			log.Printf("throttle: %v", err)
+			continue
+		}
+		if w := until.Sub(now); w > wait {
+			wait = w
+		}
+	}
+	return wait
+}
+
+// Failure keeps the reserved failure (wrong password) and audits a lockout
+func (a *Attempt) Failure() {
+	for i, d := range a.dims {
+		n := a.counts[i]
+		if n < d.policy.MaxFailures || a.l.audit == nil {
+			continue
+		}
+		a.l.audit.Log(audit.Event{
+			Type:    a.event,
+			Subject: a.subject,
+			IP:      a.ip,
+			Details: map[string]interface{}{
+				"key":      d.key,
+				"failures": n,
+				"duration": d.policy.LockoutDuration.String(),
+			},
+		})
+	}
+}
+
+// Success clears the account counter and gives the IP's reservation back.
+// The IP counter is not cleared so a valid login cannot be used to keep
+// guessing other accounts, and a block the IP already has stays.
+func (a *Attempt) Success() {
+	if err := a.l.store.Reset(a.dims[0].key); err != nil {
+		log.Printf("throttle: %v", err)
+	}
+	a.release(1)
+}
+
+// Release gives the reservation back, for an attempt that could not be
+// decided (a server error)
+func (a *Attempt) Release() {
+	a.release(0)
+}
+
+// takes back the counted failures of the dimensions from index from on
+func (a *Attempt) release(from int) {
+	for i := from; i < len(a.dims); i++ {
+		if a.counts[i] == 0 {
+			continue
+		}
+		if err := a.l.store.Decr(a.dims[i].key); err != nil {
+			log.Printf("throttle: %v", err)
+		}
+	}
+}
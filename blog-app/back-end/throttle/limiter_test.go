@@ -0,0 +1,202 @@
+package throttle
+
+import (
+	"gin-blog-app/audit"
+	"sync"
+	"testing"
+	"time"
+)
+
+// records the events logged
+type auditRecorder struct {
+	mu     sync.Mutex
+	events []audit.Event
+}
+
+func (r *auditRecorder) Log(e audit.Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, e)
+}
+
+func TestPolicyDelay(t *testing.T) {
+	p := Policy{FreeAttempts: 2, MaxFailures: 6, LockoutDuration: time.Hour, BaseDelay: time.Second, MaxDelay: 3 * time.Second}
+
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{1, 0},
+		{2, 0},
+		{3, time.Second},
+		{4, 2 * time.Second},
+		{5, 3 * time.Second}, // capped at MaxDelay
+		{6, time.Hour},
+		{9, time.Hour},
+	}
+	for _, tc := range tests {
+		if got := p.delay(tc.failures); got != tc.want {
+			t.Errorf("delay(%d) = %s, want %s", tc.failures, got, tc.want)
+		}
+	}
+}
+
+// no backoff, locked for lockout after max failures
+func newTestLimiter(max int, lockout time.Duration) (*LoginLimiter, *auditRecorder) {
+	rec := &auditRecorder{}
+	l := NewLoginLimiter(NewMemoryStore(), rec)
+	l.Account = Policy{FreeAttempts: max, MaxFailures: max, Window: time.Minute, LockoutDuration: lockout}
+	l.IP = Policy{FreeAttempts: 100, MaxFailures: 100, Window: time.Minute, LockoutDuration: lockout}
+	return l, rec
+}
+
+func TestLockoutExpires(t *testing.T) {
+	l, rec := newTestLimiter(3, 50*time.Millisecond)
+
+	for i := 0; i < 3; i++ {
+		a, wait := l.Reserve("alice", "10.0.0.1")
+		if a == nil {
+			t.Fatalf("attempt %d refused for %s", i+1, wait)
+		}
+		a.Failure()
+	}
+	if a, wait := l.Reserve("Alice ", "10.0.0.2"); a != nil || wait <= 0 {
+		t.Fatalf("locked account: attempt %v, wait %s", a, wait)
+	}
+	if len(rec.events) != 1 || rec.events[0].Type != "login.lockout" {
+		t.Errorf("audited %+v, want one lockout", rec.events)
+	}
+	if a, _ := l.Reserve("bob", "10.0.0.1"); a == nil {
+		t.Error("other account refused")
+	}
+
+	// one attempt per lockout, however many race for it
+	time.Sleep(60 * time.Millisecond)
+	if admitted := reserveParallel(l, 20); admitted != 1 {
+		t.Fatalf("%d attempts admitted after the lockout, want 1", admitted)
+	}
+	if a, _ := l.Reserve("alice", "10.0.0.1"); a != nil {
+		t.Error("failed attempt after the lockout did not lock again")
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	a, wait := l.Reserve("alice", "10.0.0.1")
+	if a == nil {
+		t.Fatalf("still locked after the second lockout, wait %s", wait)
+	}
+	a.Success()
+	if a, _ := l.Reserve("alice", "10.0.0.1"); a == nil {
+		t.Error("refused after a successful login")
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	l, _ := newTestLimiter(5, time.Minute)
+	l.Account.FreeAttempts = 1
+	l.Account.BaseDelay = time.Minute
+	l.Account.MaxDelay = time.Minute
+
+	a, _ := l.Reserve("alice", "10.0.0.1")
+	a.Failure()
+	// the second attempt is already counted, the third waits
+	a, _ = l.Reserve("alice", "10.0.0.1")
+	if a == nil {
+		t.Fatal("free attempt refused")
+	}
+	if a, wait := l.Reserve("alice", "10.0.0.1"); a != nil || wait < 59*time.Second {
+		t.Fatalf("attempt during backoff: %v, wait %s", a, wait)
+	}
+
+	// a correct password ends the backoff
+	a.Success()
+	if a, wait := l.Reserve("alice", "10.0.0.1"); a == nil {
+		t.Errorf("refused after a successful login, wait %s", wait)
+	}
+}
+
+// parallel guesses are counted before any of them is decided
+func TestParallelAttempts(t *testing.T) {
+	l, _ := newTestLimiter(5, time.Minute)
+
+	if admitted := reserveParallel(l, 50); admitted != 5 {
+		t.Errorf("%d of 50 parallel guesses admitted, want 5", admitted)
+	}
+	if a, _ := l.Reserve("alice", "10.0.0.1"); a != nil {
+		t.Error("account not locked")
+	}
+}
+
+// guesses wrong passwords for alice all at once, returns how many got to
+// the password check
+func reserveParallel(l *LoginLimiter, guesses int) int {
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		admitted int
+		start    = make(chan struct{})
+	)
+	for i := 0; i < guesses; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			a, _ := l.Reserve("alice", "10.0.0.1")
+			if a == nil {
+				return
+			}
+			mu.Lock()
+			admitted++
+			mu.Unlock()
+			time.Sleep(10 * time.Millisecond) // the password check
+			a.Failure()
+		}()
+	}
+	close(start)
+	wg.Wait()
+	return admitted
+}
+
+func TestReservationsGivenBack(t *testing.T) {
+	l, _ := newTestLimiter(2, time.Minute)
+	l.IP.MaxFailures = 2
+
+	// logins from one IP (NAT) and server errors don't add up to a lockout
+	for i := 0; i < 5; i++ {
+		a, wait := l.Reserve("alice", "10.0.0.1")
+		if a == nil {
+			t.Fatalf("login %d refused for %s", i+1, wait)
+		}
+		if i%2 == 0 {
+			a.Success()
+		} else {
+			a.Release()
+		}
+	}
+}
+
+func TestResetRequests(t *testing.T) {
+	l, rec := newTestLimiter(5, time.Minute)
+	l.Reset = Policy{FreeAttempts: 3, MaxFailures: 3, Window: time.Minute, LockoutDuration: time.Minute}
+
+	for i := 0; i < 3; i++ {
+		a, wait := l.ReserveReset("alice@example.com", "10.0.0.1")
+		if a == nil {
+			t.Fatalf("request %d refused for %s", i+1, wait)
+		}
+		a.Failure()
+	}
+	if a, wait := l.ReserveReset(" Alice@Example.com", "10.0.0.2"); a != nil || wait <= 0 {
+		t.Fatalf("fourth request: %v, wait %s", a, wait)
+	}
+	if len(rec.events) != 1 || rec.events[0].Type != "password_reset.lockout" {
+		t.Errorf("audited %+v, want one reset lockout", rec.events)
+	}
+
+	// other emails and logins have their own counters
+	if a, _ := l.ReserveReset("bob@example.com", "10.0.0.1"); a == nil {
+		t.Error("other email refused")
+	}
+	if a, _ := l.Reserve("alice@example.com", "10.0.0.1"); a == nil {
+		t.Error("login refused")
+	}
+}
@@ -0,0 +1,129 @@
+package throttle
+
+import (
+	"sync"
+	"time"
+)
+
+// FailureStore keeps failure counters and blocks per key.
+// The operations map onto Redis (INCR+EXPIRE, DECR, SET EX, GET, DEL) so a
+// shared store can replace the in-memory one when running several instances.
+type FailureStore interface {
+	// Incr adds a failure to key and returns the new count,
+	// the counter is forgotten ttl after the last failure
+	Incr(key string, ttl time.Duration) (int, error)
+	// Decr takes back a failure added by Incr
+	Decr(key string) error
+	// Block blocks key until the given time
+	Block(key string, until time.Time) error
+	// BlockedUntil returns the end of the key's block, zero when not blocked
+	BlockedUntil(key string) (time.Time, error)
+	// Reset clears the counter and block of key
+	Reset(key string) error
+}
+
+type memoryEntry struct {
+	failures     int
+	expiresAt    time.Time
+	blockedUntil time.Time
+}
+
+// in-memory store, fine for a single instance
+type memoryStore struct {
+	mu        sync.Mutex
+	entries   map[string]*memoryEntry
+	lastPurge time.Time
+}
+
+func NewMemoryStore() FailureStore {
+	return &memoryStore{entries: make(map[string]*memoryEntry)}
+}
+
+func (s *memoryStore) Incr(key string, ttl time.Duration) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.purge(now)
+
+	e := s.live(key, now)
+	if e == nil {
+		e = &memoryEntry{}
+		s.entries[key] = e
+	}
+	e.failures++
+	if exp := now.Add(ttl); exp.After(e.expiresAt) {
+		e.expiresAt = exp
+	}
+	return e.failures, nil
+}
+
+func (s *memoryStore) Decr(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if e := s.live(key, time.Now()); e != nil && e.failures > 0 {
+		e.failures--
+	}
+	return nil
+}
+
+func (s *memoryStore) Block(key string, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e := s.live(key, time.Now())
+	if e == nil {
+		e = &memoryEntry{}
+		s.entries[key] = e
+	}
+	e.blockedUntil = until
+	if until.After(e.expiresAt) {
+		e.expiresAt = until
+	}
+	return nil
+}
+
+func (s *memoryStore) BlockedUntil(key string) (time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if e := s.live(key, time.Now()); e != nil {
+		return e.blockedUntil, nil
+	}
+	return time.Time{}, nil
+}
+
+func (s *memoryStore) Reset(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.entries, key)
+	return nil
+}
+
+// entry of key unless expired
+func (s *memoryStore) live(key string, now time.Time) *memoryEntry {
+	e, ok := s.entries[key]
+	if !ok {
+		return nil
+	}
+	if !now.Before(e.expiresAt) {
+		delete(s.entries, key)
+		return nil
+	}
+	return e
+}
+
+// drops expired entries, at most once a minute
+func (s *memoryStore) purge(now time.Time) {
+	if now.Sub(s.lastPurge) < time.Minute {
+		return
+	}
+	s.lastPurge = now
+	for k, e := range s.entries {
+		if !now.Before(e.expiresAt) {
+			delete(s.entries, k)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package token
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// minimum HMAC secret length in bytes
+const minSecretLength = 32
+
+// Keyring holds the HMAC signing keys by key ID (kid)
+// new tokens are signed with the active key, tokens signed with any key in
+// the ring still verify, so keys can be rotated without logging clients out
+type Keyring struct {
+	keys   map[string][]byte
+	active string
+}
+
+// ParseKeyring reads keys from "kid1:secret1,kid2:secret2", the active kid
+// defaults to the last key of the list
+func ParseKeyring(spec, activeKID string) (*Keyring, error) {
+	ring := &Keyring{keys: make(map[string][]byte)}
+
+	for _, pair := range strings.Split(spec, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		kid, secret, ok := strings.Cut(pair, ":")
+		if !ok || kid == "" {
+			return nil, fmt.Errorf("signing key %q: expected kid:secret", pair)
+		}
+		if len(secret) < minSecretLength {
+			return nil, fmt.Errorf("signing key %q: secret must be at least %d bytes", kid, minSecretLength)
+		}
+		if _, dup := ring.keys[kid]; dup {
+			return nil, fmt.Errorf("signing key %q: duplicate kid", kid)
+		}
+
+		ring.keys[kid] = []byte(secret)
+		ring.active = kid
+	}
+
+	if len(ring.keys) == 0 {
+		return nil, errors.New("no signing keys configured")
+	}
+
+	if activeKID != "" {
+		if _, ok := ring.keys[activeKID]; !ok {
+			return nil, fmt.Errorf("active kid %q is not in the keyring", activeKID)
+		}
+		ring.active = activeKID
+	}
+
+	return ring, nil
+}
+
+// signing key & kid for new tokens
+func (r *Keyring) signingKey() (string, []byte) {
+	return r.active, r.keys[r.active]
+}
+
+// verification key for a kid
+func (r *Keyring) key(kid string) ([]byte, bool) {
+	k, ok := r.keys[kid]
+	return k, ok
+}
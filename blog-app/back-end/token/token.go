@@ -0,0 +1,202 @@
+package token
+
+import (
+	"errors"
+	"fmt"
+	"gin-blog-app/model"
+	"gin-blog-app/utils"
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+)
+
+const issuer = "gin-blog-app"
+
+var (
+	// ErrInvalid is returned for unknown, malformed or expired tokens
+	ErrInvalid = errors.New("invalid token")
+	// ErrReused is returned when an already rotated refresh token comes back,
+	// the whole token family is revoked when that happens
+	ErrReused = errors.New("refresh token reuse detected")
+)
+
+// Manager issues signed access tokens and rotating refresh tokens
+type Manager struct {
+	db         *gorm.DB
+	keys       *Keyring
+	AccessTTL  time.Duration
+	RefreshTTL time.Duration
+}
+
+// Pair is what a token client receives on login and refresh
+type Pair struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+func NewManager(db *gorm.DB, keys *Keyring, accessTTL, refreshTTL time.Duration) *Manager {
+	return &Manager{db: db, keys: keys, AccessTTL: accessTTL, RefreshTTL: refreshTTL}
+}
+
+//----------------------------------ACCESS TOKEN------------------------------------------
+
+// IssueAccess signs a short-lived access token for the user
+func (m *Manager) IssueAccess(userID uint) (string, error) {
+	kid, key := m.keys.signingKey()
+	now := time.Now()
+
+	claims := jwt.RegisteredClaims{
+		Issuer:    issuer,
+		Subject:   strconv.FormatUint(uint64(userID), 10),
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(m.AccessTTL)),
+		ID:        utils.GenerateID(),
+	}
+
+	tok := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	tok.Header["kid"] = kid
+	return tok.SignedString(key)
+}
+
+// ParseAccess verifies an access token and returns its user ID
+func (m *Manager) ParseAccess(raw string) (uint, error) {
+	var claims jwt.RegisteredClaims
+	_, err := jwt.ParseWithClaims(raw, &claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		key, ok := m.keys.key(kid)
+		if !ok {
+			return nil, fmt.Errorf("unknown kid %q", kid)
+		}
+		return key, nil
+	},
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithIssuer(issuer),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return 0, ErrInvalid
+	}
+
+	userID, err := strconv.ParseUint(claims.Subject, 10, 64)
+	if err != nil {
+		return 0, ErrInvalid
+	}
+	return uint(userID), nil
+}
+
+//----------------------------------REFRESH TOKEN------------------------------------------
+
+// Issue starts a new token family for the user and returns the first pair
+func (m *Manager) Issue(userID uint) (*Pair, error) {
+	refresh, err := m.createRefresh(m.db, userID, utils.GenerateID())
+	if err != nil {
+		return nil, err
+	}
+	return m.pair(userID, refresh)
+}
+
+// Refresh rotates a refresh token: the presented token is spent and a new
+// pair in the same family is returned. Presenting a spent token revokes the
+// whole family since either the client or an attacker holds a stolen copy.
+func (m *Manager) Refresh(raw string) (*Pair, error) {
+	var userID uint
+	var next string
+
+	err := m.db.Transaction(func(tx *gorm.DB) error {
+		var current model.RefreshToken
+		if err := tx.Where("token_hash = ?", utils.HashToken(raw)).First(&current).Error; err != nil {
+			return ErrInvalid
+		}
+
+		if current.UsedAt != nil || current.RevokedAt != nil {
+			return ErrReused
+		}
+		if time.Now().After(current.ExpiresAt) {
+			return ErrInvalid
+		}
+
+		// spend it, a concurrent refresh with the same token loses here
+		res := tx.Model(&model.RefreshToken{}).
+			Where("id = ? AND used_at IS NULL", current.ID).
+			Update("used_at", time.Now())
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrReused
+		}
+
+		var err error
+		next, err = m.createRefresh(tx, current.UserID, current.FamilyID)
+		userID = current.UserID
+		return err
+	})
+
+	if errors.Is(err, ErrReused) {
+		if rerr := m.revokeFamilyOf(raw); rerr != nil {
+			return nil, rerr
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return m.pair(userID, next)
+}
+
+// Revoke ends the token family of a refresh token (logout for token clients)
+func (m *Manager) Revoke(raw string) error {
+	return m.revokeFamilyOf(raw)
+}
+
+// RevokeAll ends every token family of a user
+func (m *Manager) RevokeAll(userID uint) error {
+	return m.db.Model(&model.RefreshToken{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", time.Now()).Error
+}
+
+func (m *Manager) revokeFamilyOf(raw string) error {
+	var rt model.RefreshToken
+	if err := m.db.Where("token_hash = ?", utils.HashToken(raw)).First(&rt).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	return m.db.Model(&model.RefreshToken{}).
+		Where("family_id = ? AND revoked_at IS NULL", rt.FamilyID).
+		Update("revoked_at", time.Now()).Error
+}
+
+func (m *Manager) createRefresh(db *gorm.DB, userID uint, familyID string) (string, error) {
+	raw := utils.GenerateToken(32)
+	rt := model.RefreshToken{
+		UserID:    userID,
+		FamilyID:  familyID,
+		TokenHash: utils.HashToken(raw),
+		ExpiresAt: time.Now().Add(m.RefreshTTL),
+	}
+	if err := db.Create(&rt).Error; err != nil {
+		return "", err
+	}
+	return raw, nil
+}
+
+func (m *Manager) pair(userID uint, refresh string) (*Pair, error) {
+	access, err := m.IssueAccess(userID)
+	if err != nil {
+		return nil, err
+	}
+	return &Pair{
+		AccessToken:  access,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(m.AccessTTL.Seconds()),
+		RefreshToken: refresh,
+	}, nil
+}
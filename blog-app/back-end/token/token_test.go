@@ -0,0 +1,157 @@
+package token
+
+import (
+	"context"
+	"errors"
+	"gin-blog-app/migrations"
+	"gin-blog-app/model"
+	"gin-blog-app/utils"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+var (
+	oldKey = "old:" + strings.Repeat("o", minSecretLength)
+	newKey = "new:" + strings.Repeat("n", minSecretLength)
+)
+
+// migrated in-memory database of one test
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory&cache=shared&_pragma=foreign_keys(1)"),
+		&gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	migrator, err := migrations.New(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := migrator.Up(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func newTestManager(t *testing.T, db *gorm.DB, spec, activeKID string) *Manager {
+	t.Helper()
+	keys, err := ParseKeyring(spec, activeKID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewManager(db, keys, time.Minute, time.Hour)
+}
+
+func TestRefreshReuseRevokesFamily(t *testing.T) {
+	db := newTestDB(t)
+	m := newTestManager(t, db, newKey, "")
+
+	user := model.User{Username: "alice1", HashedPassword: "x"}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	first, err := m.Issue(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := m.Issue(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	second, err := m.Refresh(first.RefreshToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.RefreshToken == first.RefreshToken {
+		t.Fatal("refresh token was not rotated")
+	}
+
+	// the spent token comes back: whoever holds the current one is cut off too
+	if _, err := m.Refresh(first.RefreshToken); !errors.Is(err, ErrReused) {
+		t.Fatalf("replayed token: %v, want ErrReused", err)
+	}
+	if _, err := m.Refresh(second.RefreshToken); !errors.Is(err, ErrReused) {
+		t.Fatalf("token of the revoked family: %v, want ErrReused", err)
+	}
+
+	var live int64
+	if err := db.Model(&model.RefreshToken{}).
+		Where("family_id = (SELECT family_id FROM refresh_tokens WHERE token_hash = ?) AND revoked_at IS NULL",
+			utils.HashToken(second.RefreshToken)).
+		Count(&live).Error; err != nil {
+		t.Fatal(err)
+	}
+	if live != 0 {
+		t.Fatalf("%d tokens of the family still live", live)
+	}
+
+	// other logins of the user keep working
+	if _, err := m.Refresh(other.RefreshToken); err != nil {
+		t.Fatalf("other family: %v", err)
+	}
+
+	if _, err := m.Refresh("unknown"); !errors.Is(err, ErrInvalid) {
+		t.Fatalf("unknown token: %v, want ErrInvalid", err)
+	}
+}
+
+func TestParseAccessKeyRotation(t *testing.T) {
+	db := newTestDB(t)
+
+	// signed before the rotation, with the old key active
+	before := newTestManager(t, db, oldKey, "")
+	raw, err := before.IssueAccess(7)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		spec    string
+		wantErr bool
+	}{
+		{"old key active", oldKey, false},
+		{"rotated, old key kept", oldKey + "," + newKey, false},
+		{"old key retired", newKey, true},
+		// same kid, another secret
+		{"old kid, new secret", "old:" + strings.Repeat("x", minSecretLength), true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			m := newTestManager(t, db, tc.spec, "")
+			userID, err := m.ParseAccess(raw)
+			if tc.wantErr {
+				if !errors.Is(err, ErrInvalid) {
+					t.Fatalf("got user %d, err %v, want ErrInvalid", userID, err)
+				}
+				return
+			}
+			if err != nil || userID != 7 {
+				t.Fatalf("got user %d, err %v", userID, err)
+			}
+		})
+	}
+
+	// new tokens carry the active kid and verify without the old key
+	after := newTestManager(t, db, oldKey+","+newKey, "new")
+	raw, err = after.IssueAccess(8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if userID, err := newTestManager(t, db, newKey, "").ParseAccess(raw); err != nil || userID != 8 {
+		t.Fatalf("token of the active key: user %d, err %v", userID, err)
+	}
+}
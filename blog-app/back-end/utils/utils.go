@@ -2,8 +2,12 @@ package utils
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"log"
+	"strings"
+	"sync"
 
 	"github.com/google/uuid"
 	"golang.org/x/crypto/bcrypt"
@@ -14,9 +18,9 @@ func GenerateID() string {
 	return uuid.New().String()
 }
 
-// password hasing algorithum
-func GenerateHashedPassword(password string) (string, error) {
-	bytes, err := bcrypt.GenerateFromPassword([]byte(password), 10)
+// password hasing algorithum, cost is the bcrypt cost
+func GenerateHashedPassword(password string, cost int) (string, error) {
+	bytes, err := bcrypt.GenerateFromPassword([]byte(password), cost)
 	return string(bytes), err
 }
 
@@ -27,6 +31,19 @@ func CompareHashAndPassword(password, hashed string) bool {
 	return err == nil
 }
 
+// DummyPasswordHash returns a bcrypt hash of a random password at cost,
+// made on first use, compared against when a login names an unknown user so
+// the response time does not reveal which usernames exist
+func DummyPasswordHash(cost int) func() string {
+	return sync.OnceValue(func() string {
+		hash, err := GenerateHashedPassword(GenerateToken(16), cost)
+		if err != nil {
+			log.Fatalf("dummy hash generation failed: %v", err)
+		}
+		return hash
+	})
+}
+
 // token generation
 func GenerateToken(length int) string {
 	bytes := make([]byte, length)
@@ -38,6 +55,29 @@ func GenerateToken(length int) string {
 
 }
 
+// token hashing, tokens are only stored as their sha256
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// slug of a tag or category name: lower-case ascii letters & digits joined by '-'
+func Slugify(name string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(strings.TrimSpace(name)) {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			b.WriteRune(r)
+			dash = false
+		case b.Len() > 0 && !dash:
+			b.WriteByte('-')
+			dash = true
+		}
+	}
+	return strings.TrimSuffix(b.String(), "-")
+}
+
 //----------------------------------USER-----------------------------------------
 
 // // db checker is in DB